@@ -0,0 +1,587 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package admin provides an http.Handler to inspect and purge caches.
+//
+// Example:
+//
+//	h := admin.NewHandler(admin.Config{
+//		Authorize: func(r *http.Request, a admin.Action) error {
+//			if a.Op.Destructive() && r.Header.Get("X-Role") != "ops" {
+//				return errors.New("ops role required")
+//			}
+//			return nil
+//		},
+//		Audit: admin.LogAudit(logger),
+//	})
+//	h.Register("sessions", admin.Cache{Conner: rs})
+//	h.Register("queries", admin.Cache{Conner: ms, ForgetTag: func(ctx context.Context, tag string) error {
+//		return idx.Invalidate(ctx, tag)
+//	}})
+//
+//	http.Handle("/admin/cache/", http.StripPrefix("/admin/cache", h))
+//
+// Endpoints:
+//
+//	GET            /                       list the caches and their capabilities
+//	GET            /{cache}/stats          statistics
+//	GET            /{cache}/key?key=K      lookup a key: its remaining time to live and a preview of its value
+//	POST or DELETE /{cache}/key?key=K      forget a key
+//	POST or DELETE /{cache}/prefix?prefix=P forget all keys starting with a prefix
+//	POST or DELETE /{cache}/tag?tag=T      forget all keys associated with a tag
+//	POST or DELETE /{cache}/all            forget all keys
+//
+// All requests are rejected unless Config.Authorize is set, since values (eg. sessions
+// and tokens) are exposed. Set Config.AllowUnauthenticatedReads to permit the actions
+// that are not destructive without it. Destructive (POST and DELETE) requests must
+// also include the X-Remember-Admin header.
+//
+// Responses are encoded as JSON.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultPreviewLen is the maximum length of a value preview when Config.PreviewLen is not set.
+const DefaultPreviewLen = 1024
+
+// RequestHeader must be set (to any value) on destructive requests. Browsers do not
+// send custom headers with cross-origin requests unless the server permits them
+// (which the Handler does not), so forms and scripts on other sites can not purge caches.
+const RequestHeader = "X-Remember-Admin"
+
+// ErrUnsupported is returned when an operation is not supported by a cache.
+var ErrUnsupported = errors.New("not supported")
+
+// TTLer is implemented by storage drivers that can report the remaining time
+// to live of a key (eg. memory, redis).
+type TTLer interface {
+	// TTL returns the remaining time to live of key.
+	// A negative ttl indicates that the key does not expire.
+	TTL(ctx context.Context, key string) (ttl time.Duration, found bool, err error)
+}
+
+// PrefixForgetter is implemented by storage drivers that can forget all keys
+// starting with a prefix (eg. memory, redis).
+type PrefixForgetter interface {
+	// ForgetPrefix forgets all keys starting with prefix and returns how many were forgotten.
+	ForgetPrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// Op identifies an operation performed by the Handler.
+type Op string
+
+const (
+	// List is when the caches are listed.
+	List Op = "list"
+
+	// Stats is when a cache's statistics are fetched.
+	Stats Op = "stats"
+
+	// Lookup is when a key is looked up.
+	Lookup Op = "lookup"
+
+	// Forget is when a key is forgotten.
+	Forget Op = "forget"
+
+	// ForgetPrefix is when all keys starting with a prefix are forgotten.
+	ForgetPrefix Op = "forget-prefix"
+
+	// ForgetTag is when all keys associated with a tag are forgotten.
+	ForgetTag Op = "forget-tag"
+
+	// ForgetAll is when all keys are forgotten.
+	ForgetAll Op = "forget-all"
+)
+
+// Destructive reports whether op removes data from a cache.
+func (op Op) Destructive() bool {
+	switch op {
+	case Forget, ForgetPrefix, ForgetTag, ForgetAll:
+		return true
+	}
+	return false
+}
+
+// Action describes an operation requested from the Handler.
+type Action struct {
+	Op Op
+
+	// Cache is the name of the cache. It is empty for List.
+	Cache string
+
+	// Target is the key, prefix or tag (depending on Op).
+	Target string
+}
+
+// AuditEvent records a destructive action.
+type AuditEvent struct {
+	Time    time.Time
+	Action  Action
+	Request *http.Request
+
+	// Forgotten is the number of keys forgotten (ForgetPrefix only).
+	Forgotten int
+
+	// Denied reports whether the action was rejected by Config.Authorize.
+	Denied bool
+
+	// Err is the error that occurred (including the authorization error).
+	Err error
+}
+
+// Config is used to configure the Handler.
+type Config struct {
+
+	// Authorize is called before every action. If it returns an error, the
+	// action is rejected with a 403 status code and the error's message.
+	// If not set, all actions are rejected (see AllowUnauthenticatedReads).
+	Authorize func(r *http.Request, a Action) error
+
+	// AllowUnauthenticatedReads permits the actions that are not destructive
+	// (List, Stats and Lookup) when Authorize is not set. Lookup exposes previews
+	// of values, so it should only be set when the Handler is not publicly reachable.
+	AllowUnauthenticatedReads bool
+
+	// Audit is called after every destructive action (including those that
+	// were rejected or failed). See LogAudit.
+	Audit func(e AuditEvent)
+
+	// PreviewLen is the maximum length of a value preview.
+	// If not set, DefaultPreviewLen is used.
+	PreviewLen int
+
+	// Clock is used to timestamp audit events.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// Cache is a cache exposed by the Handler.
+type Cache struct {
+	remember.Conner
+
+	// Stats returns the cache's statistics, which are encoded as JSON.
+	// If not set and the Conner has a Stats method with no arguments and a single
+	// result (eg. memory.BoundedMemoryStore, chaos.Chaos), it is used.
+	Stats func() interface{}
+
+	// TTL returns the remaining time to live of key.
+	// If not set and the Conner implements TTLer, it is used.
+	TTL func(ctx context.Context, key string) (ttl time.Duration, found bool, err error)
+
+	// ForgetPrefix forgets all keys starting with prefix.
+	// If not set and the Conner implements PrefixForgetter, it is used.
+	ForgetPrefix func(ctx context.Context, prefix string) (int, error)
+
+	// ForgetTag forgets all keys associated with tag (eg. sqlcache.Index.Invalidate).
+	ForgetTag func(ctx context.Context, tag string) error
+}
+
+// Handler is an http.Handler that exposes a set of named caches.
+// It is safe for concurrent use.
+type Handler struct {
+	cfg   Config
+	clock remember.Clock
+
+	mu     sync.RWMutex
+	caches map[string]Cache
+}
+
+// NewHandler creates a Handler. Caches must be registered using Register.
+func NewHandler(cfg ...Config) *Handler {
+	var conf Config
+	if len(cfg) > 0 {
+		conf = cfg[0]
+	}
+	if conf.PreviewLen <= 0 {
+		conf.PreviewLen = DefaultPreviewLen
+	}
+
+	return &Handler{
+		cfg:    conf,
+		clock:  remember.ClockOrDefault(conf.Clock),
+		caches: map[string]Cache{},
+	}
+}
+
+// Register exposes c using name. It panics if name is empty, contains "/" or
+// is already registered.
+func (h *Handler) Register(name string, c Cache) {
+	if name == "" || strings.Contains(name, "/") {
+		panic(fmt.Sprintf("admin: invalid cache name: %q", name))
+	}
+	if c.Conner == nil {
+		panic("admin: nil Conner for cache " + name)
+	}
+
+	if c.Stats == nil {
+		c.Stats = statsMethod(c.Conner)
+	}
+	if t, ok := c.Conner.(TTLer); ok && c.TTL == nil {
+		c.TTL = t.TTL
+	}
+	if p, ok := c.Conner.(PrefixForgetter); ok && c.ForgetPrefix == nil {
+		c.ForgetPrefix = p.ForgetPrefix
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, found := h.caches[name]; found {
+		panic("admin: cache already registered: " + name)
+	}
+	h.caches[name] = c
+}
+
+// statsMethod returns a function that calls c's Stats method (if it has a suitable one).
+func statsMethod(c remember.Conner) func() interface{} {
+	m := reflect.ValueOf(c).MethodByName("Stats")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	return func() interface{} {
+		return m.Call(nil)[0].Interface()
+	}
+}
+
+// httpError is an error with an HTTP status code.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func (e *httpError) Unwrap() error { return e.err }
+
+func newError(status int, format string, args ...interface{}) error {
+	return &httpError{status, fmt.Errorf(format, args...)}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.serve(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var he *httpError
+		if errors.As(err, &he) {
+			status = he.status
+		} else if errors.Is(err, ErrUnsupported) {
+			status = http.StatusNotImplemented
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) serve(r *http.Request) (interface{}, error) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			return nil, newError(http.StatusMethodNotAllowed, "method not allowed")
+		}
+		if err := h.authorize(r, Action{Op: List}); err != nil {
+			return nil, err
+		}
+		return h.list(), nil
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		return nil, newError(http.StatusNotFound, "not found")
+	}
+
+	h.mu.RLock()
+	c, found := h.caches[parts[0]]
+	h.mu.RUnlock()
+	if !found {
+		return nil, newError(http.StatusNotFound, "unknown cache: %q", parts[0])
+	}
+
+	a, err := action(r, parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.Op.Destructive() {
+		if err := h.authorize(r, a); err != nil {
+			return nil, err
+		}
+		if a.Op == Stats {
+			return h.stats(c)
+		}
+		return h.lookup(r.Context(), c, a.Target)
+	}
+
+	e := AuditEvent{Action: a, Request: r}
+	if err := h.authorizeDestructive(r, a); err != nil {
+		e.Denied = true
+		e.Err = err
+		h.audit(e)
+		return nil, err
+	}
+
+	e.Forgotten, e.Err = h.forget(r.Context(), c, a)
+	h.audit(e)
+	if e.Err != nil {
+		return nil, e.Err
+	}
+
+	if a.Op == ForgetPrefix {
+		return map[string]int{"forgotten": e.Forgotten}, nil
+	}
+	return map[string]bool{"ok": true}, nil
+}
+
+// action determines the action requested for the cache named name.
+func action(r *http.Request, name, endpoint string) (Action, error) {
+	a := Action{Cache: name}
+
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	write := r.Method == http.MethodPost || r.Method == http.MethodDelete
+
+	var param string
+	switch {
+	case endpoint == "stats" && read:
+		a.Op = Stats
+	case endpoint == "key" && read:
+		a.Op, param = Lookup, "key"
+	case endpoint == "key" && write:
+		a.Op, param = Forget, "key"
+	case endpoint == "prefix" && write:
+		a.Op, param = ForgetPrefix, "prefix"
+	case endpoint == "tag" && write:
+		a.Op, param = ForgetTag, "tag"
+	case endpoint == "all" && write:
+		a.Op = ForgetAll
+	case endpoint == "stats" || endpoint == "key" || endpoint == "prefix" || endpoint == "tag" || endpoint == "all":
+		return a, newError(http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		return a, newError(http.StatusNotFound, "not found")
+	}
+
+	if param != "" {
+		a.Target = r.URL.Query().Get(param)
+		if a.Target == "" {
+			return a, newError(http.StatusBadRequest, "%s is required", param)
+		}
+	}
+	return a, nil
+}
+
+func (h *Handler) authorize(r *http.Request, a Action) error {
+	if h.cfg.Authorize == nil {
+		if h.cfg.AllowUnauthenticatedReads && !a.Op.Destructive() {
+			return nil
+		}
+		return newError(http.StatusForbidden, "actions are not permitted without Config.Authorize")
+	}
+	if err := h.cfg.Authorize(r, a); err != nil {
+		return &httpError{http.StatusForbidden, err}
+	}
+	return nil
+}
+
+// authorizeDestructive authorizes an action that removes data.
+func (h *Handler) authorizeDestructive(r *http.Request, a Action) error {
+	if r.Header.Get(RequestHeader) == "" {
+		return newError(http.StatusForbidden, "%s header is required", RequestHeader)
+	}
+	return h.authorize(r, a)
+}
+
+func (h *Handler) audit(e AuditEvent) {
+	if h.cfg.Audit == nil {
+		return
+	}
+	e.Time = h.clock.Now()
+	h.cfg.Audit(e)
+}
+
+// cacheInfo describes a cache and its capabilities.
+type cacheInfo struct {
+	Name         string `json:"name"`
+	Stats        bool   `json:"stats"`
+	TTL          bool   `json:"ttl"`
+	ForgetPrefix bool   `json:"forget_prefix"`
+	ForgetTag    bool   `json:"forget_tag"`
+}
+
+func (h *Handler) list() map[string][]cacheInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := []cacheInfo{}
+	for name, c := range h.caches {
+		out = append(out, cacheInfo{
+			Name:         name,
+			Stats:        c.Stats != nil,
+			TTL:          c.TTL != nil,
+			ForgetPrefix: c.ForgetPrefix != nil,
+			ForgetTag:    c.ForgetTag != nil,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return map[string][]cacheInfo{"caches": out}
+}
+
+func (h *Handler) stats(c Cache) (interface{}, error) {
+	if c.Stats == nil {
+		return nil, fmt.Errorf("stats: %w", ErrUnsupported)
+	}
+	return c.Stats(), nil
+}
+
+// lookupResult is the response of a key lookup.
+type lookupResult struct {
+	Key   string `json:"key"`
+	Found bool   `json:"found"`
+
+	// TTL is the remaining time to live (eg. "1h0m0s" or "no expiration").
+	// It is empty if the cache can not report it.
+	TTL string `json:"ttl,omitempty"`
+
+	Type      string `json:"type,omitempty"`
+	Preview   string `json:"preview,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+
+	// Error is set if the value could not be decoded (eg. the type is not registered with gob).
+	Error string `json:"error,omitempty"`
+}
+
+func (h *Handler) lookup(ctx context.Context, c Cache, key string) (interface{}, error) {
+	cache, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cache.Close()
+
+	res := lookupResult{Key: key}
+
+	item, found, err := cache.Get(key)
+	if err != nil && !found {
+		return nil, err
+	}
+	if err == nil && remember.IsLock(item) {
+		// SafeSet placeholder
+		found = false
+	}
+	res.Found = found
+	if !found {
+		return res, nil
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Type = fmt.Sprintf("%T", item)
+		res.Preview, res.Truncated = preview(item, h.cfg.PreviewLen)
+	}
+
+	if c.TTL != nil {
+		ttl, found, err := c.TTL(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if ttl < 0 {
+				res.TTL = "no expiration"
+			} else {
+				res.TTL = ttl.String()
+			}
+		}
+	}
+	return res, nil
+}
+
+// preview returns item encoded as JSON (or Go syntax if it can not be encoded),
+// truncated to at most max bytes.
+func preview(item interface{}, max int) (string, bool) {
+	var s string
+	if b, err := json.Marshal(item); err == nil {
+		s = string(b)
+	} else {
+		s = fmt.Sprintf("%#v", item)
+	}
+
+	if len(s) <= max {
+		return s, false
+	}
+
+	// Don't split a multi-byte character
+	s = s[:max]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s, true
+}
+
+func (h *Handler) forget(ctx context.Context, c Cache, a Action) (int, error) {
+	switch a.Op {
+	case ForgetPrefix:
+		if c.ForgetPrefix == nil {
+			return 0, fmt.Errorf("forget prefix: %w", ErrUnsupported)
+		}
+		return c.ForgetPrefix(ctx, a.Target)
+	case ForgetTag:
+		if c.ForgetTag == nil {
+			return 0, fmt.Errorf("forget tag: %w", ErrUnsupported)
+		}
+		return 0, c.ForgetTag(ctx, a.Target)
+	}
+
+	cache, err := c.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer cache.Close()
+
+	if a.Op == ForgetAll {
+		return 0, cache.ForgetAll()
+	}
+	return 0, cache.Forget(a.Target)
+}
+
+// LogAudit returns an audit function (see Config.Audit) that logs events using l.
+func LogAudit(l remember.Logger) func(e AuditEvent) {
+	return func(e AuditEvent) {
+		var result string
+		switch {
+		case e.Denied:
+			result = "denied: " + e.Err.Error()
+		case e.Err != nil:
+			result = "failed: " + e.Err.Error()
+		case e.Action.Op == ForgetPrefix:
+			result = fmt.Sprintf("ok (%d keys)", e.Forgotten)
+		default:
+			result = "ok"
+		}
+
+		var remote string
+		if e.Request != nil {
+			remote = e.Request.RemoteAddr
+		}
+
+		l.Log("admin: %s %s cache=%q target=%q remote=%s: %s", e.Time.Format(time.RFC3339), e.Action.Op, e.Action.Cache, e.Action.Target, remote, result)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,298 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/admin"
+	"github.com/rocketlaunchr/remember-go/memory"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+type auditLog struct {
+	mu     sync.Mutex
+	events []admin.AuditEvent
+}
+
+func (l *auditLog) audit(e admin.AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func do(t *testing.T, h http.Handler, method, target string, header ...string) (int, map[string]interface{}) {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%s %s: invalid response: %q", method, target, w.Body.String())
+	}
+	return w.Code, out
+}
+
+// allow permits all actions.
+func allow(r *http.Request, a admin.Action) error { return nil }
+
+func newHandler(t *testing.T, cfg admin.Config) (*admin.Handler, *memory.BoundedMemoryStore, *remembertest.Mock) {
+	bs := memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 100})
+	bs.Set("user:1", time.Hour, map[string]string{"name": "a"})
+	bs.Set("user:2", memory.NoExpiration, strings.Repeat("x", 100))
+	bs.Set("other", time.Hour, 42)
+
+	m := remembertest.NewMock()
+	m.Set("key", remembertest.NoExpiration, "val")
+
+	h := admin.NewHandler(cfg)
+	h.Register("bounded", admin.Cache{Conner: bs})
+	h.Register("mock", admin.Cache{Conner: m})
+	return h, bs, m
+}
+
+func TestList(t *testing.T) {
+	h, _, _ := newHandler(t, admin.Config{Authorize: allow})
+
+	status, out := do(t, h, "GET", "/")
+	if status != http.StatusOK {
+		t.Fatalf("wrong status: expected: %v actual: %v", http.StatusOK, status)
+	}
+
+	b, _ := json.Marshal(out["caches"])
+	expected := `[{"forget_prefix":true,"forget_tag":false,"name":"bounded","stats":true,"ttl":true},{"forget_prefix":false,"forget_tag":false,"name":"mock","stats":false,"ttl":false}]`
+	if string(b) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, string(b))
+	}
+}
+
+func TestStats(t *testing.T) {
+	h, _, _ := newHandler(t, admin.Config{Authorize: allow})
+
+	status, out := do(t, h, "GET", "/bounded/stats")
+	if status != http.StatusOK || out["Entries"] != 3.0 {
+		t.Errorf("wrong stats: %v %v", status, out)
+	}
+
+	status, _ = do(t, h, "GET", "/mock/stats")
+	if status != http.StatusNotImplemented {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusNotImplemented, status)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	h, _, _ := newHandler(t, admin.Config{Authorize: allow, PreviewLen: 10})
+
+	_, out := do(t, h, "GET", "/bounded/key?key=user:1")
+	if out["found"] != true || out["type"] != "map[string]string" || out["preview"] != `{"name":"a` || out["truncated"] != true {
+		t.Errorf("wrong lookup: %v", out)
+	}
+	if ttl, _ := time.ParseDuration(out["ttl"].(string)); ttl <= 59*time.Minute {
+		t.Errorf("wrong ttl: %v", out["ttl"])
+	}
+
+	_, out = do(t, h, "GET", "/bounded/key?key=other")
+	if out["preview"] != "42" || out["truncated"] != nil {
+		t.Errorf("wrong lookup: %v", out)
+	}
+
+	_, out = do(t, h, "GET", "/bounded/key?key=user:2")
+	if out["ttl"] != "no expiration" {
+		t.Errorf("wrong ttl: expected: %v actual: %v", "no expiration", out["ttl"])
+	}
+
+	_, out = do(t, h, "GET", "/bounded/key?key=missing")
+	if out["found"] != false {
+		t.Errorf("wrong found: expected: %v actual: %v", false, out["found"])
+	}
+
+	// TTL is not supported
+	_, out = do(t, h, "GET", "/mock/key?key=key")
+	if out["found"] != true || out["ttl"] != nil {
+		t.Errorf("wrong lookup: %v", out)
+	}
+
+	for target, expected := range map[string]int{
+		"/bounded/key":      http.StatusBadRequest,
+		"/missing/key?key=": http.StatusNotFound,
+		"/bounded/unknown":  http.StatusNotFound,
+		"/bounded":          http.StatusNotFound,
+	} {
+		if status, _ := do(t, h, "GET", target); status != expected {
+			t.Errorf("wrong status for %s: expected: %v actual: %v", target, expected, status)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var log auditLog
+	h, bs, m := newHandler(t, admin.Config{Authorize: allow, Audit: log.audit})
+
+	if status, _ := do(t, h, "DELETE", "/bounded/key?key=other", admin.RequestHeader, "1"); status != http.StatusOK {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusOK, status)
+	}
+	if _, found, _ := bs.Get("other"); found {
+		t.Errorf("expected key to be forgotten")
+	}
+
+	_, out := do(t, h, "POST", "/bounded/prefix?prefix=user:", admin.RequestHeader, "1")
+	if out["forgotten"] != 2.0 {
+		t.Errorf("wrong forgotten: expected: %v actual: %v", 2, out["forgotten"])
+	}
+
+	if status, _ := do(t, h, "POST", "/mock/prefix?prefix=k", admin.RequestHeader, "1"); status != http.StatusNotImplemented {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusNotImplemented, status)
+	}
+
+	do(t, h, "POST", "/mock/all", admin.RequestHeader, "1")
+	m.AssertCalls(t, remembertest.ForgetAll, "", 1)
+
+	if status, _ := do(t, h, "GET", "/mock/all"); status != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusMethodNotAllowed, status)
+	}
+
+	var ops []string
+	for _, e := range log.events {
+		ops = append(ops, string(e.Action.Op)+":"+e.Action.Cache+":"+e.Action.Target)
+	}
+	expected := "forget:bounded:other,forget-prefix:bounded:user:,forget-prefix:mock:k,forget-all:mock:"
+	if strings.Join(ops, ",") != expected {
+		t.Errorf("wrong audit: expected: %v actual: %v", expected, ops)
+	}
+	if log.events[1].Forgotten != 2 || !errors.Is(log.events[2].Err, admin.ErrUnsupported) {
+		t.Errorf("wrong audit: %+v", log.events)
+	}
+}
+
+func TestForgetTag(t *testing.T) {
+	var tags []string
+
+	h := admin.NewHandler(admin.Config{Authorize: allow})
+	h.Register("queries", admin.Cache{
+		Conner: remembertest.NewMock(),
+		ForgetTag: func(ctx context.Context, tag string) error {
+			tags = append(tags, tag)
+			return nil
+		},
+	})
+
+	do(t, h, "POST", "/queries/tag?tag=users", admin.RequestHeader, "1")
+	if len(tags) != 1 || tags[0] != "users" {
+		t.Errorf("wrong val: expected: %v actual: %v", []string{"users"}, tags)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	var log auditLog
+	h, bs, _ := newHandler(t, admin.Config{
+		Authorize: func(r *http.Request, a admin.Action) error {
+			if a.Op.Destructive() && r.Header.Get("X-Role") != "ops" {
+				return errors.New("ops role required")
+			}
+			return nil
+		},
+		Audit: log.audit,
+		Clock: remembertest.NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+	})
+
+	// Reads are permitted
+	if status, _ := do(t, h, "GET", "/bounded/key?key=other"); status != http.StatusOK {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusOK, status)
+	}
+
+	status, out := do(t, h, "DELETE", "/bounded/key?key=other", admin.RequestHeader, "1")
+	if status != http.StatusForbidden || out["error"] != "ops role required" {
+		t.Errorf("wrong response: %v %v", status, out)
+	}
+	if _, found, _ := bs.Get("other"); !found {
+		t.Errorf("expected key not to be forgotten")
+	}
+
+	do(t, h, "DELETE", "/bounded/key?key=other", "X-Role", "ops", admin.RequestHeader, "1")
+	if _, found, _ := bs.Get("other"); found {
+		t.Errorf("expected key to be forgotten")
+	}
+
+	if len(log.events) != 2 || !log.events[0].Denied || log.events[1].Denied || log.events[1].Err != nil {
+		t.Fatalf("wrong audit: %+v", log.events)
+	}
+
+	var logged []string
+	admin.LogAudit(loggerFunc(func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}))(log.events[0])
+
+	expected := `admin: 2021-01-01T00:00:00Z forget cache="bounded" target="other" remote=192.0.2.1:1234: denied: ops role required`
+	if len(logged) != 1 || logged[0] != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, logged)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	// Without Authorize, all actions are rejected
+	h, _, _ := newHandler(t, admin.Config{})
+
+	for _, target := range []string{"/", "/bounded/stats", "/bounded/key?key=other"} {
+		if status, _ := do(t, h, "GET", target); status != http.StatusForbidden {
+			t.Errorf("%s: wrong status: expected: %v actual: %v", target, http.StatusForbidden, status)
+		}
+	}
+
+	// Unless reads are explicitly permitted
+	h, bs, m := newHandler(t, admin.Config{AllowUnauthenticatedReads: true})
+
+	if status, _ := do(t, h, "GET", "/bounded/key?key=other"); status != http.StatusOK {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusOK, status)
+	}
+	if status, _ := do(t, h, "POST", "/mock/all", admin.RequestHeader, "1"); status != http.StatusForbidden {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusForbidden, status)
+	}
+	m.AssertCalls(t, remembertest.ForgetAll, "", 0)
+
+	// Requests without the header (eg. cross-site form posts) are rejected
+	h, bs, _ = newHandler(t, admin.Config{Authorize: allow})
+
+	if status, _ := do(t, h, "POST", "/bounded/key?key=other"); status != http.StatusForbidden {
+		t.Errorf("wrong status: expected: %v actual: %v", http.StatusForbidden, status)
+	}
+	if _, found, _ := bs.Get("other"); !found {
+		t.Errorf("expected key not to be forgotten")
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	h := admin.NewHandler()
+	h.Register("a", admin.Cache{Conner: remembertest.NewMock()})
+
+	for _, name := range []string{"", "a/b", "a"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for %q", name)
+				}
+			}()
+			h.Register(name, admin.Cache{Conner: remembertest.NewMock()})
+		}()
+	}
+}
+
+type loggerFunc func(format string, args ...interface{})
+
+func (f loggerFunc) Log(format string, args ...interface{}) { f(format, args...) }
+
+var _ remember.Logger = loggerFunc(nil)
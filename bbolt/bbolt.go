@@ -0,0 +1,286 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package bbolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"go.etcd.io/bbolt"
+)
+
+// NoExpiration is used to indicate that data should not expire from the cache.
+const NoExpiration time.Duration = -1
+
+// DefaultBucket is the bucket used when Config.Bucket is not set.
+const DefaultBucket = "remember"
+
+// ErrCorrupt signifies that a stored value could not be parsed.
+var ErrCorrupt = errors.New("corrupt cache entry")
+
+// Config is used to configure a BboltStore.
+type Config struct {
+
+	// Bucket is the name of the bucket that entries are stored in.
+	// If not set, DefaultBucket is used.
+	Bucket string
+
+	// CleanupInterval is how often expired entries are deleted.
+	// 0 means expired entries are never deleted (but are not returned by Get).
+	CleanupInterval time.Duration
+}
+
+// BboltStore is used to create a cache that persists to a single file
+// using bbolt. It is suitable for caches that are larger than memory.
+//
+// See: https://pkg.go.dev/go.etcd.io/bbolt
+type BboltStore struct {
+	DB     *bbolt.DB
+	Bucket []byte
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewBboltStore creates a cache that persists to the file at path.
+// The file is created if it does not exist.
+func NewBboltStore(path string, cfg ...Config) (*BboltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := NewBboltStoreFrom(db, cfg...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return bs, nil
+}
+
+// NewBboltStoreFrom creates a cache directly from a *bbolt.DB object.
+func NewBboltStoreFrom(db *bbolt.DB, cfg ...Config) (*BboltStore, error) {
+
+	var c Config
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Bucket == "" {
+		c.Bucket = DefaultBucket
+	}
+
+	bs := &BboltStore{
+		DB:     db,
+		Bucket: []byte(c.Bucket),
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bs.Bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.CleanupInterval > 0 {
+		bs.stop = make(chan struct{})
+		go bs.janitor(c.CleanupInterval, bs.stop)
+	}
+
+	return bs, nil
+}
+
+// Conn does nothing for this storage driver.
+func (c *BboltStore) Conn(ctx context.Context) (remember.Cacher, error) {
+	return c, nil
+}
+
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *BboltStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// StorePointer sets whether a storage driver requires itemToStore to be
+// stored as a pointer or as a concrete value.
+func (c *BboltStore) StorePointer() bool {
+	return true
+}
+
+// Get returns a value from the cache if the key exists.
+func (c *BboltStore) Get(key string) (_ interface{}, found bool, _ error) {
+
+	var val []byte
+
+	err := c.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(c.Bucket)
+		if b == nil {
+			return nil
+		}
+
+		v := b.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+
+		expires, data, err := decodeEntry(v)
+		if err != nil {
+			return err
+		}
+		if expired(expires, time.Now()) {
+			return nil
+		}
+
+		// v is only valid during the transaction
+		val = append([]byte(nil), data...)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if val == nil {
+		return nil, false, nil
+	}
+
+	var output interface{}
+
+	err = gob.NewDecoder(bytes.NewBuffer(val)).Decode(&output)
+	if err != nil {
+		return nil, true, err // Could not decode cached data
+	}
+
+	return output, true, nil
+}
+
+// Set sets a item into the cache for a particular key.
+func (c *BboltStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+
+	// Convert item to bytes
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(itemToStore)
+	if err != nil {
+		return err
+	}
+
+	var expires int64
+	if expiration > 0 {
+		expires = time.Now().Add(expiration).UnixNano()
+	}
+
+	v := encodeEntry(expires, b.Bytes())
+
+	return c.DB.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(c.Bucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), v)
+	})
+}
+
+// Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing. The underlying DB must be closed separately.
+func (c *BboltStore) Close() {}
+
+// Forget clears the value from the cache for the particular key.
+func (c *BboltStore) Forget(key string) error {
+	return c.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(c.Bucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// ForgetAll clears all values from the cache by dropping the bucket.
+// Other buckets in the same file are not affected.
+func (c *BboltStore) ForgetAll() error {
+	return c.DB.Update(func(tx *bbolt.Tx) error {
+		err := tx.DeleteBucket(c.Bucket)
+		if err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		_, err = tx.CreateBucket(c.Bucket)
+		return err
+	})
+}
+
+// DeleteExpired deletes all expired entries.
+func (c *BboltStore) DeleteExpired() error {
+	now := time.Now()
+
+	return c.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(c.Bucket)
+		if b == nil {
+			return nil
+		}
+
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil; {
+			expires, _, err := decodeEntry(v)
+			if err == nil && !expired(expires, now) {
+				k, v = cur.Next()
+				continue
+			}
+
+			// Expired or corrupt
+			k = append([]byte(nil), k...)
+			if err := cur.Delete(); err != nil {
+				return err
+			}
+			k, v = cur.Seek(k)
+		}
+		return nil
+	})
+}
+
+// StopCleanup stops the background deletion of expired entries.
+func (c *BboltStore) StopCleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *BboltStore) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func expired(expires int64, now time.Time) bool {
+	return expires > 0 && now.UnixNano() >= expires
+}
+
+// encodeEntry prepends the expiration (UnixNano, 0 means no expiration) to val.
+func encodeEntry(expires int64, val []byte) []byte {
+	b := make([]byte, 8+len(val))
+	binary.BigEndian.PutUint64(b, uint64(expires))
+	copy(b[8:], val)
+	return b
+}
+
+func decodeEntry(b []byte) (expires int64, val []byte, _ error) {
+	if len(b) < 8 {
+		return 0, nil, ErrCorrupt
+	}
+	return int64(binary.BigEndian.Uint64(b)), b[8:], nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package bbolt_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/bbolt"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ctx = context.Background()
+
+func newStore(t *testing.T, cfg ...bbolt.Config) (*bbolt.BboltStore, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "remember-bbolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := bbolt.NewBboltStore(filepath.Join(dir, "cache.db"), cfg...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bs, func() {
+		bs.StopCleanup()
+		bs.DB.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func set(t *testing.T, bs *bbolt.BboltStore, key string, exp time.Duration, val interface{}) {
+	t.Helper()
+
+	if err := bs.Set(key, exp, &val); err != nil {
+		t.Fatalf("set %q: %v", key, err)
+	}
+}
+
+func TestKeyBasicOperation(t *testing.T) {
+	bs, cleanup := newStore(t)
+	defer cleanup()
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	actual, _, _ := remember.Cache(ctx, bs, key, exp, slowQuery)
+
+	expected := "val"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestFetchFromCacheAndDisableCache(t *testing.T) {
+	bs, cleanup := newStore(t)
+	defer cleanup()
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	// warm up cache
+	remember.Cache(ctx, bs, key, exp, slowQuery)
+
+	// This time fetch from cache
+	actual, found, _ := remember.Cache(ctx, bs, key, exp, slowQuery)
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Actual is now "val", Let's change it to "val2" and disable cache usage.
+
+	slowQuery = func(ctx context.Context) (interface{}, error) {
+		return "val2", nil
+	}
+
+	actual, _, _ = remember.Cache(ctx, bs, key, exp, slowQuery, remember.Options{DisableCacheUsage: true})
+
+	expected = "val2"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remember-bbolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cache.db")
+
+	bs, err := bbolt.NewBboltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(t, bs, "key", bbolt.NoExpiration, "val")
+	bs.DB.Close()
+
+	// Simulate a process restart
+	bs, err = bbolt.NewBboltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.DB.Close()
+
+	assertFound(t, bs, "key", true)
+}
+
+func TestExpiration(t *testing.T) {
+	bs, cleanup := newStore(t)
+	defer cleanup()
+
+	for i := 0; i < 100; i++ {
+		set(t, bs, fmt.Sprintf("short-%d", i), 10*time.Millisecond, i)
+	}
+	set(t, bs, "forever", bbolt.NoExpiration, "val")
+
+	time.Sleep(20 * time.Millisecond)
+
+	assertFound(t, bs, "short-0", false)
+	assertFound(t, bs, "forever", true)
+
+	if err := bs.DeleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countEntries(t, bs); n != 1 {
+		t.Errorf("wrong number of entries: expected: %v actual: %v", 1, n)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	bs, cleanup := newStore(t, bbolt.Config{CleanupInterval: 10 * time.Millisecond})
+	defer cleanup()
+
+	set(t, bs, "short", 10*time.Millisecond, "val")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := countEntries(t, bs); n != 0 {
+		t.Errorf("wrong number of entries: expected: %v actual: %v", 0, n)
+	}
+}
+
+func TestForget(t *testing.T) {
+	bs, cleanup := newStore(t)
+	defer cleanup()
+
+	// Another bucket in the same file
+	err := bs.DB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("other"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("key"), []byte("val"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set(t, bs, "a", bbolt.NoExpiration, 1)
+	set(t, bs, "b", bbolt.NoExpiration, 2)
+
+	if err := bs.Forget("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, bs, "a", false)
+	assertFound(t, bs, "b", true)
+
+	if err := bs.ForgetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, bs, "b", false)
+
+	err = bs.DB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("other")).Get([]byte("key")) == nil {
+			t.Errorf("other bucket was cleared")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store is still usable after ForgetAll
+	set(t, bs, "c", bbolt.NoExpiration, 3)
+	assertFound(t, bs, "c", true)
+}
+
+func assertFound(t *testing.T, bs *bbolt.BboltStore, key string, expected bool) {
+	t.Helper()
+
+	_, found, err := bs.Get(key)
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if found != expected {
+		t.Errorf("wrong found for %q: expected: %v actual: %v", key, expected, found)
+	}
+}
+
+func countEntries(t *testing.T, bs *bbolt.BboltStore) int {
+	t.Helper()
+
+	var n int
+	err := bs.DB.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bs.Bucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,21 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package bbolt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/bbolt"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+)
+
+func TestConformance(t *testing.T) {
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		return newStore(t)
+	}, cachertest.Config{
+		NoExpiration: bbolt.NoExpiration,
+		Expiration:   50 * time.Millisecond,
+	})
+}
@@ -0,0 +1,324 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package benchmark compares the performance of storage drivers and encodings.
+//
+// The benchmarks can be run using "go test -bench . ./benchmark" or by using
+// Run to generate a Report (see cmd/remember-bench).
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rist "github.com/dgraph-io/ristretto"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/ristretto"
+)
+
+// Sizes are the approximate payload sizes (in bytes) that are benchmarked.
+var Sizes = []int{64, 1 << 10, 16 << 10, 256 << 10}
+
+// seed is used to generate payloads so that every run stores the same data.
+const seed = 1
+
+// parallelKeys is the number of keys shared by the goroutines of the parallel benchmarks.
+const parallelKeys = 1024
+
+// Payload is the value stored by the benchmarks.
+type Payload struct {
+	ID    int64
+	Title string
+	Tags  []string
+	Data  []byte
+}
+
+func init() {
+	gob.Register(Payload{})
+}
+
+// NewPayload returns a deterministic Payload of approximately size bytes.
+func NewPayload(size int) Payload {
+	r := rand.New(rand.NewSource(seed))
+
+	p := Payload{
+		ID:    r.Int63(),
+		Title: "remember-go benchmark payload",
+		Tags:  []string{"alpha", "beta", "gamma"},
+	}
+
+	n := size - len(p.Title) - 32
+	if n < 0 {
+		n = 0
+	}
+	p.Data = make([]byte, n)
+	r.Read(p.Data)
+	return p
+}
+
+// Driver creates a storage driver to benchmark.
+type Driver struct {
+	Name string
+
+	// New creates an empty storage driver. close releases its resources.
+	New func() (c remember.Conner, close func(), err error)
+}
+
+// Drivers returns the storage drivers that are benchmarked.
+// The redis driver uses an in-process miniredis server.
+func Drivers() []Driver {
+	return []Driver{
+		{"memory", func() (remember.Conner, func(), error) {
+			return memory.NewMemoryStore(10 * time.Minute), func() {}, nil
+		}},
+		{"bounded", func() (remember.Conner, func(), error) {
+			ms := memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 100000})
+			return ms, func() {}, nil
+		}},
+		{"ristretto", func() (remember.Conner, func(), error) {
+			rs := ristretto.NewRistrettoStore(&rist.Config{
+				NumCounters: 1e6,
+				MaxCost:     1 << 30,
+				BufferItems: 64,
+			})
+			return rs, rs.Cache.Close, nil
+		}},
+		{"redis", func() (remember.Conner, func(), error) {
+			s, err := miniredis.Run()
+			if err != nil {
+				return nil, nil, err
+			}
+			pool := &redis.Pool{
+				MaxIdle: 64,
+				Dial: func() (redis.Conn, error) {
+					return redis.Dial("tcp", s.Addr())
+				},
+			}
+			return red.NewRedisStore(pool), func() {
+				pool.Close()
+				s.Close()
+			}, nil
+		}},
+	}
+}
+
+// Codec encodes and decodes values.
+type Codec struct {
+	Name   string
+	Encode func(v interface{}) ([]byte, error)
+	Decode func(b []byte) (interface{}, error)
+}
+
+// Codecs returns the encodings that are benchmarked.
+// "gob" is the encoding used by the redis, memcached, disk, bbolt and sql drivers.
+func Codecs() []Codec {
+	return []Codec{
+		{
+			Name: "gob",
+			Encode: func(v interface{}) ([]byte, error) {
+				b := new(bytes.Buffer)
+				err := gob.NewEncoder(b).Encode(&v)
+				return b.Bytes(), err
+			},
+			Decode: func(b []byte) (interface{}, error) {
+				var out interface{}
+				err := gob.NewDecoder(bytes.NewReader(b)).Decode(&out)
+				return out, err
+			},
+		},
+		{
+			Name: "json",
+			Encode: func(v interface{}) ([]byte, error) {
+				return json.Marshal(v)
+			},
+			Decode: func(b []byte) (interface{}, error) {
+				var out Payload
+				err := json.Unmarshal(b, &out)
+				return out, err
+			},
+		},
+	}
+}
+
+// Benchmark is a named benchmark.
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Benchmarks returns all the benchmarks in a deterministic order.
+//
+// For each driver and payload size:
+//
+//	Cache/Hit:         remember.Cache finds the key.
+//	Cache/Miss:        remember.Cache does not find the key (the key is forgotten beforehand).
+//	Cache/HitParallel: remember.Cache finds the key from multiple goroutines.
+//
+// For each codec and payload size:
+//
+//	Codec: The payload is encoded and decoded.
+func Benchmarks() []Benchmark {
+	var out []Benchmark
+
+	for _, d := range Drivers() {
+		for _, size := range Sizes {
+			d, size := d, size
+			suffix := "/" + d.Name + "/" + SizeName(size)
+			out = append(out,
+				Benchmark{"Cache/Hit" + suffix, func(b *testing.B) { benchmarkHit(b, d, size) }},
+				Benchmark{"Cache/Miss" + suffix, func(b *testing.B) { benchmarkMiss(b, d, size) }},
+				Benchmark{"Cache/HitParallel" + suffix, func(b *testing.B) { benchmarkHitParallel(b, d, size) }},
+			)
+		}
+	}
+
+	for _, c := range Codecs() {
+		for _, size := range Sizes {
+			c, size := c, size
+			out = append(out, Benchmark{"Codec/" + c.Name + "/" + SizeName(size), func(b *testing.B) { benchmarkCodec(b, c, size) }})
+		}
+	}
+
+	return out
+}
+
+// SizeName returns a human readable version of size.
+func SizeName(size int) string {
+	if size >= 1<<10 && size%(1<<10) == 0 {
+		return strconv.Itoa(size>>10) + "KB"
+	}
+	return strconv.Itoa(size) + "B"
+}
+
+// newDriver creates the storage driver or fails the benchmark.
+func newDriver(b *testing.B, d Driver) (remember.Conner, func()) {
+	c, close, err := d.New()
+	if err != nil {
+		b.Fatalf("could not create %s: %v", d.Name, err)
+	}
+	return c, close
+}
+
+// slowRetrieve returns a SlowRetrieve function that returns p.
+func slowRetrieve(p Payload) remember.SlowRetrieve {
+	return func(ctx context.Context) (interface{}, error) {
+		return p, nil
+	}
+}
+
+// warm stores p for keys (and waits for asynchronous storage drivers).
+func warm(b *testing.B, c remember.Conner, p Payload, keys ...string) {
+	ctx := context.Background()
+	for _, key := range keys {
+		if _, _, err := remember.Cache(ctx, c, key, time.Hour, slowRetrieve(p)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if rs, ok := c.(*ristretto.RistrettoStore); ok {
+		rs.Cache.Wait()
+	}
+}
+
+func benchmarkHit(b *testing.B, d Driver, size int) {
+	c, close := newDriver(b, d)
+	defer close()
+
+	ctx := context.Background()
+	p := NewPayload(size)
+	fn := slowRetrieve(p)
+	warm(b, c, p, "key")
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, found, err := remember.Cache(ctx, c, "key", time.Hour, fn)
+		if err != nil || !found {
+			b.Fatalf("expected hit: found: %v err: %v", found, err)
+		}
+	}
+}
+
+func benchmarkMiss(b *testing.B, d Driver, size int) {
+	c, close := newDriver(b, d)
+	defer close()
+
+	ctx := context.Background()
+	fn := slowRetrieve(NewPayload(size))
+
+	cache, err := c.Conn(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cache.Close()
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.Forget("key")
+		if _, _, err := remember.Cache(ctx, c, "key", time.Hour, fn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkHitParallel(b *testing.B, d Driver, size int) {
+	c, close := newDriver(b, d)
+	defer close()
+
+	p := NewPayload(size)
+	fn := slowRetrieve(p)
+
+	keys := make([]string, parallelKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	warm(b, c, p, keys...)
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		var i int
+		for pb.Next() {
+			if _, _, err := remember.Cache(ctx, c, keys[i%parallelKeys], time.Hour, fn); err != nil {
+				b.Error(err) // Fatal must not be called from the RunParallel goroutines
+				return
+			}
+			i++
+		}
+	})
+}
+
+func benchmarkCodec(b *testing.B, c Codec, size int) {
+	p := NewPayload(size)
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		enc, err := c.Encode(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := c.Decode(enc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package benchmark_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rocketlaunchr/remember-go/benchmark"
+)
+
+func BenchmarkRemember(b *testing.B) {
+	for _, bm := range benchmark.Benchmarks() {
+		b.Run(bm.Name, bm.F)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	r := benchmark.Run(regexp.MustCompile(`^(Codec/gob|Cache/Hit/memory)/64B$`), 1)
+	if len(r.Results) != 2 {
+		t.Fatalf("wrong number of results: expected: %v actual: %v", 2, len(r.Results))
+	}
+	for _, res := range r.Results {
+		if res.N == 0 || res.NsPerOp == 0 {
+			t.Errorf("empty result: %+v", res)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := benchmark.ReadReport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Results[0].Name != "Cache/Hit/memory/64B" {
+		t.Errorf("wrong val: expected: %v actual: %v", "Cache/Hit/memory/64B", r2.Results[0].Name)
+	}
+
+	buf.Reset()
+	if err := r.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "| Codec/gob/64B |") {
+		t.Errorf("missing result in markdown: %s", buf.String())
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := benchmark.Report{Results: []benchmark.Result{
+		{Name: "a", NsPerOp: 100, AllocsPerOp: 1},
+		{Name: "b", NsPerOp: 100, AllocsPerOp: 1},
+		{Name: "c", NsPerOp: 100, AllocsPerOp: 1},
+		{Name: "d", NsPerOp: 100, AllocsPerOp: 1},
+		{Name: "f", NsPerOp: 100, AllocsPerOp: 1},
+	}}
+	new := benchmark.Report{Results: []benchmark.Result{
+		{Name: "d", NsPerOp: 105, AllocsPerOp: 2}, // more allocations
+		{Name: "c", NsPerOp: 50, AllocsPerOp: 1},  // faster
+		{Name: "b", NsPerOp: 105, AllocsPerOp: 1}, // within threshold
+		{Name: "a", NsPerOp: 150, AllocsPerOp: 1}, // slower
+		{Name: "e", NsPerOp: 100, AllocsPerOp: 1}, // new
+		{Name: "f", NsPerOp: 101, AllocsPerOp: 0}, // fewer allocations (and noise)
+	}}
+
+	changes := benchmark.Compare(old, new, 0.1)
+
+	var names []string
+	for _, c := range changes {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "a,c,d,f" {
+		t.Fatalf("wrong val: expected: %v actual: %v", "a,c,d,f", names)
+	}
+
+	for i, expected := range []bool{true, false, true, false} {
+		if actual := changes[i].Regression(); actual != expected {
+			t.Errorf("wrong regression for %s: expected: %v actual: %v", changes[i].Name, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// Result is the outcome of a single benchmark.
+type Result struct {
+	Name        string  `json:"name"`
+	N           int     `json:"n"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	MBPerSec    float64 `json:"mb_per_sec"`
+}
+
+// Report contains the results of a benchmark run and the environment it was run in.
+// Reports can only be meaningfully compared when they were generated in the same environment.
+type Report struct {
+	GoVersion  string   `json:"go_version"`
+	GOOS       string   `json:"goos"`
+	GOARCH     string   `json:"goarch"`
+	NumCPU     int      `json:"num_cpu"`
+	GOMAXPROCS int      `json:"gomaxprocs"`
+	Results    []Result `json:"results"`
+}
+
+// Run runs the benchmarks whose names match filter (or all benchmarks if filter is nil).
+// Each benchmark is run count times and the fastest run is reported to reduce noise.
+func Run(filter *regexp.Regexp, count int) Report {
+	if count < 1 {
+		count = 1
+	}
+
+	r := Report{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+
+	for _, bm := range Benchmarks() {
+		if filter != nil && !filter.MatchString(bm.Name) {
+			continue
+		}
+
+		var best Result
+		for i := 0; i < count; i++ {
+			res := result(bm.Name, testing.Benchmark(bm.F))
+			if i == 0 || res.NsPerOp < best.NsPerOp {
+				best = res
+			}
+		}
+		r.Results = append(r.Results, best)
+	}
+	return r
+}
+
+func result(name string, br testing.BenchmarkResult) Result {
+	res := Result{
+		Name:        name,
+		N:           br.N,
+		BytesPerOp:  br.AllocedBytesPerOp(),
+		AllocsPerOp: br.AllocsPerOp(),
+	}
+	if br.N > 0 {
+		res.NsPerOp = float64(br.T.Nanoseconds()) / float64(br.N)
+		if br.Bytes > 0 && br.T > 0 {
+			res.MBPerSec = (float64(br.Bytes) * float64(br.N) / 1e6) / br.T.Seconds()
+		}
+	}
+	return res
+}
+
+// ReadReport reads a Report previously written by WriteJSON.
+func ReadReport(r io.Reader) (Report, error) {
+	var out Report
+	err := json.NewDecoder(r).Decode(&out)
+	return out, err
+}
+
+// WriteJSON writes the Report as JSON. Results are sorted by name so that
+// reports can be diffed.
+func (r Report) WriteJSON(w io.Writer) error {
+	r.sort()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the Report as a markdown table.
+func (r Report) WriteMarkdown(w io.Writer) error {
+	r.sort()
+
+	if _, err := fmt.Fprintf(w, "%s %s/%s (CPUs: %d, GOMAXPROCS: %d)\n\n", r.GoVersion, r.GOOS, r.GOARCH, r.NumCPU, r.GOMAXPROCS); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "| Benchmark | ns/op | MB/s | B/op | allocs/op |\n|---|---:|---:|---:|---:|"); err != nil {
+		return err
+	}
+	for _, res := range r.Results {
+		if _, err := fmt.Fprintf(w, "| %s | %.0f | %.2f | %d | %d |\n", res.Name, res.NsPerOp, res.MBPerSec, res.BytesPerOp, res.AllocsPerOp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Report) sort() {
+	results := make([]Result, len(r.Results))
+	copy(results, r.Results)
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	r.Results = results
+}
+
+// Change is a benchmark whose performance differs between two reports.
+type Change struct {
+	Name string
+	Old  Result
+	New  Result
+
+	// Delta is the relative change in ns/op (eg. 0.25 means 25% slower).
+	Delta float64
+
+	// Threshold is the threshold provided to Compare.
+	Threshold float64
+}
+
+// Regression reports whether the benchmark became slower (by more than Threshold)
+// or allocates more.
+func (c Change) Regression() bool {
+	return c.Delta > c.Threshold || c.New.AllocsPerOp > c.Old.AllocsPerOp
+}
+
+// Compare returns the benchmarks found in both reports whose ns/op changed by more than
+// threshold (eg. 0.1 for 10%) or whose allocs/op changed. Benchmarks are returned
+// in name order.
+func Compare(old, new Report, threshold float64) []Change {
+	prev := map[string]Result{}
+	for _, res := range old.Results {
+		prev[res.Name] = res
+	}
+
+	new.sort()
+
+	var out []Change
+	for _, res := range new.Results {
+		o, found := prev[res.Name]
+		if !found || o.NsPerOp == 0 {
+			continue
+		}
+
+		delta := (res.NsPerOp - o.NsPerOp) / o.NsPerOp
+		if delta > threshold || delta < -threshold || res.AllocsPerOp != o.AllocsPerOp {
+			out = append(out, Change{Name: res.Name, Old: o, New: res, Delta: delta, Threshold: threshold})
+		}
+	}
+	return out
+}
@@ -0,0 +1,501 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package cachertest provides a conformance test suite for storage drivers.
+//
+// Example:
+//
+//	func TestConformance(t *testing.T) {
+//		cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+//			return memory.NewMemoryStore(10 * time.Minute), nil
+//		}, cachertest.Config{NoExpiration: memory.NoExpiration})
+//	}
+package cachertest
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultExpiration is the shortest expiration used by the expiration tests
+// when Config.Expiration is not set.
+const DefaultExpiration = time.Second
+
+// Item is a struct that is stored by the test suite.
+// It is registered with the gob package.
+type Item struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func init() {
+	gob.Register(Item{})
+	gob.Register(map[string]int{})
+}
+
+// Config describes the behavior of the storage driver being tested.
+type Config struct {
+
+	// NoExpiration is the storage driver's NoExpiration value.
+	NoExpiration time.Duration
+
+	// Expiration is the shortest expiration used by the expiration tests.
+	// Storage drivers that only support whole seconds must use at least 1 second.
+	// If not set, DefaultExpiration is used.
+	Expiration time.Duration
+
+	// Advance moves the storage driver's clock forward by d.
+	// If not set, the test suite sleeps for d.
+	Advance func(c remember.Conner, d time.Duration)
+
+	// Wait is called after each Set for storage drivers that store items
+	// asynchronously (eg. ristretto).
+	Wait func(c remember.Conner)
+
+	// Lossy indicates that Set may drop items under contention (eg. ristretto).
+	// The concurrency test ignores Set errors and missing items.
+	Lossy bool
+
+	// NoStorage indicates that the storage driver never stores items (eg. nocache).
+	NoStorage bool
+
+	// Break causes the storage driver's operations to fail (eg. by stopping the
+	// server or closing the database). It is used to test how errors are reported.
+	// If not set, the DriverErrors test is skipped.
+	Break func(c remember.Conner)
+}
+
+// NewConner returns an empty cache. cleanup (if not nil) is called when the test completes.
+type NewConner func(t *testing.T) (c remember.Conner, cleanup func())
+
+// Run runs the test suite. newConner is called for every test.
+func Run(t *testing.T, newConner NewConner, cfg Config) {
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = DefaultExpiration
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s *suite)
+	}{
+		{"GetMissing", testGetMissing},
+		{"SetGet", testSetGet},
+		{"Overwrite", testOverwrite},
+		{"Forget", testForget},
+		{"ForgetAll", testForgetAll},
+		{"Expiration", testExpiration},
+		{"Cache", testCache},
+		{"SlowRetrieveError", testSlowRetrieveError},
+		{"CAS", testCAS},
+		{"Concurrency", testConcurrency},
+		{"DriverErrors", testDriverErrors},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, cleanup := newConner(t)
+			if cleanup != nil {
+				defer cleanup()
+			}
+
+			cache, err := c.Conn(context.Background())
+			if err != nil {
+				t.Fatalf("could not obtain connection: %v", err)
+			}
+			defer cache.Close()
+
+			tt.fn(t, &suite{cfg, c, cache})
+		})
+	}
+}
+
+// suite holds the state of a single test.
+type suite struct {
+	Config
+	conner remember.Conner
+	cache  remember.Cacher
+}
+
+// values are stored by the test suite.
+var values = []interface{}{
+	"val",
+	42,
+	3.5,
+	true,
+	[]string{"a", "b"},
+	map[string]int{"a": 1},
+	Item{Name: "item", Count: 2, Tags: []string{"x"}},
+}
+
+// set stores val in the form required by the storage driver.
+func (s *suite) set(t *testing.T, cache remember.Cacher, key string, exp time.Duration, val interface{}) error {
+	t.Helper()
+
+	var err error
+	if cache.StorePointer() {
+		err = cache.Set(key, exp, &val)
+	} else {
+		err = cache.Set(key, exp, val)
+	}
+	if s.Wait != nil {
+		s.Wait(s.conner)
+	}
+	return err
+}
+
+// storable returns val in the form required by the storage driver.
+func storable(cache remember.Cacher, val interface{}) interface{} {
+	if cache.StorePointer() {
+		return &val
+	}
+	return val
+}
+
+// mustSet stores val and fails the test on error.
+func (s *suite) mustSet(t *testing.T, key string, exp time.Duration, val interface{}) {
+	t.Helper()
+
+	if err := s.set(t, s.cache, key, exp, val); err != nil {
+		t.Fatalf("set %q: %v", key, err)
+	}
+}
+
+// assertFound checks whether key exists (and has the value expected, if found).
+// Storage drivers with NoStorage are never expected to find key.
+func (s *suite) assertFound(t *testing.T, key string, found bool, expected interface{}) {
+	t.Helper()
+
+	if s.NoStorage {
+		found = false
+	}
+
+	actual, ok, err := s.cache.Get(key)
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if ok != found {
+		t.Fatalf("wrong found for %q: expected: %v actual: %v", key, found, ok)
+	}
+	if found && !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong val for %q: expected: %#v actual: %#v", key, expected, actual)
+	}
+}
+
+// advance moves the clock forward by d.
+func (s *suite) advance(d time.Duration) {
+	if s.Advance != nil {
+		s.Advance(s.conner, d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func testGetMissing(t *testing.T, s *suite) {
+	s.assertFound(t, "missing", false, nil)
+}
+
+func testSetGet(t *testing.T, s *suite) {
+	for i, val := range values {
+		key := fmt.Sprintf("key-%d", i)
+		s.mustSet(t, key, time.Hour, val)
+
+		// Values stored as a pointer are returned as a concrete value
+		s.assertFound(t, key, true, val)
+	}
+}
+
+func testOverwrite(t *testing.T, s *suite) {
+	s.mustSet(t, "key", time.Hour, "val1")
+	s.mustSet(t, "key", time.Hour, "val2")
+	s.assertFound(t, "key", true, "val2")
+}
+
+func testForget(t *testing.T, s *suite) {
+	s.mustSet(t, "key1", time.Hour, "val1")
+	s.mustSet(t, "key2", time.Hour, "val2")
+
+	if err := s.cache.Forget("key1"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	s.assertFound(t, "key1", false, nil)
+	s.assertFound(t, "key2", true, "val2")
+
+	// Forgetting a missing key is not an error
+	if err := s.cache.Forget("missing"); err != nil {
+		t.Errorf("forget missing key: %v", err)
+	}
+}
+
+func testForgetAll(t *testing.T, s *suite) {
+	s.mustSet(t, "key1", time.Hour, "val1")
+	s.mustSet(t, "key2", s.NoExpiration, "val2")
+
+	if err := s.cache.ForgetAll(); err != nil {
+		t.Fatalf("forget all: %v", err)
+	}
+	s.assertFound(t, "key1", false, nil)
+	s.assertFound(t, "key2", false, nil)
+
+	// The cache is usable afterwards
+	s.mustSet(t, "key3", time.Hour, "val3")
+	s.assertFound(t, "key3", true, "val3")
+}
+
+func testExpiration(t *testing.T, s *suite) {
+	if s.NoStorage {
+		t.Skip("storage driver does not store items")
+	}
+
+	s.mustSet(t, "short", s.Expiration, "val")
+	s.mustSet(t, "long", time.Hour, "val")
+	s.mustSet(t, "forever", s.NoExpiration, "val")
+
+	s.assertFound(t, "short", true, "val")
+
+	s.advance(2 * s.Expiration)
+
+	s.assertFound(t, "short", false, nil)
+	s.assertFound(t, "long", true, "val")
+	s.assertFound(t, "forever", true, "val")
+}
+
+func testCache(t *testing.T, s *suite) {
+	var calls int
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return Item{Name: "item", Count: calls}, nil
+	}
+
+	expected := Item{Name: "item", Count: 1}
+	for i := 0; i < 2; i++ {
+		actual, found, err := remember.Cache(context.Background(), s.conner, "key", time.Hour, slowQuery)
+		if s.Wait != nil {
+			s.Wait(s.conner)
+		}
+		if err != nil {
+			t.Fatalf("cache: %v", err)
+		}
+		if s.NoStorage {
+			continue
+		}
+		if found != (i == 1) {
+			t.Errorf("wrong found: expected: %v actual: %v", i == 1, found)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("wrong val: expected: %#v actual: %#v", expected, actual)
+		}
+	}
+}
+
+func testSlowRetrieveError(t *testing.T, s *suite) {
+	errSlow := errors.New("slow retrieve failed")
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return nil, errSlow
+	}
+
+	_, found, err := remember.Cache(context.Background(), s.conner, "key", time.Hour, slowQuery)
+	if err != errSlow {
+		t.Errorf("wrong err: expected: %v actual: %v", errSlow, err)
+	}
+	if found {
+		t.Errorf("wrong found: expected: %v actual: %v", false, found)
+	}
+
+	// Errors are not cached
+	s.assertFound(t, "key", false, nil)
+}
+
+func testCAS(t *testing.T, s *suite) {
+	cc, ok := s.cache.(remember.CASCacher)
+	if !ok {
+		t.Skip("storage driver does not implement remember.CASCacher")
+	}
+
+	add := func(key string, val interface{}) error {
+		if cc.StorePointer() {
+			return cc.Add(key, time.Hour, &val)
+		}
+		return cc.Add(key, time.Hour, val)
+	}
+
+	if err := add("key", "val1"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := add("key", "val2"); err != remember.ErrNotStored {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrNotStored, err)
+	}
+
+	_, cas, found, err := cc.GetCAS("key")
+	if err != nil || !found {
+		t.Fatalf("get cas: found: %v err: %v", found, err)
+	}
+
+	var val interface{} = "val2"
+	itemToStore := val
+	if cc.StorePointer() {
+		itemToStore = &val
+	}
+	if err := cc.CompareAndSwap("key", time.Hour, itemToStore, cas); err != nil {
+		t.Fatalf("compare and swap: %v", err)
+	}
+	s.assertFound(t, "key", true, "val2")
+
+	// The token is stale
+	if err := cc.CompareAndSwap("key", time.Hour, itemToStore, cas); err != remember.ErrCASConflict {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrCASConflict, err)
+	}
+
+	// The value was modified by Set
+	_, cas, _, _ = cc.GetCAS("key")
+	s.mustSet(t, "key", time.Hour, "val3")
+	if err := cc.CompareAndSwap("key", time.Hour, itemToStore, cas); err != remember.ErrCASConflict {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrCASConflict, err)
+	}
+	s.assertFound(t, "key", true, "val3")
+
+	// The value was removed
+	_, cas, _, _ = cc.GetCAS("key")
+	if err := cc.Forget("key"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if err := cc.CompareAndSwap("key", time.Hour, itemToStore, cas); err != remember.ErrCASConflict {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrCASConflict, err)
+	}
+	s.assertFound(t, "key", false, nil)
+
+	// A removed key can be added again
+	if err := add("key", "val4"); err != nil {
+		t.Errorf("add: %v", err)
+	}
+	if err := add("missing", "val"); err != nil {
+		t.Errorf("add: %v", err)
+	}
+}
+
+func testDriverErrors(t *testing.T, s *suite) {
+	if s.Break == nil {
+		t.Skip("Config.Break is not set")
+	}
+
+	s.mustSet(t, "key", time.Hour, "val")
+	s.Break(s.conner)
+
+	if _, found, err := s.cache.Get("key"); err == nil || found {
+		t.Errorf("get: expected error: found: %v err: %v", found, err)
+	}
+	if err := s.set(t, s.cache, "key", time.Hour, "val"); err == nil {
+		t.Errorf("set: expected error")
+	}
+	if err := s.cache.Forget("key"); err == nil {
+		t.Errorf("forget: expected error")
+	}
+
+	if cc, ok := s.cache.(remember.CASCacher); ok {
+		if _, _, found, err := cc.GetCAS("key"); err == nil || found {
+			t.Errorf("get cas: expected error: found: %v err: %v", found, err)
+		}
+		if err := cc.Add("new", time.Hour, storable(cc, "val")); err == nil || err == remember.ErrNotStored {
+			t.Errorf("wrong err: expected: storage driver error actual: %v", err)
+		}
+		if err := cc.CompareAndSwap("key", time.Hour, storable(cc, "val"), 1); err == nil || err == remember.ErrCASConflict {
+			t.Errorf("wrong err: expected: storage driver error actual: %v", err)
+		}
+	}
+
+	// Cache grabs from SlowRetrieve when the storage driver fails
+	// (unless a connection can not be obtained)
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "fresh", nil
+	}
+
+	ctx := context.Background()
+	cache, connErr := s.conner.Conn(ctx)
+	if connErr == nil {
+		cache.Close()
+	}
+
+	actual, found, err := remember.Cache(ctx, s.conner, "key", time.Hour, slowQuery)
+	if connErr != nil {
+		if err == nil {
+			t.Errorf("cache: expected error")
+		}
+		return
+	}
+	if err != nil || found || actual != "fresh" {
+		t.Errorf("wrong val: expected: %v actual: %v (found: %v err: %v)", "fresh", actual, found, err)
+	}
+}
+
+func testConcurrency(t *testing.T, s *suite) {
+	const (
+		workers = 8
+		ops     = 50
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*ops)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			cache, err := s.conner.Conn(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer cache.Close()
+
+			for i := 0; i < ops; i++ {
+				key := fmt.Sprintf("key-%d", i%10)
+				expected := fmt.Sprintf("val-%d", i%10)
+
+				if err := s.set(t, cache, key, time.Hour, expected); err != nil && !s.Lossy {
+					errs <- fmt.Errorf("set %q: %v", key, err)
+					continue
+				}
+
+				actual, found, err := cache.Get(key)
+				if err != nil {
+					errs <- fmt.Errorf("get %q: %v", key, err)
+					continue
+				}
+				if found && actual != expected {
+					errs <- fmt.Errorf("wrong val for %q: expected: %v actual: %v", key, expected, actual)
+				}
+				if !found && !s.Lossy && !s.NoStorage {
+					errs <- fmt.Errorf("expected %q to be found", key)
+				}
+
+				// Each worker forgets its own key
+				own := fmt.Sprintf("worker-%d", w)
+				if err := s.set(t, cache, own, time.Hour, i); err != nil && !s.Lossy {
+					errs <- fmt.Errorf("set %q: %v", own, err)
+				}
+				if err := cache.Forget(own); err != nil {
+					errs <- fmt.Errorf("forget %q: %v", own, err)
+				}
+				if _, found, err := cache.Get(own); err != nil || found {
+					errs <- fmt.Errorf("get %q: found: %v err: %v", own, found, err)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package chaos provides a storage driver wrapper that injects faults.
+// It is used to verify that applications behave when the cache misbehaves.
+//
+// Example:
+//
+//	cc := chaos.Wrap(rs, chaos.Config{
+//		Seed: 42,
+//		Faults: map[chaos.Op]chaos.Fault{
+//			chaos.Get: {ErrorRate: 0.1, Latency: chaos.Uniform(5*time.Millisecond, 50*time.Millisecond)},
+//		},
+//		DropRate: 0.05,
+//	})
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// ErrInjected is returned by operations that fail due to an injected fault.
+var ErrInjected = errors.New("chaos: injected fault")
+
+// ErrPartitioned is returned by all operations while the cache is partitioned.
+var ErrPartitioned = errors.New("chaos: partitioned")
+
+// ErrDropped is returned by Add and CompareAndSwap when the write is discarded.
+// Unlike Set, they can not silently discard writes since callers (such as
+// SafeSet) rely on their success meaning that the value was stored.
+var ErrDropped = errors.New("chaos: write dropped")
+
+// ErrCorrupt is returned by Get when a corrupted value is injected and
+// Config.Corrupt is not set. It mimics the error returned by storage drivers
+// when a value can not be decoded.
+var ErrCorrupt = errors.New("chaos: corrupt value")
+
+// Op identifies a cache operation.
+type Op string
+
+const (
+	// Conn is when a connection is obtained.
+	Conn Op = "conn"
+
+	// Get is when a value is fetched (including GetCAS).
+	Get Op = "get"
+
+	// Set is when a value is stored (including Add and CompareAndSwap).
+	Set Op = "set"
+
+	// Forget is when a key is cleared.
+	Forget Op = "forget"
+
+	// ForgetAll is when all keys are cleared.
+	ForgetAll Op = "forgetall"
+)
+
+// Fault describes the faults that are injected into an operation.
+type Fault struct {
+
+	// ErrorRate is the probability (between 0 and 1) that the operation fails.
+	ErrorRate float64
+
+	// Err is returned when the operation fails. If not set, ErrInjected is used.
+	Err error
+
+	// Latency is added to the operation. It is added even if the operation fails.
+	Latency Latency
+}
+
+// Config is used to configure the faults that are injected.
+type Config struct {
+
+	// Seed seeds the random number generator. The same seed (and sequence of
+	// operations) produces the same faults.
+	Seed int64
+
+	// Faults contains the faults injected for each operation.
+	Faults map[Op]Fault
+
+	// CorruptRate is the probability (between 0 and 1) that Get returns a corrupted value.
+	CorruptRate float64
+
+	// Corrupt returns the corrupted version of item.
+	// If not set, Get returns ErrCorrupt (with found set to true).
+	Corrupt func(item interface{}) (interface{}, error)
+
+	// DropRate is the probability (between 0 and 1) that Set silently discards the value.
+	// Add and CompareAndSwap return ErrDropped when the value is discarded.
+	DropRate float64
+
+	// PartitionLatency is added to every operation while the cache is partitioned.
+	// It can be used to simulate timeouts.
+	//
+	// Latencies end early if the context provided to Conn is done. The operation
+	// then returns the context's error.
+	PartitionLatency Latency
+
+	// Clock is used to wait for latencies.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// Stats contains the number of faults injected.
+type Stats struct {
+	Errors      uint64 // Operations that failed
+	Corruptions uint64 // Values that were corrupted
+	Drops       uint64 // Values that were discarded
+	Partitioned uint64 // Operations that failed due to a partition
+}
+
+// Chaos is a storage driver that injects faults into an underlying storage driver.
+// It is safe for concurrent use.
+type Chaos struct {
+	stats Stats // accessed atomically so it must be 64-bit aligned
+
+	conner remember.Conner
+	clock  remember.Clock
+
+	mu  sync.Mutex
+	cfg Config
+	rnd *rand.Rand
+
+	enabled     int32
+	partitioned int32
+}
+
+// Wrap returns a storage driver that injects the faults described by cfg into c.
+// Faults are injected immediately. The underlying connection implements
+// remember.CASCacher if c's does, and the returned storage driver validates keys
+// if c implements remember.KeyValidator.
+func Wrap(c remember.Conner, cfg Config) *Chaos {
+	return &Chaos{
+		conner:  c,
+		clock:   remember.ClockOrDefault(cfg.Clock),
+		cfg:     cfg,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		enabled: 1,
+	}
+}
+
+// SetConfig replaces the faults that are injected. The random number generator is reseeded.
+func (c *Chaos) SetConfig(cfg Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cfg = cfg
+	c.clock = remember.ClockOrDefault(cfg.Clock)
+	c.rnd = rand.New(rand.NewSource(cfg.Seed))
+}
+
+// Enable starts injecting faults.
+func (c *Chaos) Enable() { atomic.StoreInt32(&c.enabled, 1) }
+
+// Disable stops injecting faults (including partitions). Operations are passed through.
+func (c *Chaos) Disable() { atomic.StoreInt32(&c.enabled, 0) }
+
+// Enabled reports whether faults are being injected.
+func (c *Chaos) Enabled() bool { return atomic.LoadInt32(&c.enabled) == 1 }
+
+// Partition causes all operations to fail with ErrPartitioned until Heal is called.
+func (c *Chaos) Partition() { atomic.StoreInt32(&c.partitioned, 1) }
+
+// Heal ends a partition.
+func (c *Chaos) Heal() { atomic.StoreInt32(&c.partitioned, 0) }
+
+// Stats returns the number of faults injected.
+func (c *Chaos) Stats() Stats {
+	return Stats{
+		Errors:      atomic.LoadUint64(&c.stats.Errors),
+		Corruptions: atomic.LoadUint64(&c.stats.Corruptions),
+		Drops:       atomic.LoadUint64(&c.stats.Drops),
+		Partitioned: atomic.LoadUint64(&c.stats.Partitioned),
+	}
+}
+
+// ValidateKey validates key using the underlying storage driver (if it implements remember.KeyValidator).
+func (c *Chaos) ValidateKey(key string) error {
+	if kv, ok := c.conner.(remember.KeyValidator); ok {
+		return kv.ValidateKey(key)
+	}
+	return nil
+}
+
+// Conn obtains a connection from the underlying storage driver.
+func (c *Chaos) Conn(ctx context.Context) (remember.Cacher, error) {
+	if err := c.inject(ctx, Conn); err != nil {
+		return nil, err
+	}
+
+	cache, err := c.conner.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &cacher{cache, c, ctx}
+	if cas, ok := cache.(remember.CASCacher); ok {
+		return &casCacher{cc, cas}, nil
+	}
+	return cc, nil
+}
+
+// inject waits for the latency of op and returns an error if the operation should fail.
+func (c *Chaos) inject(ctx context.Context, op Op) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	c.mu.Lock()
+	var (
+		latency time.Duration
+		err     error
+		clock   = c.clock
+	)
+	if atomic.LoadInt32(&c.partitioned) == 1 {
+		if c.cfg.PartitionLatency != nil {
+			latency = c.cfg.PartitionLatency(c.rnd)
+		}
+		err = ErrPartitioned
+	} else if f, ok := c.cfg.Faults[op]; ok {
+		if f.Latency != nil {
+			latency = f.Latency(c.rnd)
+		}
+		if f.ErrorRate > 0 && c.rnd.Float64() < f.ErrorRate {
+			err = f.Err
+			if err == nil {
+				err = ErrInjected
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-clock.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err == ErrPartitioned {
+		atomic.AddUint64(&c.stats.Partitioned, 1)
+	} else if err != nil {
+		atomic.AddUint64(&c.stats.Errors, 1)
+	}
+	return err
+}
+
+// chance reports whether an event with the probability returned by rate occurs.
+func (c *Chaos) chance(rate func(cfg Config) float64) bool {
+	if !c.Enabled() {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := rate(c.cfg)
+	return p > 0 && c.rnd.Float64() < p
+}
+
+// corrupt returns the corrupted version of item if a corruption should be injected.
+func (c *Chaos) corrupt(item interface{}) (interface{}, error) {
+	if !c.chance(func(cfg Config) float64 { return cfg.CorruptRate }) {
+		return item, nil
+	}
+
+	c.mu.Lock()
+	corrupt := c.cfg.Corrupt
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.stats.Corruptions, 1)
+	if corrupt == nil {
+		return nil, ErrCorrupt
+	}
+	return corrupt(item)
+}
+
+// drop reports whether a write should be discarded.
+func (c *Chaos) drop() bool {
+	if c.chance(func(cfg Config) float64 { return cfg.DropRate }) {
+		atomic.AddUint64(&c.stats.Drops, 1)
+		return true
+	}
+	return false
+}
+
+type cacher struct {
+	remember.Cacher
+	chaos *Chaos
+	ctx   context.Context
+}
+
+func (c *cacher) Get(key string) (interface{}, bool, error) {
+	if err := c.chaos.inject(c.ctx, Get); err != nil {
+		return nil, false, err
+	}
+
+	item, found, err := c.Cacher.Get(key)
+	if err == nil && found {
+		item, err = c.chaos.corrupt(item)
+	}
+	return item, found, err
+}
+
+func (c *cacher) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	if err := c.chaos.inject(c.ctx, Set); err != nil {
+		return err
+	}
+	if c.chaos.drop() {
+		return nil
+	}
+	return c.Cacher.Set(key, expiration, itemToStore)
+}
+
+func (c *cacher) Forget(key string) error {
+	if err := c.chaos.inject(c.ctx, Forget); err != nil {
+		return err
+	}
+	return c.Cacher.Forget(key)
+}
+
+func (c *cacher) ForgetAll() error {
+	if err := c.chaos.inject(c.ctx, ForgetAll); err != nil {
+		return err
+	}
+	return c.Cacher.ForgetAll()
+}
+
+type casCacher struct {
+	*cacher
+	cas remember.CASCacher
+}
+
+func (c *casCacher) GetCAS(key string) (interface{}, uint64, bool, error) {
+	if err := c.chaos.inject(c.ctx, Get); err != nil {
+		return nil, 0, false, err
+	}
+
+	item, cas, found, err := c.cas.GetCAS(key)
+	if err == nil && found {
+		item, err = c.chaos.corrupt(item)
+	}
+	return item, cas, found, err
+}
+
+func (c *casCacher) Add(key string, expiration time.Duration, itemToStore interface{}) error {
+	if err := c.chaos.inject(c.ctx, Set); err != nil {
+		return err
+	}
+	if c.chaos.drop() {
+		return ErrDropped
+	}
+	return c.cas.Add(key, expiration, itemToStore)
+}
+
+func (c *casCacher) CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error {
+	if err := c.chaos.inject(c.ctx, Set); err != nil {
+		return err
+	}
+	if c.chaos.drop() {
+		return ErrDropped
+	}
+	return c.cas.CompareAndSwap(key, expiration, itemToStore, cas)
+}
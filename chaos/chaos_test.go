@@ -0,0 +1,307 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/chaos"
+	"github.com/rocketlaunchr/remember-go/memory"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+var ctx = context.Background()
+
+func conn(t *testing.T, c remember.Conner) remember.Cacher {
+	t.Helper()
+
+	cache, err := c.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestConformance(t *testing.T) {
+	// Without faults, the wrapper behaves like the underlying storage driver
+	clock := remembertest.NewFakeClock(time.Now())
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		ms := memory.NewMemoryStore(10 * time.Minute)
+		ms.Clock = clock
+		return chaos.Wrap(ms, chaos.Config{}), nil
+	}, cachertest.Config{
+		NoExpiration: memory.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			clock.Advance(d)
+		},
+		Break: func(c remember.Conner) {
+			c.(*chaos.Chaos).Partition()
+		},
+	})
+}
+
+func TestErrorRate(t *testing.T) {
+	cfg := chaos.Config{
+		Seed:   42,
+		Faults: map[chaos.Op]chaos.Fault{chaos.Get: {ErrorRate: 0.2}},
+	}
+
+	// The same seed produces the same faults
+	run := func() []bool {
+		cache := conn(t, chaos.Wrap(memory.NewMemoryStore(time.Minute), cfg))
+		out := make([]bool, 1000)
+		for i := range out {
+			_, _, err := cache.Get("key")
+			if err != nil && err != chaos.ErrInjected {
+				t.Fatalf("wrong err: expected: %v actual: %v", chaos.ErrInjected, err)
+			}
+			out[i] = err != nil
+		}
+		return out
+	}
+
+	first, second := run(), run()
+
+	var failures int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected deterministic faults at %d", i)
+		}
+		if first[i] {
+			failures++
+		}
+	}
+	if failures < 150 || failures > 250 {
+		t.Errorf("wrong number of failures: expected: ~%v actual: %v", 200, failures)
+	}
+
+	// Other operations are not affected
+	cache := conn(t, chaos.Wrap(memory.NewMemoryStore(time.Minute), cfg))
+	for i := 0; i < 100; i++ {
+		if err := cache.Set("key", time.Minute, "val"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestConnFailure(t *testing.T) {
+	errDown := errors.New("down")
+	cc := chaos.Wrap(memory.NewMemoryStore(time.Minute), chaos.Config{
+		Faults: map[chaos.Op]chaos.Fault{chaos.Conn: {ErrorRate: 1, Err: errDown}},
+	})
+
+	_, _, err := remember.Cache(ctx, cc, "key", time.Minute, func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	})
+	if err != errDown {
+		t.Errorf("wrong err: expected: %v actual: %v", errDown, err)
+	}
+	if cc.Stats().Errors != 1 {
+		t.Errorf("wrong number of errors: expected: %v actual: %v", 1, cc.Stats().Errors)
+	}
+
+	// Faults are not injected when disabled
+	cc.Disable()
+	if _, err := cc.Conn(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDroppedWrites(t *testing.T) {
+	cc := chaos.Wrap(memory.NewMemoryStore(time.Minute), chaos.Config{DropRate: 1})
+	cache := conn(t, cc)
+
+	if err := cache.Set("key", time.Minute, "val"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found, _ := cache.Get("key"); found {
+		t.Errorf("expected write to be dropped")
+	}
+	if cc.Stats().Drops != 1 {
+		t.Errorf("wrong number of drops: expected: %v actual: %v", 1, cc.Stats().Drops)
+	}
+}
+
+func TestCorruptedValues(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	conn(t, ms).Set("key", time.Minute, "val")
+
+	cache := conn(t, chaos.Wrap(ms, chaos.Config{CorruptRate: 1}))
+	if _, found, err := cache.Get("key"); !found || err != chaos.ErrCorrupt {
+		t.Errorf("wrong err: expected: %v actual: %v", chaos.ErrCorrupt, err)
+	}
+
+	// Missing keys are not corrupted
+	if _, found, err := cache.Get("missing"); found || err != nil {
+		t.Errorf("unexpected result: found: %v err: %v", found, err)
+	}
+
+	// Custom corruption
+	cache = conn(t, chaos.Wrap(ms, chaos.Config{
+		CorruptRate: 1,
+		Corrupt: func(item interface{}) (interface{}, error) {
+			return 42, nil
+		},
+	}))
+	if actual, _, err := cache.Get("key"); err != nil || actual != 42 {
+		t.Errorf("wrong val: expected: %v actual: %v", 42, actual)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	cc := chaos.Wrap(memory.NewMemoryStore(time.Minute), chaos.Config{})
+	cache := conn(t, cc)
+
+	cc.Partition()
+	if err := cache.Set("key", time.Minute, "val"); err != chaos.ErrPartitioned {
+		t.Errorf("wrong err: expected: %v actual: %v", chaos.ErrPartitioned, err)
+	}
+	if _, err := cc.Conn(ctx); err != chaos.ErrPartitioned {
+		t.Errorf("wrong err: expected: %v actual: %v", chaos.ErrPartitioned, err)
+	}
+
+	cc.Heal()
+	if err := cache.Set("key", time.Minute, "val"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if cc.Stats().Partitioned != 2 {
+		t.Errorf("wrong number of partitioned operations: expected: %v actual: %v", 2, cc.Stats().Partitioned)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+	cc := chaos.Wrap(memory.NewMemoryStore(time.Minute), chaos.Config{
+		Faults: map[chaos.Op]chaos.Fault{chaos.Get: {Latency: chaos.Fixed(time.Second)}},
+		Clock:  clock,
+	})
+	cache := conn(t, cc)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Get("key")
+		close(done)
+	}()
+
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-done:
+		t.Fatalf("expected Get to wait")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	<-done
+}
+
+func TestLatencyCancelled(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+	cc := chaos.Wrap(memory.NewMemoryStore(time.Minute), chaos.Config{
+		Faults: map[chaos.Op]chaos.Fault{chaos.Get: {Latency: chaos.Fixed(time.Hour)}},
+		Clock:  clock,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	cache, err := cc.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cache.Get("key"); err != context.DeadlineExceeded {
+		t.Errorf("wrong err: expected: %v actual: %v", context.DeadlineExceeded, err)
+	}
+}
+
+// casStore is a storage driver that implements remember.KeyValidator and whose
+// connections implement remember.CASCacher.
+type casStore struct {
+	*memory.MemoryStore
+}
+
+func (s casStore) Conn(ctx context.Context) (remember.Cacher, error) {
+	cache, _ := s.MemoryStore.Conn(ctx)
+	return casCacher{cache}, nil
+}
+
+func (s casStore) ValidateKey(key string) error {
+	if key == "" {
+		return remember.ErrInvalidKey
+	}
+	return nil
+}
+
+type casCacher struct {
+	remember.Cacher
+}
+
+func (c casCacher) GetCAS(key string) (interface{}, uint64, bool, error) {
+	item, found, err := c.Get(key)
+	return item, 1, found, err
+}
+
+func (c casCacher) Add(key string, expiration time.Duration, itemToStore interface{}) error {
+	return c.Set(key, expiration, itemToStore)
+}
+
+func (c casCacher) CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error {
+	return c.Set(key, expiration, itemToStore)
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	cc := chaos.Wrap(casStore{memory.NewMemoryStore(time.Minute)}, chaos.Config{DropRate: 1})
+
+	if err := cc.ValidateKey(""); err != remember.ErrInvalidKey {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+
+	cache, ok := conn(t, cc).(remember.CASCacher)
+	if !ok {
+		t.Fatalf("expected connection to implement remember.CASCacher")
+	}
+
+	// Dropped writes are not reported as successful
+	if err := cache.Add("key", time.Minute, "val"); err != chaos.ErrDropped {
+		t.Errorf("wrong err: expected: %v actual: %v", chaos.ErrDropped, err)
+	}
+	if err := cache.CompareAndSwap("key", time.Minute, "val", 1); err != chaos.ErrDropped {
+		t.Errorf("wrong err: expected: %v actual: %v", chaos.ErrDropped, err)
+	}
+	if _, found, _ := cache.Get("key"); found {
+		t.Errorf("expected write to be dropped")
+	}
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	tests := []struct {
+		name     string
+		latency  chaos.Latency
+		min, max time.Duration
+	}{
+		{"fixed", chaos.Fixed(time.Second), time.Second, time.Second},
+		{"uniform", chaos.Uniform(time.Second, 2*time.Second), time.Second, 2 * time.Second},
+		{"normal", chaos.Normal(time.Second, 100*time.Millisecond), 0, 2 * time.Second},
+		{"exponential", chaos.Exponential(time.Second), 0, time.Minute},
+		{"spike", chaos.Spike(0.1, time.Second), 0, time.Second},
+	}
+
+	for _, tt := range tests {
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			d := tt.latency(r)
+			if d < tt.min || d > tt.max {
+				t.Errorf("%s: wrong latency: expected between %v and %v actual: %v", tt.name, tt.min, tt.max, d)
+			}
+		}
+	}
+}
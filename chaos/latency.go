@@ -0,0 +1,58 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package chaos
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Latency returns a duration that is added to an operation.
+// r must only be used to generate random numbers.
+type Latency func(r *rand.Rand) time.Duration
+
+// Fixed adds d to every operation.
+func Fixed(d time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// Uniform adds a duration that is uniformly distributed between min and max.
+func Uniform(min, max time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// Normal adds a normally distributed duration. Negative durations are treated as 0.
+func Normal(mean, stddev time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		d := time.Duration(r.NormFloat64()*float64(stddev)) + mean
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+}
+
+// Exponential adds an exponentially distributed duration.
+// Most operations are fast, but some are very slow.
+func Exponential(mean time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// Spike adds d to a fraction (between 0 and 1) of operations.
+func Spike(fraction float64, d time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if r.Float64() < fraction {
+			return d
+		}
+		return 0
+	}
+}
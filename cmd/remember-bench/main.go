@@ -0,0 +1,115 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Command remember-bench runs the benchmarks in the benchmark package and
+// generates a report. A report can be compared against a previous report
+// to detect regressions between releases.
+//
+// Usage:
+//
+//	remember-bench -o v1.2.0.json
+//	remember-bench -compare v1.2.0.json -threshold 0.1
+//
+// The exit status is 1 if a regression is detected.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/rocketlaunchr/remember-go/benchmark"
+)
+
+func main() {
+	var (
+		run       = flag.String("run", "", "only run benchmarks matching the regular expression")
+		count     = flag.Int("count", 3, "run each benchmark n times and report the fastest")
+		format    = flag.String("format", "markdown", "output format: markdown or json")
+		out       = flag.String("o", "", "write the report to file (as json) instead of stdout")
+		compare   = flag.String("compare", "", "compare against a report previously written with -o")
+		threshold = flag.Float64("threshold", 0.1, "relative change in ns/op reported by -compare")
+	)
+	flag.Parse()
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		filter, err = regexp.Compile(*run)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	var old *benchmark.Report
+	if *compare != "" {
+		f, err := os.Open(*compare)
+		if err != nil {
+			fatal(err)
+		}
+		r, err := benchmark.ReadReport(f)
+		f.Close()
+		if err != nil {
+			fatal(err)
+		}
+		old = &r
+	}
+
+	r := benchmark.Run(filter, *count)
+
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatal(err)
+		}
+		if err := r.WriteJSON(f); err != nil {
+			fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			fatal(err)
+		}
+	} else if err := write(os.Stdout, r, *format); err != nil {
+		fatal(err)
+	}
+
+	if old == nil {
+		return
+	}
+
+	if old.GoVersion != r.GoVersion || old.GOOS != r.GOOS || old.GOARCH != r.GOARCH || old.NumCPU != r.NumCPU {
+		fmt.Fprintf(os.Stderr, "warning: reports were generated in different environments: %s %s/%s (%d CPUs) vs %s %s/%s (%d CPUs)\n",
+			old.GoVersion, old.GOOS, old.GOARCH, old.NumCPU, r.GoVersion, r.GOOS, r.GOARCH, r.NumCPU)
+	}
+
+	var regressed bool
+	fmt.Println()
+	for _, c := range benchmark.Compare(*old, r, *threshold) {
+		status := "improved"
+		if c.Regression() {
+			status = "REGRESSED"
+			regressed = true
+		}
+		fmt.Printf("%-9s %s: %.0f -> %.0f ns/op (%+.1f%%), %d -> %d allocs/op\n",
+			status, c.Name, c.Old.NsPerOp, c.New.NsPerOp, c.Delta*100, c.Old.AllocsPerOp, c.New.AllocsPerOp)
+	}
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+func write(w io.Writer, r benchmark.Report, format string) error {
+	switch format {
+	case "markdown":
+		return r.WriteMarkdown(w)
+	case "json":
+		return r.WriteJSON(w)
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "remember-bench:", err)
+	os.Exit(2)
+}
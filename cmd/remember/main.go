@@ -0,0 +1,25 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Command remember inspects the values cached in a redis or memcached server and computes keys.
+//
+// Usage:
+//
+//	remember -redis localhost:6379 keys 'user:*'
+//	remember -redis localhost:6379 get user:1
+//	remember -memcached localhost:11211 forget user:1
+//	remember key -sep - search-page golang 2
+//	remember hash -hasher sha256 'a very long key'
+//
+// Only builtin types can be decoded. See the remembercli package to decode
+// values of your own types.
+package main
+
+import (
+	"os"
+
+	"github.com/rocketlaunchr/remember-go/remembercli"
+)
+
+func main() {
+	os.Exit(remembercli.Main(os.Args[1:]))
+}
@@ -0,0 +1,28 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package disk_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/disk"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+func TestConformance(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		ds, dir := newStore(t, disk.Config{Clock: clock})
+		return ds, func() { os.RemoveAll(dir) }
+	}, cachertest.Config{
+		NoExpiration: disk.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			clock.Advance(d)
+		},
+	})
+}
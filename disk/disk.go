@@ -0,0 +1,499 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package disk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// NoExpiration is used to indicate that data should not expire from the cache.
+const NoExpiration time.Duration = -1
+
+const (
+	dataDir      = "data"
+	lockFileName = ".lock"
+	tempPrefix   = ".tmp-"
+
+	// staleTempAge is the age after which abandoned temporary files are deleted.
+	staleTempAge = time.Hour
+
+	// lowWaterMark is the fraction of MaxBytes that the cache is reduced to when
+	// MaxBytes is exceeded. Evicting below MaxBytes means that the cache directory
+	// is not swept again by every subsequent Set.
+	lowWaterMark = 0.9
+)
+
+// magic identifies files written by this driver.
+var magic = [4]byte{'R', 'M', 'B', '1'}
+
+// ErrCorrupt signifies that a cache file could not be parsed.
+var ErrCorrupt = errors.New("corrupt cache file")
+
+// Config is used to configure a DiskStore.
+type Config struct {
+
+	// MaxBytes is the approximate maximum size of all the cache files.
+	// When exceeded, the least recently used files are deleted until the
+	// cache is reduced to 90% of MaxBytes. 0 means there is no limit.
+	MaxBytes int64
+
+	// CleanupInterval is how often expired files are deleted.
+	// 0 means expired files are only deleted when the cache exceeds MaxBytes.
+	CleanupInterval time.Duration
+
+	// Clock is used to determine when files expire.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// DiskStore is used to create a cache that persists to the filesystem.
+// Values are gob encoded and stored in a file named after the hash of the key.
+//
+// Multiple processes can safely share the same directory.
+type DiskStore struct {
+	dir   string
+	cfg   Config
+	lock  *fileLock
+	size  int64 // approximate size of all cache files
+	clock remember.Clock
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewDiskStore creates a cache that persists to dir.
+// dir is created if it does not exist.
+func NewDiskStore(dir string, cfg ...Config) (*DiskStore, error) {
+
+	var c Config
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+
+	err := os.MkdirAll(filepath.Join(dir, dataDir), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := newFileLock(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DiskStore{
+		dir:   dir,
+		cfg:   c,
+		lock:  lock,
+		clock: remember.ClockOrDefault(c.Clock),
+	}
+
+	size, err := ds.dataSize()
+	if err != nil {
+		return nil, err
+	}
+	ds.size = size
+
+	if c.CleanupInterval > 0 {
+		ds.stop = make(chan struct{})
+		go ds.janitor(c.CleanupInterval, ds.stop)
+	}
+
+	return ds, nil
+}
+
+// Conn does nothing for this storage driver.
+func (c *DiskStore) Conn(ctx context.Context) (remember.Cacher, error) {
+	return c, nil
+}
+
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *DiskStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// StorePointer sets whether a storage driver requires itemToStore to be
+// stored as a pointer or as a concrete value.
+func (c *DiskStore) StorePointer() bool {
+	return true
+}
+
+// Get returns a value from the cache if the key exists.
+func (c *DiskStore) Get(key string) (_ interface{}, found bool, _ error) {
+
+	if err := c.lock.RLock(); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.RUnlock()
+
+	path := c.path(key)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	expires, k, val, err := decodeFile(b)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if k != key || expired(expires, c.clock.Now()) {
+		return nil, false, nil
+	}
+
+	// Record the access for the purposes of eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	var output interface{}
+
+	err = gob.NewDecoder(bytes.NewBuffer(val)).Decode(&output)
+	if err != nil {
+		return nil, true, err // Could not decode cached data
+	}
+
+	return output, true, nil
+}
+
+// Set sets a item into the cache for a particular key.
+// The file is written atomically.
+func (c *DiskStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+
+	// Convert item to bytes
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(itemToStore)
+	if err != nil {
+		return err
+	}
+
+	var expires int64
+	if expiration > 0 {
+		expires = c.clock.Now().Add(expiration).UnixNano()
+	}
+
+	data := encodeFile(expires, key, b.Bytes())
+
+	if err := c.lock.RLock(); err != nil {
+		return err
+	}
+	delta, err := c.write(c.path(key), data)
+	c.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if size := atomic.AddInt64(&c.size, delta); c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		return c.sweep()
+	}
+	return nil
+}
+
+// Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing. Use Shutdown to release the store's resources.
+func (c *DiskStore) Close() {}
+
+// Shutdown stops the background deletion of expired files and closes the lock file.
+// The store must not be used afterwards.
+func (c *DiskStore) Shutdown() error {
+	c.StopCleanup()
+	return c.lock.Close()
+}
+
+// Forget clears the value from the cache for the particular key.
+func (c *DiskStore) Forget(key string) error {
+
+	if err := c.lock.RLock(); err != nil {
+		return err
+	}
+	defer c.lock.RUnlock()
+
+	path := c.path(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	atomic.AddInt64(&c.size, -info.Size())
+	return nil
+}
+
+// ForgetAll clears all values from the cache.
+func (c *DiskStore) ForgetAll() error {
+
+	if err := c.lock.Lock(); err != nil {
+		return err
+	}
+	defer c.lock.Unlock()
+
+	data := filepath.Join(c.dir, dataDir)
+
+	// Move the data aside so that the cache is cleared atomically
+	trash, err := ioutil.TempDir(c.dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(data, filepath.Join(trash, dataDir))
+	if err != nil {
+		os.Remove(trash)
+		return err
+	}
+
+	err = os.Mkdir(data, 0755)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&c.size, 0)
+
+	return os.RemoveAll(trash)
+}
+
+// DeleteExpired deletes all expired files. If the cache exceeds MaxBytes,
+// the least recently used files are also deleted.
+func (c *DiskStore) DeleteExpired() error {
+	return c.sweep()
+}
+
+// StopCleanup stops the background deletion of expired files.
+func (c *DiskStore) StopCleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *DiskStore) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// path returns the location of the file for key.
+func (c *DiskStore) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(h[:])
+	return filepath.Join(c.dir, dataDir, name[:2], name)
+}
+
+// write atomically writes data to path. It returns the change in size of the cache.
+func (c *DiskStore) write(path string, data []byte) (int64, error) {
+
+	var old int64
+	if info, err := os.Stat(path); err == nil {
+		old = info.Size()
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+
+	return int64(len(data)) - old, nil
+}
+
+// sweep deletes expired files and abandoned temporary files. If the cache
+// exceeds MaxBytes, the least recently used files are also deleted.
+func (c *DiskStore) sweep() error {
+
+	if err := c.lock.Lock(); err != nil {
+		return err
+	}
+	defer c.lock.Unlock()
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var (
+		now     = time.Now()
+		clockAt = c.clock.Now() // used for expirations
+		files   []file
+		total   int64
+	)
+
+	err := filepath.Walk(filepath.Join(c.dir, dataDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), tempPrefix) {
+			if now.Sub(info.ModTime()) > staleTempAge {
+				os.Remove(path)
+			}
+			return nil
+		}
+
+		expires, err := readExpiry(path)
+		if err != nil || expired(expires, clockAt) {
+			// Expired or corrupt
+			os.Remove(path)
+			return nil
+		}
+
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.cfg.MaxBytes > 0 && total > c.cfg.MaxBytes {
+		// Delete the least recently used files first
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].modTime.Before(files[j].modTime)
+		})
+
+		target := int64(float64(c.cfg.MaxBytes) * lowWaterMark)
+		for _, f := range files {
+			if total <= target {
+				break
+			}
+			if err := os.Remove(f.path); err == nil || os.IsNotExist(err) {
+				total -= f.size
+			}
+		}
+	}
+
+	atomic.StoreInt64(&c.size, total)
+	return nil
+}
+
+// dataSize returns the size of all cache files.
+func (c *DiskStore) dataSize() (int64, error) {
+	var total int64
+	err := filepath.Walk(filepath.Join(c.dir, dataDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && !strings.HasPrefix(info.Name(), tempPrefix) {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func expired(expires int64, now time.Time) bool {
+	return expires > 0 && now.UnixNano() >= expires
+}
+
+// The file format is:
+//
+//	magic   [4]byte
+//	expires int64  (UnixNano, 0 means no expiration)
+//	keyLen  uint32
+//	key     [keyLen]byte
+//	value   []byte (gob encoded)
+const headerLen = 4 + 8 + 4
+
+func encodeFile(expires int64, key string, val []byte) []byte {
+	b := make([]byte, headerLen+len(key)+len(val))
+	copy(b, magic[:])
+	binary.BigEndian.PutUint64(b[4:], uint64(expires))
+	binary.BigEndian.PutUint32(b[12:], uint32(len(key)))
+	copy(b[headerLen:], key)
+	copy(b[headerLen+len(key):], val)
+	return b
+}
+
+func decodeFile(b []byte) (expires int64, key string, val []byte, _ error) {
+	if len(b) < headerLen || !bytes.Equal(b[:4], magic[:]) {
+		return 0, "", nil, ErrCorrupt
+	}
+	expires = int64(binary.BigEndian.Uint64(b[4:]))
+	keyLen := int(binary.BigEndian.Uint32(b[12:]))
+	if len(b) < headerLen+keyLen {
+		return 0, "", nil, ErrCorrupt
+	}
+	return expires, string(b[headerLen : headerLen+keyLen]), b[headerLen+keyLen:], nil
+}
+
+// readExpiry reads only the header of the file at path.
+func readExpiry(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var header [headerLen]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(header[:4], magic[:]) {
+		return 0, ErrCorrupt
+	}
+	return int64(binary.BigEndian.Uint64(header[4:])), nil
+}
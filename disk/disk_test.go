@@ -0,0 +1,357 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package disk_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/disk"
+)
+
+var ctx = context.Background()
+
+func newStore(t *testing.T, cfg ...disk.Config) (*disk.DiskStore, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "remember-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := disk.NewDiskStore(dir, cfg...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds, dir
+}
+
+func set(t *testing.T, ds *disk.DiskStore, key string, exp time.Duration, val interface{}) {
+	t.Helper()
+
+	if err := ds.Set(key, exp, &val); err != nil {
+		t.Fatalf("set %q: %v", key, err)
+	}
+}
+
+func TestKeyBasicOperation(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	actual, _, _ := remember.Cache(ctx, ds, key, exp, slowQuery)
+
+	expected := "val"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestFetchFromCacheAndDisableCache(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	// warm up cache
+	remember.Cache(ctx, ds, key, exp, slowQuery)
+
+	// This time fetch from cache
+	actual, found, _ := remember.Cache(ctx, ds, key, exp, slowQuery)
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Actual is now "val", Let's change it to "val2" and disable cache usage.
+
+	slowQuery = func(ctx context.Context) (interface{}, error) {
+		return "val2", nil
+	}
+
+	actual, _, _ = remember.Cache(ctx, ds, key, exp, slowQuery, remember.Options{DisableCacheUsage: true})
+
+	expected = "val2"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	set(t, ds, "key", disk.NoExpiration, "val")
+
+	// Simulate a process restart
+	ds2, err := disk.NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, found, err := ds2.Get("key")
+	if err != nil || !found {
+		t.Fatalf("get: found: %v err: %v", found, err)
+	}
+
+	if actual.(string) != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	set(t, ds, "short", 10*time.Millisecond, "val")
+	set(t, ds, "forever", disk.NoExpiration, "val")
+
+	time.Sleep(20 * time.Millisecond)
+
+	assertFound(t, ds, "short", false)
+	assertFound(t, ds, "forever", true)
+
+	if err := ds.DeleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countFiles(t, dir); n != 1 {
+		t.Errorf("wrong number of files: expected: %v actual: %v", 1, n)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	ds, dir := newStore(t, disk.Config{CleanupInterval: 10 * time.Millisecond})
+	defer os.RemoveAll(dir)
+	defer ds.StopCleanup()
+
+	set(t, ds, "short", 10*time.Millisecond, "val")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := countFiles(t, dir); n != 0 {
+		t.Errorf("wrong number of files: expected: %v actual: %v", 0, n)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	ds, dir := newStore(t, disk.Config{MaxBytes: 10000})
+	defer os.RemoveAll(dir)
+
+	val := strings.Repeat("x", 1000)
+
+	for i := 0; i < 50; i++ {
+		set(t, ds, fmt.Sprintf("key-%d", i), disk.NoExpiration, val)
+	}
+
+	if size := dataSize(t, dir); size > 10000 {
+		t.Errorf("size exceeds limit: %v", size)
+	}
+
+	// The most recently stored key is kept
+	assertFound(t, ds, "key-49", true)
+	assertFound(t, ds, "key-0", false)
+
+	// Eviction reduces the cache below MaxBytes so that the next Set doesn't
+	// immediately exceed it again
+	if size := dataSize(t, dir); size > 9000 {
+		t.Errorf("size exceeds low-water mark: %v", size)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ds, dir := newStore(t, disk.Config{CleanupInterval: time.Minute})
+	defer os.RemoveAll(dir)
+
+	set(t, ds, "key", disk.NoExpiration, "val")
+
+	if err := ds.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files persist for another store
+	ds2, err := disk.NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds2.Shutdown()
+	assertFound(t, ds2, "key", true)
+}
+
+func TestForget(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	set(t, ds, "a", disk.NoExpiration, 1)
+	set(t, ds, "b", disk.NoExpiration, 2)
+
+	if err := ds.Forget("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Forget("missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, ds, "a", false)
+	assertFound(t, ds, "b", true)
+
+	if err := ds.ForgetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, ds, "b", false)
+
+	if n := countFiles(t, dir); n != 0 {
+		t.Errorf("wrong number of files: expected: %v actual: %v", 0, n)
+	}
+
+	// Store is still usable after ForgetAll
+	set(t, ds, "c", disk.NoExpiration, 3)
+	assertFound(t, ds, "c", true)
+}
+
+func TestCorruptFile(t *testing.T) {
+	ds, dir := newStore(t)
+	defer os.RemoveAll(dir)
+
+	set(t, ds, "key", disk.NoExpiration, "val")
+
+	err := filepath.Walk(filepath.Join(dir, "data"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			return ioutil.WriteFile(path, []byte("garbage"), 0644)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ds.Get("key")
+	if err != disk.ErrCorrupt {
+		t.Errorf("wrong err: expected: %v actual: %v", disk.ErrCorrupt, err)
+	}
+
+	// The corrupt file is overwritten
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+	remember.Cache(ctx, ds, "key", disk.NoExpiration, slowQuery)
+	assertFound(t, ds, "key", true)
+}
+
+func TestMultipleStores(t *testing.T) {
+	ds1, dir := newStore(t, disk.Config{MaxBytes: 50000})
+	defer os.RemoveAll(dir)
+
+	// Each store has its own lock file handle, as separate processes would.
+	ds2, err := disk.NewDiskStore(dir, disk.Config{MaxBytes: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g, ds := range []*disk.DiskStore{ds1, ds2, ds1, ds2} {
+		wg.Add(1)
+		go func(g int, ds *disk.DiskStore) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key-%d", i%50)
+				var val interface{} = strings.Repeat("x", 500)
+				if err := ds.Set(key, time.Minute, &val); err != nil {
+					t.Errorf("set: %v", err)
+				}
+				if _, _, err := ds.Get(key); err != nil {
+					t.Errorf("get: %v", err)
+				}
+				if i%40 == 0 && g == 0 {
+					if err := ds.ForgetAll(); err != nil {
+						t.Errorf("forget all: %v", err)
+					}
+				}
+			}
+		}(g, ds)
+	}
+	wg.Wait()
+
+	// No temporary files are left behind
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasPrefix(info.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %v", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFound(t *testing.T, ds *disk.DiskStore, key string, expected bool) {
+	t.Helper()
+
+	_, found, err := ds.Get(key)
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if found != expected {
+		t.Errorf("wrong found for %q: expected: %v actual: %v", key, expected, found)
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	var n int
+	err := filepath.Walk(filepath.Join(dir, "data"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func dataSize(t *testing.T, dir string) int64 {
+	t.Helper()
+
+	var size int64
+	err := filepath.Walk(filepath.Join(dir, "data"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return size
+}
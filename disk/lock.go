@@ -0,0 +1,80 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package disk
+
+import (
+	"os"
+	"sync"
+)
+
+// fileLock is a readers-writer lock that excludes both goroutines within
+// this process and other processes that use the same lock file.
+//
+// File locks are held per open file, so the shared file lock is acquired
+// by the first reader and released by the last.
+type fileLock struct {
+	f  *os.File
+	rw sync.RWMutex
+
+	mu      sync.Mutex // guards readers
+	readers int
+}
+
+func newFileLock(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+// RLock acquires a shared lock.
+func (l *fileLock) RLock() error {
+	l.rw.RLock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.readers == 0 {
+		if err := lockFile(l.f, false); err != nil {
+			l.rw.RUnlock()
+			return err
+		}
+	}
+	l.readers++
+	return nil
+}
+
+// RUnlock releases a shared lock.
+func (l *fileLock) RUnlock() {
+	l.mu.Lock()
+	l.readers--
+	if l.readers == 0 {
+		unlockFile(l.f)
+	}
+	l.mu.Unlock()
+
+	l.rw.RUnlock()
+}
+
+// Lock acquires an exclusive lock.
+func (l *fileLock) Lock() error {
+	l.rw.Lock()
+
+	if err := lockFile(l.f, true); err != nil {
+		l.rw.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Unlock releases an exclusive lock.
+func (l *fileLock) Unlock() {
+	unlockFile(l.f)
+	l.rw.Unlock()
+}
+
+// Close closes the lock file.
+func (l *fileLock) Close() error {
+	return l.f.Close()
+}
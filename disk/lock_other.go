@@ -0,0 +1,19 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+//go:build plan9 || js || wasip1
+// +build plan9 js wasip1
+
+package disk
+
+import "os"
+
+// File locking is not supported on these platforms. Only goroutines within
+// the same process are excluded.
+
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
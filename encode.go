@@ -0,0 +1,413 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedType signifies that a value can not be encoded into a key.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// maxDepth limits the nesting of encoded values in order to detect cycles.
+const maxDepth = 64
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// EncodeKey generates a key by deterministically encoding v as compact JSON.
+//
+//   - Struct fields and map keys are sorted.
+//   - Only exported struct fields are encoded. Fields of embedded structs are
+//     promoted (as with the json package).
+//   - The "remember" struct tag can be used to rename ("name") or ignore ("-")
+//     a field, or omit it when it has its zero value (",omitempty"). If not
+//     present, the "json" struct tag is used.
+//   - time.Time values are encoded in UTC using RFC 3339.
+//   - Types that implement encoding.TextMarshaler are encoded as strings.
+//   - Pointers and interfaces are encoded as the value they point to.
+//
+// Channels, functions and complex numbers can not be encoded. Neither can
+// cyclic data structures.
+func EncodeKey(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(v), 0); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value, depth int) error {
+
+	if depth > maxDepth {
+		return fmt.Errorf("remember: maximum depth exceeded (cyclic data structure?)")
+	}
+
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	// Dereference pointers and interfaces
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Kind() == reflect.Ptr && v.Type().Implements(textMarshalerType) && v.Type().Elem() != timeType {
+			return encodeText(buf, v)
+		}
+		v = v.Elem()
+		depth++
+	}
+
+	t := v.Type()
+
+	if t == timeType {
+		writeString(buf, v.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+		return nil
+	}
+
+	if t.Implements(textMarshalerType) {
+		return encodeText(buf, v)
+	}
+	if reflect.PtrTo(t).Implements(textMarshalerType) {
+		// MarshalText has a pointer receiver, so use an addressable copy
+		p := reflect.New(t)
+		p.Elem().Set(v)
+		return encodeText(buf, p)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			writeString(buf, strconv.FormatFloat(f, 'g', -1, 64))
+		} else {
+			buf.WriteString(strconv.FormatFloat(f, 'g', -1, t.Bits()))
+		}
+	case reflect.String:
+		writeString(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			writeString(buf, base64.StdEncoding.EncodeToString(v.Bytes()))
+			return nil
+		}
+		return encodeList(buf, v, depth)
+	case reflect.Array:
+		return encodeList(buf, v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeMap(buf, v, depth)
+	case reflect.Struct:
+		return encodeStruct(buf, v, depth)
+	default:
+		return fmt.Errorf("remember: %w: %v", ErrUnsupportedType, t)
+	}
+	return nil
+}
+
+func encodeText(buf *bytes.Buffer, v reflect.Value) error {
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return err
+	}
+	writeString(buf, string(text))
+	return nil
+}
+
+func encodeList(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	buf.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeValue(buf, v.Index(i), depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func encodeMap(buf *bytes.Buffer, v reflect.Value, depth int) error {
+
+	type entry struct {
+		key, val string
+	}
+
+	entries := make([]entry, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		key, err := mapKey(k)
+		if err != nil {
+			return err
+		}
+
+		var val bytes.Buffer
+		if err := encodeValue(&val, v.MapIndex(k), depth+1); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key, val.String()})
+	}
+
+	// Different keys can have the same string form (eg. 1 and "1" in a map[interface{}]),
+	// so the values are also compared.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return entries[i].val < entries[j].val
+	})
+
+	buf.WriteByte('{')
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, e.key)
+		buf.WriteByte(':')
+		buf.WriteString(e.val)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// mapKey converts a map key to a string.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.Interface {
+		if k.IsNil() {
+			return "null", nil
+		}
+		k = k.Elem()
+	}
+
+	if k.Type() == timeType {
+		return k.Interface().(time.Time).UTC().Format(time.RFC3339Nano), nil
+	}
+	if k.Type().Implements(textMarshalerType) {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "null", nil
+		}
+		text, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(k.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(k.Float(), 'g', -1, k.Type().Bits()), nil
+	}
+
+	// Other comparable types (eg. structs) are encoded
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, k, 0); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// field is an encodable struct field.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value, depth int) error {
+
+	fields := structFields(v.Type())
+
+	buf.WriteByte('{')
+	first := true
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok {
+			continue // Nil embedded pointer
+		}
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		writeString(buf, f.name)
+		buf.WriteByte(':')
+		if err := encodeValue(buf, fv, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// structFields returns the encodable fields of t sorted by name.
+// The rules for embedded structs and name conflicts follow the json package.
+func structFields(t reflect.Type) []field {
+
+	var all []field
+
+	var walk func(t reflect.Type, index []int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, visited map[reflect.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+
+			name, opts, ok := fieldTag(sf)
+			if name == "-" && !ok {
+				continue
+			}
+
+			idx := append(append([]int(nil), index...), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+				// Promote the fields of the embedded struct
+				walk(ft, idx, visited)
+				continue
+			}
+
+			if sf.PkgPath != "" {
+				// Not exported
+				continue
+			}
+
+			f := field{name: name, index: idx, omitEmpty: strings.Contains(opts, "omitempty"), tagged: name != ""}
+			if f.name == "" {
+				f.name = sf.Name
+			}
+			all = append(all, f)
+		}
+
+		delete(visited, t)
+	}
+	walk(t, nil, map[reflect.Type]bool{})
+
+	// Resolve name conflicts: the shallowest field wins. At the same depth,
+	// a tagged field wins. Otherwise all conflicting fields are dropped.
+	byName := map[string][]field{}
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	out := make([]field, 0, len(byName))
+	for _, fs := range byName {
+		sort.SliceStable(fs, func(i, j int) bool {
+			if len(fs[i].index) != len(fs[j].index) {
+				return len(fs[i].index) < len(fs[j].index)
+			}
+			return fs[i].tagged && !fs[j].tagged
+		})
+		if len(fs) > 1 && len(fs[0].index) == len(fs[1].index) && fs[0].tagged == fs[1].tagged {
+			continue
+		}
+		out = append(out, fs[0])
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// fieldTag returns the name and options of a field from its "remember" tag,
+// falling back to its "json" tag. ok reports whether "-" is a literal name
+// (ie. the tag is "-,").
+func fieldTag(sf reflect.StructField) (name, opts string, ok bool) {
+	tag, found := sf.Tag.Lookup("remember")
+	if !found {
+		tag = sf.Tag.Get("json")
+	}
+	if tag == "-," {
+		return "-", "", true
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:], false
+	}
+	return tag, "", false
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false
+// if a nil embedded pointer is encountered.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmpty reports whether v is empty according to the json package's omitempty rules.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
@@ -0,0 +1,130 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+type Paging struct {
+	Page  int
+	Limit int `json:"limit,omitempty"`
+}
+
+type filter struct {
+	Paging
+	Search  string `remember:"q"`
+	IDs     []int  `json:"ids"`
+	Tags    map[string]bool
+	Sort    *string `json:"sort"`
+	Nested  struct{ A, B int }
+	Secret  string   `remember:"-" json:"secret"`
+	JSONKey string   `json:"jk" remember:"rk,omitempty"`
+	Arr     [2]uint8 `json:"-"`
+}
+
+func TestEncodeKey(t *testing.T) {
+
+	f := filter{
+		Paging: Paging{Page: 2},
+		Search: "golang",
+		IDs:    []int{3, 1},
+		Tags:   map[string]bool{"z": true, "a": false},
+		Secret: "ignored",
+	}
+
+	actual, err := remember.EncodeKey(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Nested":{"A":0,"B":0},"Page":2,"Tags":{"a":false,"z":true},"ids":[3,1],"q":"golang","sort":null}`
+	if actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Pointers produce the same key
+	if ptr, _ := remember.EncodeKey(&f); ptr != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, ptr)
+	}
+
+	// Slices form part of the key
+	f.IDs = []int{3, 2}
+	if other, _ := remember.EncodeKey(f); other == expected {
+		t.Errorf("expected different key for different slice")
+	}
+
+	// Map insertion order does not matter
+	for i := 0; i < 10; i++ {
+		m := map[interface{}]int{}
+		for _, k := range []interface{}{"b", 1, "1", "a", 2.5} {
+			m[k] = len(m)
+		}
+		actual, err := remember.EncodeKey(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"1":1,"1":2,"2.5":4,"a":3,"b":0}`
+		if actual != expected {
+			t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+		}
+	}
+}
+
+func TestEncodeKeyTimeAndTextMarshaler(t *testing.T) {
+
+	type key struct {
+		At time.Time
+		IP net.IP
+	}
+
+	utc := time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC)
+	local := utc.In(time.FixedZone("AEST", 10*60*60))
+
+	k1, err := remember.EncodeKey(key{utc, net.ParseIP("10.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := remember.EncodeKey(key{local, net.ParseIP("10.0.0.1")})
+
+	expected := `{"At":"2021-01-02T03:04:05.000000006Z","IP":"10.0.0.1"}`
+	if k1 != expected || k2 != expected {
+		t.Errorf("wrong val: expected: %v actual: %v %v", expected, k1, k2)
+	}
+}
+
+func TestEncodeKeyErrors(t *testing.T) {
+
+	type node struct {
+		Next *node
+	}
+	cyclic := &node{}
+	cyclic.Next = cyclic
+
+	for _, v := range []interface{}{
+		struct{ C chan int }{make(chan int)},
+		[]interface{}{func() {}},
+		complex(1, 2),
+		cyclic,
+	} {
+		if _, err := remember.EncodeKey(v); err == nil {
+			t.Errorf("expected error for %T", v)
+		}
+	}
+
+	_, err := remember.EncodeKey(struct{ C chan int }{})
+	if !errors.Is(err, remember.ErrUnsupportedType) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrUnsupportedType, err)
+	}
+
+	// CreateKeyStruct does not panic
+	for _, v := range []interface{}{nil, 1, "string", cyclic} {
+		if actual := remember.CreateKeyStruct(v); actual != "" {
+			t.Errorf("wrong val: expected: %v actual: %v", "", actual)
+		}
+	}
+}
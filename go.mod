@@ -1,3 +1,14 @@
 module github.com/rocketlaunchr/remember-go
 
 go 1.12
+
+require (
+	github.com/alicebob/miniredis/v2 v2.30.0
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
+	github.com/cespare/xxhash/v2 v2.1.1
+	github.com/dgraph-io/ristretto v0.2.0
+	github.com/gomodule/redigo v1.8.9
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/patrickmn/go-cache v2.1.0+incompatible
+	go.etcd.io/bbolt v1.3.6
+)
@@ -0,0 +1,24 @@
+module github.com/rocketlaunchr/remember-go/grpccache
+
+go 1.24.0
+
+require (
+	github.com/alicebob/miniredis/v2 v2.30.0
+	github.com/gomodule/redigo v1.8.9
+	github.com/rocketlaunchr/remember-go v0.0.0
+	google.golang.org/grpc v1.79.3
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
+	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64 // indirect
+	golang.org/x/net v0.48.0 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
+)
+
+replace github.com/rocketlaunchr/remember-go => ../
@@ -0,0 +1,310 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package grpccache provides gRPC unary interceptors that cache responses.
+//
+// By default, cached responses are shared by all callers: the key only depends
+// on the method and the request. If responses depend on the caller (eg. on the
+// "authorization" metadata), list the metadata in Config.KeyMetadata.
+package grpccache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultKeyPrefix is the prefix of keys used when Config.KeyPrefix is not set.
+const DefaultKeyPrefix = "grpccache"
+
+// DefaultBypassKey is the metadata key used when Config.BypassKey is not set.
+const DefaultBypassKey = "x-remember-fresh"
+
+// Codec converts responses to and from the bytes that are stored in the cache.
+// It is compatible with grpc's encoding.Codec.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Config is used to configure the interceptors.
+type Config struct {
+
+	// Methods lists the full method names (eg. "/package.Service/Method") that
+	// are cached along with their expiration. Other methods are not cached.
+	Methods map[string]time.Duration
+
+	// Responses registers the response type of methods in Methods up front
+	// (eg. "/package.Service/Method": &pb.Reply{}). The server interceptor can
+	// only decode cached responses of methods whose response type is known.
+	// Otherwise the type is learnt when the method is first served by this process.
+	Responses map[string]interface{}
+
+	// KeyPrefix is prepended to every key.
+	// If not set, DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// KeyMetadata lists the metadata keys (eg. "authorization") whose values
+	// form part of the key (they are hashed). The server interceptor uses the
+	// incoming metadata and the client interceptor uses the outgoing metadata.
+	// If not set, responses are shared by all callers.
+	KeyMetadata []string
+
+	// BypassKey is the metadata key that, when set to a value other than
+	// "0" or "false", ignores the cached response and stores a fresh one.
+	// If not set, DefaultBypassKey is used.
+	BypassKey string
+
+	// Codec is used to store responses.
+	// If not set, responses are stored using protobuf.
+	Codec Codec
+
+	// Options is used when calling remember.Cache.
+	// UseFreshData is set when the bypass metadata is present.
+	Options remember.Options
+}
+
+func (c Config) withDefaults() Config {
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = DefaultKeyPrefix
+	}
+	if c.BypassKey == "" {
+		c.BypassKey = DefaultBypassKey
+	}
+	c.BypassKey = strings.ToLower(c.BypassKey)
+	keys := make([]string, 0, len(c.KeyMetadata))
+	for _, k := range c.KeyMetadata {
+		keys = append(keys, strings.ToLower(k))
+	}
+	c.KeyMetadata = keys
+	if c.Codec == nil {
+		c.Codec = protoCodec{}
+	}
+	return c
+}
+
+// WithFreshData returns a context that instructs the interceptors to ignore
+// the cached response. It is used by clients and sets DefaultBypassKey.
+// Use Config.WithFreshData when BypassKey is customized.
+func WithFreshData(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, DefaultBypassKey, "1")
+}
+
+// WithFreshData returns a context that instructs the interceptors to ignore
+// the cached response. It is used by clients and sets c.BypassKey.
+func (c Config) WithFreshData(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, c.withDefaults().BypassKey, "1")
+}
+
+// UnaryServerInterceptor returns a server interceptor that caches the
+// responses of the methods listed in cfg.Methods.
+//
+// The key is derived from the full method name, the request and the incoming
+// metadata listed in cfg.KeyMetadata. Responses
+// that can not be decoded (eg. stored by another process before this process
+// served the method) are treated as a cache miss.
+func UnaryServerInterceptor(c remember.Conner, cfg Config) grpc.UnaryServerInterceptor {
+
+	conf := cfg.withDefaults()
+
+	// types records the response type of each method so that cached
+	// responses can be decoded.
+	var types sync.Map
+	for method, resp := range conf.Responses {
+		types.Store(method, reflect.TypeOf(resp))
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		expiration, ok := conf.Methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		key, err := requestKey(conf.KeyPrefix, info.FullMethod, req, md, conf.KeyMetadata)
+		if err != nil {
+			return handler(ctx, req)
+		}
+
+		opts := conf.Options
+		if bypass(md, conf.BypassKey) {
+			opts.UseFreshData = true
+		}
+
+		var (
+			called     bool
+			resp       interface{}
+			handlerErr error
+		)
+
+		serve := func(ctx context.Context) (interface{}, error) {
+			called = true
+			resp, handlerErr = handler(ctx, req)
+			if handlerErr == nil {
+				types.Store(info.FullMethod, reflect.TypeOf(resp))
+			}
+			return resp, handlerErr
+		}
+
+		slowQuery := func(ctx context.Context) (interface{}, error) {
+			if _, err := serve(ctx); err != nil {
+				return nil, err
+			}
+			return conf.Codec.Marshal(resp)
+		}
+
+		out, _, err := remember.Cache(ctx, c, key, expiration, slowQuery, opts)
+		if called {
+			return resp, handlerErr
+		}
+		if err != nil {
+			// Cache is unavailable
+			return serve(ctx)
+		}
+
+		typ, ok := types.Load(info.FullMethod)
+		if !ok || typ.(reflect.Type).Kind() != reflect.Ptr {
+			return serve(ctx)
+		}
+
+		b, ok := out.([]byte)
+		if !ok {
+			return serve(ctx)
+		}
+
+		msg := reflect.New(typ.(reflect.Type).Elem()).Interface()
+		if err := conf.Codec.Unmarshal(b, msg); err != nil {
+			return serve(ctx)
+		}
+		return msg, nil
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor that caches the
+// responses of the methods listed in cfg.Methods.
+//
+// The key is derived from the full method name, the request and the outgoing
+// metadata listed in cfg.KeyMetadata.
+func UnaryClientInterceptor(c remember.Conner, cfg Config) grpc.UnaryClientInterceptor {
+
+	conf := cfg.withDefaults()
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+
+		expiration, ok := conf.Methods[method]
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		md, _ := metadata.FromOutgoingContext(ctx)
+
+		key, err := requestKey(conf.KeyPrefix, method, req, md, conf.KeyMetadata)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		opts := conf.Options
+		if bypass(md, conf.BypassKey) {
+			opts.UseFreshData = true
+		}
+
+		var (
+			called    bool
+			invokeErr error
+		)
+
+		slowQuery := func(ctx context.Context) (interface{}, error) {
+			called = true
+			invokeErr = invoker(ctx, method, req, reply, cc, callOpts...)
+			if invokeErr != nil {
+				return nil, invokeErr
+			}
+			return conf.Codec.Marshal(reply)
+		}
+
+		out, _, err := remember.Cache(ctx, c, key, expiration, slowQuery, opts)
+		if called {
+			return invokeErr
+		}
+		if err != nil {
+			// Cache is unavailable
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		b, ok := out.([]byte)
+		if !ok || conf.Codec.Unmarshal(b, reply) != nil {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		return nil
+	}
+}
+
+// requestKey generates a key from the full method name, the request and the
+// values of the metadata keys listed in keys.
+//
+// The request is serialized using encoding/json, which only considers exported
+// fields (ignoring protobuf's internal state) and sorts map keys. The result
+// is therefore deterministic and does not depend on the protobuf wire format.
+func requestKey(prefix, method string, req interface{}, md metadata.MD, keys []string) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	args := []interface{}{prefix, method, hex.EncodeToString(sum[:])}
+
+	if len(keys) > 0 {
+		values := make([][]string, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, md.Get(k))
+		}
+		b, err := json.Marshal(values)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(b)
+		args = append(args, hex.EncodeToString(sum[:]))
+	}
+	return remember.CreateKey(false, "|", "prefix|method|request|metadata", args...), nil
+}
+
+// bypass reports whether md instructs the cache to be bypassed.
+func bypass(md metadata.MD, key string) bool {
+	for _, v := range md.Get(key) {
+		if v != "" && v != "0" && !strings.EqualFold(v, "false") {
+			return true
+		}
+	}
+	return false
+}
+
+// protoCodec stores responses using protobuf.
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("grpccache: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("grpccache: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
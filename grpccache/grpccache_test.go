@@ -0,0 +1,267 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package grpccache_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/grpccache"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var ctx = context.Background()
+
+const (
+	echoMethod     = "/test.Echo/Echo"
+	uncachedMethod = "/test.Echo/Uncached"
+)
+
+// echoServer responds with the request and the number of times it has been called.
+type echoServer struct {
+	calls int32
+}
+
+func (s *echoServer) echo(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	return wrapperspb.String(fmt.Sprintf("%s:%d", req.GetValue(), n)), nil
+}
+
+func handler(method string) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(wrapperspb.StringValue)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		h := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.(*echoServer).echo(ctx, req.(*wrapperspb.StringValue))
+		}
+		if interceptor == nil {
+			return h(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, h)
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: handler(echoMethod)},
+		{MethodName: "Uncached", Handler: handler(uncachedMethod)},
+	},
+}
+
+// start starts a server and returns a client connected to it.
+func start(t *testing.T, srv *echoServer, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(serverOpts...)
+	s.RegisterService(&serviceDesc, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func call(t *testing.T, ctx context.Context, cc *grpc.ClientConn, method, val string) string {
+	t.Helper()
+
+	reply := new(wrapperspb.StringValue)
+	if err := cc.Invoke(ctx, method, wrapperspb.String(val), reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply.GetValue()
+}
+
+func assertEqual(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	if actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestServerInterceptor(t *testing.T) {
+	srv := &echoServer{}
+	cc := start(t, srv, []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(memory.NewMemoryStore(time.Minute), grpccache.Config{
+			Methods: map[string]time.Duration{echoMethod: time.Minute},
+		})),
+	})
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "b:2", call(t, ctx, cc, echoMethod, "b"))
+
+	// Methods not in the allowlist are not cached
+	assertEqual(t, "a:3", call(t, ctx, cc, uncachedMethod, "a"))
+	assertEqual(t, "a:4", call(t, ctx, cc, uncachedMethod, "a"))
+
+	// Bypass metadata refreshes the cached response
+	assertEqual(t, "a:5", call(t, grpccache.WithFreshData(ctx), cc, echoMethod, "a"))
+	assertEqual(t, "a:5", call(t, ctx, cc, echoMethod, "a"))
+
+	// "false" does not bypass the cache
+	md := metadata.AppendToOutgoingContext(ctx, grpccache.DefaultBypassKey, "false")
+	assertEqual(t, "a:5", call(t, md, cc, echoMethod, "a"))
+}
+
+func TestClientInterceptor(t *testing.T) {
+	srv := &echoServer{}
+	cc := start(t, srv, nil,
+		grpc.WithUnaryInterceptor(grpccache.UnaryClientInterceptor(memory.NewMemoryStore(time.Minute), grpccache.Config{
+			Methods:   map[string]time.Duration{echoMethod: time.Minute},
+			BypassKey: "Fresh",
+		})),
+	)
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:2", call(t, ctx, cc, uncachedMethod, "a"))
+
+	md := metadata.AppendToOutgoingContext(ctx, "fresh", "1")
+	assertEqual(t, "a:3", call(t, md, cc, echoMethod, "a"))
+	assertEqual(t, "a:3", call(t, ctx, cc, echoMethod, "a"))
+
+	if srv.calls != 3 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 3, srv.calls)
+	}
+}
+
+func TestCustomBypassKey(t *testing.T) {
+	cfg := grpccache.Config{
+		Methods:   map[string]time.Duration{echoMethod: time.Minute},
+		BypassKey: "Fresh",
+	}
+
+	srv := &echoServer{}
+	cc := start(t, srv, []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(memory.NewMemoryStore(time.Minute), cfg)),
+	})
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:2", call(t, cfg.WithFreshData(ctx), cc, echoMethod, "a"))
+	assertEqual(t, "a:2", call(t, ctx, cc, echoMethod, "a"))
+}
+
+func TestKeyMetadata(t *testing.T) {
+	srv := &echoServer{}
+	cc := start(t, srv, []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(memory.NewMemoryStore(time.Minute), grpccache.Config{
+			Methods:     map[string]time.Duration{echoMethod: time.Minute},
+			KeyMetadata: []string{"Authorization"},
+		})),
+	})
+
+	alice := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice")
+	bob := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer bob")
+
+	assertEqual(t, "a:1", call(t, alice, cc, echoMethod, "a"))
+	assertEqual(t, "a:1", call(t, alice, cc, echoMethod, "a"))
+
+	// Callers with different credentials don't share responses
+	assertEqual(t, "a:2", call(t, bob, cc, echoMethod, "a"))
+	assertEqual(t, "a:3", call(t, ctx, cc, echoMethod, "a"))
+
+	// Other metadata is ignored
+	assertEqual(t, "a:2", call(t, metadata.AppendToOutgoingContext(bob, "x-request-id", "1"), cc, echoMethod, "a"))
+}
+
+func TestResponses(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	cfg := grpccache.Config{
+		Methods:   map[string]time.Duration{echoMethod: time.Minute},
+		Responses: map[string]interface{}{echoMethod: &wrapperspb.StringValue{}},
+	}
+
+	// The response is cached by another process
+	srv1 := &echoServer{}
+	cc1 := start(t, srv1, []grpc.ServerOption{grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(ms, cfg))})
+	assertEqual(t, "a:1", call(t, ctx, cc1, echoMethod, "a"))
+
+	// A new process serves the cached response without calling the handler first
+	srv2 := &echoServer{}
+	cc2 := start(t, srv2, []grpc.ServerOption{grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(ms, cfg))})
+	assertEqual(t, "a:1", call(t, ctx, cc2, echoMethod, "a"))
+
+	if srv2.calls != 0 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 0, srv2.calls)
+	}
+}
+
+func TestPerMethodExpiration(t *testing.T) {
+	srv := &echoServer{}
+	cc := start(t, srv, []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(memory.NewMemoryStore(time.Minute), grpccache.Config{
+			Methods: map[string]time.Duration{
+				echoMethod:     time.Minute,
+				uncachedMethod: 10 * time.Millisecond,
+			},
+		})),
+	})
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:2", call(t, ctx, cc, uncachedMethod, "a"))
+
+	time.Sleep(20 * time.Millisecond)
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:3", call(t, ctx, cc, uncachedMethod, "a"))
+}
+
+func TestRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	cfg := grpccache.Config{
+		Methods: map[string]time.Duration{echoMethod: time.Minute},
+		Options: remember.Options{OnlyLogErrors: true},
+	}
+
+	srv := &echoServer{}
+	cc := start(t, srv, []grpc.ServerOption{grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(rs, cfg))})
+
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+	assertEqual(t, "a:1", call(t, ctx, cc, echoMethod, "a"))
+
+	// A new server process can not decode the response until it has served the method once
+	srv2 := &echoServer{calls: 10}
+	cc2 := start(t, srv2, []grpc.ServerOption{grpc.UnaryInterceptor(grpccache.UnaryServerInterceptor(rs, cfg))})
+
+	assertEqual(t, "a:11", call(t, ctx, cc2, echoMethod, "a"))
+	assertEqual(t, "a:1", call(t, ctx, cc2, echoMethod, "a"))
+}
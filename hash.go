@@ -0,0 +1,148 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Hasher converts a key into a fixed length hashed version.
+type Hasher interface {
+	Hash(key string) string
+}
+
+// HasherFunc allows an ordinary function to be used as a Hasher.
+type HasherFunc func(key string) string
+
+// Hash calls f(key).
+func (f HasherFunc) Hash(key string) string {
+	return f(key)
+}
+
+var (
+	// CRC32 hashes keys using crc32 (see Hash).
+	// It produces short keys but collisions are likely once there are many keys.
+	CRC32 Hasher = HasherFunc(Hash)
+
+	// SHA256 hashes keys using sha256. The output is 64 hex characters.
+	// It is collision resistant and suitable for keys derived from user input.
+	SHA256 Hasher = HasherFunc(func(key string) string {
+		h := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(h[:])
+	})
+
+	// FNV64 hashes keys using 64-bit FNV-1a. The output is 16 hex characters.
+	FNV64 Hasher = HasherFunc(func(key string) string {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		return fmt.Sprintf("%016x", h.Sum64())
+	})
+
+	// XXHash64 hashes keys using 64-bit xxHash. The output is 16 hex characters.
+	// It is the fastest of the provided hashers.
+	XXHash64 Hasher = HasherFunc(func(key string) string {
+		return fmt.Sprintf("%016x", xxhash.Sum64String(key))
+	})
+)
+
+// HashKey returns key unaltered if it is at most maxLen bytes long.
+// Otherwise h is used to hash it. Hashed keys are prefixed with "#".
+// If maxLen is not positive, key is always hashed.
+//
+// So that they can't collide with hashed keys, keys that start with "#" are
+// prefixed with another "#" (and hashed if they then exceed maxLen).
+//
+// Example:
+//
+//	key := remember.HashKey(remember.SHA256, remember.CreateKeyStruct(filter), 128)
+func HashKey(h Hasher, key string, maxLen int) string {
+	if strings.HasPrefix(key, "#") {
+		if maxLen > 0 && len(key)+1 <= maxLen {
+			return "#" + key
+		}
+	} else if maxLen > 0 && len(key) <= maxLen {
+		return key
+	}
+	return "#" + h.Hash(key)
+}
+
+// HashKeys wraps c so that keys longer than maxLen bytes are hashed using h
+// (see HashKey) before being passed to the storage driver.
+//
+// The returned Conner's Cacher implements CASCacher if c's does, and the
+// returned Conner validates the hashed keys if c implements KeyValidator.
+func HashKeys(c Conner, h Hasher, maxLen int) Conner {
+	return &hashConner{c, h, maxLen}
+}
+
+type hashConner struct {
+	Conner
+	hasher Hasher
+	maxLen int
+}
+
+// ValidateKey validates the key passed to the storage driver (if it implements KeyValidator).
+func (hc *hashConner) ValidateKey(key string) error {
+	if kv, ok := hc.Conner.(KeyValidator); ok {
+		return kv.ValidateKey(HashKey(hc.hasher, key, hc.maxLen))
+	}
+	return nil
+}
+
+func (hc *hashConner) Conn(ctx context.Context) (Cacher, error) {
+	cache, err := hc.Conner.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hcr := &hashCacher{cache, hc}
+	if cc, ok := cache.(CASCacher); ok {
+		return &hashCASCacher{hcr, cc}, nil
+	}
+	return hcr, nil
+}
+
+type hashCacher struct {
+	Cacher
+	hc *hashConner
+}
+
+func (c *hashCacher) key(key string) string {
+	return HashKey(c.hc.hasher, key, c.hc.maxLen)
+}
+
+func (c *hashCacher) Get(key string) (interface{}, bool, error) {
+	return c.Cacher.Get(c.key(key))
+}
+
+func (c *hashCacher) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	return c.Cacher.Set(c.key(key), expiration, itemToStore)
+}
+
+func (c *hashCacher) Forget(key string) error {
+	return c.Cacher.Forget(c.key(key))
+}
+
+type hashCASCacher struct {
+	*hashCacher
+	cc CASCacher
+}
+
+func (c *hashCASCacher) GetCAS(key string) (interface{}, uint64, bool, error) {
+	return c.cc.GetCAS(c.key(key))
+}
+
+func (c *hashCASCacher) Add(key string, expiration time.Duration, itemToStore interface{}) error {
+	return c.cc.Add(c.key(key), expiration, itemToStore)
+}
+
+func (c *hashCASCacher) CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error {
+	return c.cc.CompareAndSwap(c.key(key), expiration, itemToStore, cas)
+}
@@ -0,0 +1,149 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+)
+
+func TestHashers(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		hasher remember.Hasher
+		length int
+	}{
+		{"crc32", remember.CRC32, 8},
+		{"sha256", remember.SHA256, 64},
+		{"fnv64", remember.FNV64, 16},
+		{"xxhash64", remember.XXHash64, 16},
+	}
+
+	for _, tt := range tests {
+		h1 := tt.hasher.Hash("key1")
+		h2 := tt.hasher.Hash("key2")
+
+		if len(h1) != tt.length {
+			t.Errorf("%s: wrong length: expected: %v actual: %v", tt.name, tt.length, len(h1))
+		}
+		if h1 == h2 {
+			t.Errorf("%s: expected different hashes", tt.name)
+		}
+		if h1 != tt.hasher.Hash("key1") {
+			t.Errorf("%s: expected deterministic hash", tt.name)
+		}
+	}
+
+	expected := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	if actual := remember.SHA256.Hash("foo"); actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+
+	short := "search-golang-2"
+	if actual := remember.HashKey(remember.SHA256, short, 32); actual != short {
+		t.Errorf("wrong val: expected: %v actual: %v", short, actual)
+	}
+
+	long := strings.Repeat("x", 33)
+	expected := "#" + remember.FNV64.Hash(long)
+	if actual := remember.HashKey(remember.FNV64, long, 32); actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	expected = "#" + remember.FNV64.Hash(short)
+	if actual := remember.HashKey(remember.FNV64, short, 0); actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Keys that look like hashed keys don't collide with them
+	hashed := remember.HashKey(remember.FNV64, long, 32)
+	if actual := remember.HashKey(remember.FNV64, hashed, 32); actual != "#"+hashed {
+		t.Errorf("wrong val: expected: %v actual: %v", "#"+hashed, actual)
+	}
+
+	escaped := "#" + strings.Repeat("x", 31)
+	expected = "#" + remember.FNV64.Hash(escaped)
+	if actual := remember.HashKey(remember.FNV64, escaped, 32); actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+// strictStore rejects keys that are longer than 20 bytes or contain spaces.
+type strictStore struct {
+	*memory.MemoryStore
+}
+
+func (s strictStore) ValidateKey(key string) error {
+	if len(key) > 20 || strings.Contains(key, " ") {
+		return remember.ErrInvalidKey
+	}
+	return nil
+}
+
+func TestHashKeysValidateKey(t *testing.T) {
+	hs := remember.HashKeys(strictStore{memory.NewMemoryStore(10 * time.Minute)}, remember.FNV64, 20)
+
+	kv, ok := hs.(remember.KeyValidator)
+	if !ok {
+		t.Fatal("expected KeyValidator to be implemented")
+	}
+
+	// Long keys are accepted once hashed
+	if err := kv.ValidateKey(strings.Repeat("x y", 100)); err != nil {
+		t.Errorf("wrong err: expected: %v actual: %v", nil, err)
+	}
+
+	// Short keys are validated by the storage driver
+	if err := kv.ValidateKey("x y"); err != remember.ErrInvalidKey {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+
+	// Escaped keys are validated
+	if err := kv.ValidateKey("#" + strings.Repeat("x", 19)); err != nil {
+		t.Errorf("wrong err: expected: %v actual: %v", nil, err)
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+
+	ms := memory.NewMemoryStore(10 * time.Minute)
+	hs := remember.HashKeys(ms, remember.SHA256, 16)
+
+	key := remember.CreateKeyStruct(struct{ Search, Sort string }{"golang generics", "title"})
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	remember.Cache(ctx, hs, key, 10*time.Minute, slowQuery)
+
+	// The hashed key is stored in the underlying store
+	cache, _ := ms.Conn(ctx)
+	if _, found, _ := cache.Get(key); found {
+		t.Errorf("expected unhashed key to be missing")
+	}
+	if _, found, _ := cache.Get("#" + remember.SHA256.Hash(key)); !found {
+		t.Errorf("expected hashed key to be found")
+	}
+
+	actual, found, _ := remember.Cache(ctx, hs, key, 10*time.Minute, slowQuery)
+	if !found || actual.(string) != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+
+	hc, _ := hs.Conn(ctx)
+	if err := hc.Forget(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := hc.Get(key); found {
+		t.Errorf("expected key to be forgotten")
+	}
+}
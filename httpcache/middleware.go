@@ -0,0 +1,234 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultKeyPrefix is the prefix of keys used when Config.KeyPrefix is not set.
+const DefaultKeyPrefix = "httpcache"
+
+// Config is used to configure the Middleware.
+type Config struct {
+
+	// KeyPrefix is prepended to every key.
+	// If not set, DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// Vary lists the request headers that produce different responses.
+	// Their values form part of the key (credentials are hashed).
+	//
+	// Responses to requests with an "Authorization" or "Cookie" header are only
+	// stored if the header is listed, or the response is marked "public",
+	// "s-maxage" or "must-revalidate".
+	Vary []string
+
+	// Cacheable reports whether a response with the given status code
+	// should be cached. If not set, only 200 responses are cached.
+	Cacheable func(status int) bool
+
+	// Options is used when calling remember.Cache.
+	Options remember.Options
+}
+
+// response is a cached HTTP response.
+type response struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+}
+
+func init() {
+	gob.Register(response{})
+}
+
+// uncacheable is returned by the SlowRetrieve function so that the
+// response is not stored.
+type uncacheable struct {
+	resp response
+}
+
+func (u uncacheable) Error() string { return "uncacheable response" }
+
+// Middleware returns a middleware that caches the responses of GET and HEAD
+// requests. Other requests are passed through.
+//
+// The key is derived from the method, path, normalized query and the headers
+// listed in Config.Vary. A request with "Cache-Control: no-cache" refreshes the
+// cached response and "Cache-Control: no-store" bypasses the cache.
+//
+// The "X-Cache" response header is set to HIT or MISS and the "Age" header
+// contains the number of seconds since the response was cached.
+func Middleware(c remember.Conner, expiration time.Duration, cfg ...Config) func(http.Handler) http.Handler {
+
+	var conf Config
+	if len(cfg) > 0 {
+		conf = cfg[0]
+	}
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = DefaultKeyPrefix
+	}
+	if conf.Cacheable == nil {
+		conf.Cacheable = func(status int) bool { return status == http.StatusOK }
+	}
+
+	vary := make([]string, 0, len(conf.Vary))
+	for _, h := range conf.Vary {
+		vary = append(vary, http.CanonicalHeaderKey(h))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			opts := conf.Options
+			directives := cacheControl(r.Header)
+			if _, ok := directives["no-cache"]; ok || strings.Contains(r.Header.Get("Pragma"), "no-cache") {
+				opts.UseFreshData = true
+			}
+			if _, ok := directives["no-store"]; ok {
+				opts.DisableCacheUsage = true
+			}
+
+			clock := remember.ClockOrDefault(opts.Clock)
+
+			slowQuery := func(ctx context.Context) (interface{}, error) {
+				rec := newRecorder()
+				next.ServeHTTP(rec, r)
+
+				resp := response{
+					Status:   rec.status,
+					Header:   rec.header,
+					Body:     rec.body.Bytes(),
+					StoredAt: clock.Now(),
+				}
+
+				if !conf.Cacheable(resp.Status) || !storable(resp.Header) || !shareable(r, resp.Header, vary) {
+					return nil, uncacheable{resp}
+				}
+				return resp, nil
+			}
+
+			key := requestKey(conf.KeyPrefix, vary, r)
+
+			out, found, err := remember.Cache(r.Context(), c, key, expiration, slowQuery, opts)
+			if err != nil {
+				if u, ok := err.(uncacheable); ok {
+					writeResponse(w, u.resp, false, clock.Now())
+					return
+				}
+				// Cache is unavailable
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			writeResponse(w, out.(response), found, clock.Now())
+		})
+	}
+}
+
+// requestKey generates a key from the method, path, normalized query and
+// the vary headers (in canonical form) of r.
+func requestKey(prefix string, vary []string, r *http.Request) string {
+	args := []interface{}{prefix, r.Method, r.URL.Path, r.URL.Query().Encode()}
+	for _, h := range vary {
+		args = append(args, h+"="+strings.Join(varyValues(h, r.Header[h]), ","))
+	}
+	return remember.CreateKey(false, "|", "prefix|method|path|query|vary...", args...)
+}
+
+func writeResponse(w http.ResponseWriter, resp response, hit bool, now time.Time) {
+	h := w.Header()
+	for k, v := range resp.Header {
+		h[k] = append([]string(nil), v...)
+	}
+
+	if hit {
+		h.Set("X-Cache", "HIT")
+		age := now.Sub(resp.StoredAt) / time.Second
+		if age < 0 {
+			age = 0
+		}
+		h.Set("Age", strconv.FormatInt(int64(age), 10))
+	} else {
+		h.Set("X-Cache", "MISS")
+		h.Set("Age", "0")
+	}
+
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// storable reports whether a response with header h may be cached.
+func storable(h http.Header) bool {
+	if len(h["Set-Cookie"]) > 0 {
+		return false
+	}
+	directives := cacheControl(h)
+	for _, d := range []string{"no-store", "private"} {
+		if _, ok := directives[d]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheControl parses the Cache-Control header.
+func cacheControl(h http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, line := range h["Cache-Control"] {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if i := strings.Index(part, "="); i >= 0 {
+				directives[strings.ToLower(strings.TrimSpace(part[:i]))] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			} else {
+				directives[strings.ToLower(part)] = ""
+			}
+		}
+	}
+	return directives
+}
+
+// recorder records the response written by a handler.
+type recorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
@@ -0,0 +1,240 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package httpcache_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/httpcache"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+)
+
+// counter returns a handler that responds with the number of times it has been called.
+func counter(calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%d", n)
+	})
+}
+
+func do(t *testing.T, h http.Handler, method, target string, header ...string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func body(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHitAndMiss(t *testing.T) {
+	var calls int32
+	h := httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute)(counter(&calls))
+
+	resp := do(t, h, "GET", "/path?b=2&a=1")
+	if resp.Header.Get("X-Cache") != "MISS" || body(t, resp) != "1" {
+		t.Errorf("expected MISS")
+	}
+
+	// Query parameters are normalized
+	resp = do(t, h, "GET", "/path?a=1&b=2")
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "1" {
+		t.Errorf("expected HIT")
+	}
+
+	if resp.Header.Get("Age") == "" {
+		t.Errorf("expected Age header")
+	}
+
+	if resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("wrong content type: %v", resp.Header.Get("Content-Type"))
+	}
+
+	// Different path
+	resp = do(t, h, "GET", "/other")
+	if resp.Header.Get("X-Cache") != "MISS" || body(t, resp) != "2" {
+		t.Errorf("expected MISS")
+	}
+}
+
+func TestVary(t *testing.T) {
+	var calls int32
+	h := httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute, httpcache.Config{
+		Vary: []string{"Accept-Language"},
+	})(counter(&calls))
+
+	do(t, h, "GET", "/", "Accept-Language", "en")
+	do(t, h, "GET", "/", "Accept-Language", "fr")
+	resp := do(t, h, "GET", "/", "Accept-Language", "en")
+
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "1" {
+		t.Errorf("expected HIT")
+	}
+
+	if calls != 2 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 2, calls)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	var calls int32
+
+	// Responses to requests with credentials are not shared
+	h := httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute)(counter(&calls))
+
+	do(t, h, "GET", "/", "Authorization", "Bearer a")
+	resp := do(t, h, "GET", "/", "Authorization", "Bearer b")
+	if resp.Header.Get("X-Cache") != "MISS" || body(t, resp) != "2" {
+		t.Errorf("expected MISS")
+	}
+
+	// Unless the credentials are part of the key
+	calls = 0
+	h = httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute, httpcache.Config{
+		Vary: []string{"Authorization"},
+	})(counter(&calls))
+
+	do(t, h, "GET", "/", "Authorization", "Bearer a")
+	do(t, h, "GET", "/", "Authorization", "Bearer b")
+	resp = do(t, h, "GET", "/", "Authorization", "Bearer a")
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "1" {
+		t.Errorf("expected HIT")
+	}
+	if calls != 2 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 2, calls)
+	}
+
+	// Or the response is public
+	calls = 0
+	public := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public")
+		counter(&calls).ServeHTTP(w, r)
+	})
+	h = httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute)(public)
+
+	do(t, h, "GET", "/", "Cookie", "session=a")
+	resp = do(t, h, "GET", "/", "Cookie", "session=b")
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "1" {
+		t.Errorf("expected HIT")
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	var calls int32
+	h := httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute)(counter(&calls))
+
+	do(t, h, "GET", "/")
+
+	// no-cache refreshes the cached response
+	resp := do(t, h, "GET", "/", "Cache-Control", "no-cache")
+	if resp.Header.Get("X-Cache") != "MISS" || body(t, resp) != "2" {
+		t.Errorf("expected MISS")
+	}
+
+	resp = do(t, h, "GET", "/")
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "2" {
+		t.Errorf("expected HIT of refreshed response")
+	}
+
+	// no-store bypasses the cache
+	resp = do(t, h, "GET", "/", "Cache-Control", "no-store")
+	if resp.Header.Get("X-Cache") != "MISS" || body(t, resp) != "3" {
+		t.Errorf("expected MISS")
+	}
+
+	resp = do(t, h, "GET", "/")
+	if body(t, resp) != "2" {
+		t.Errorf("no-store response was cached")
+	}
+}
+
+func TestUncacheableResponses(t *testing.T) {
+	var calls int32
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/error":
+			http.Error(w, "error", http.StatusInternalServerError)
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		case "/private":
+			w.Header().Set("Cache-Control", "private")
+		}
+	})
+
+	h := httpcache.Middleware(memory.NewMemoryStore(time.Minute), time.Minute)(handler)
+
+	for _, path := range []string{"/error", "/cookie", "/private"} {
+		calls = 0
+
+		first := do(t, h, "GET", path)
+		do(t, h, "GET", path)
+
+		if calls != 2 {
+			t.Errorf("%v: response was cached", path)
+		}
+
+		if path == "/error" && first.StatusCode != http.StatusInternalServerError {
+			t.Errorf("wrong status: expected: %v actual: %v", http.StatusInternalServerError, first.StatusCode)
+		}
+	}
+
+	// Other methods are not cached
+	calls = 0
+	do(t, h, "POST", "/")
+	do(t, h, "POST", "/")
+	if calls != 2 {
+		t.Errorf("POST response was cached")
+	}
+}
+
+func TestRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	var calls int32
+	h := httpcache.Middleware(rs, time.Minute, httpcache.Config{
+		Options: remember.Options{OnlyLogErrors: true},
+	})(counter(&calls))
+
+	do(t, h, "GET", "/")
+	resp := do(t, h, "GET", "/")
+
+	if resp.Header.Get("X-Cache") != "HIT" || body(t, resp) != "1" {
+		t.Errorf("expected HIT")
+	}
+}
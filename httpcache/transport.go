@@ -0,0 +1,391 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultStaleRetention is the StaleRetention used when it is not set.
+const DefaultStaleRetention = 24 * time.Hour
+
+// Transport is an http.RoundTripper that caches the responses of GET requests.
+//
+// The freshness of a response is determined by the upstream "Cache-Control"
+// (s-maxage or max-age), "Expires" and "Age" headers. When a cached response is
+// stale, it is revalidated using the "ETag" and "Last-Modified" headers.
+//
+// Since the cache may be shared by many callers, responses to requests with an
+// "Authorization" or "Cookie" header are only stored if the response is marked
+// "public", "s-maxage" or "must-revalidate", or varies on the credential header.
+//
+// The "X-Cache" response header is set to HIT, MISS or REVALIDATED.
+type Transport struct {
+
+	// Conner stores the cached responses.
+	Conner remember.Conner
+
+	// Transport is used to make requests.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// KeyPrefix is prepended to every key.
+	// If not set, DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// DefaultExpiration is how long a response is fresh for when the upstream
+	// server does not specify it. 0 means such responses are always revalidated.
+	DefaultExpiration time.Duration
+
+	// StaleRetention is how long a stale response that can be revalidated
+	// is kept for. If not set, DefaultStaleRetention is used.
+	StaleRetention time.Duration
+
+	// Clock is used to determine the freshness and age of responses.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// entry is a cached upstream response.
+type entry struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Expires  time.Time   // When the response becomes stale
+	Vary     http.Header // The request headers listed in the response's Vary header (credentials are hashed)
+	StoredAt time.Time
+	Age      time.Duration // The upstream age of the response when it was stored
+}
+
+func init() {
+	gob.Register(entry{})
+}
+
+// clone returns a copy of e that does not share headers with it.
+// Entries stored in (or loaded from) in-memory caches must not be modified.
+func (e entry) clone() entry {
+	e.Header = e.Header.Clone()
+	e.Vary = e.Vary.Clone()
+	return e
+}
+
+// NewTransport creates a Transport that stores responses in c.
+func NewTransport(c remember.Conner) *Transport {
+	return &Transport{Conner: c}
+}
+
+// Client returns an *http.Client that uses t.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+
+	reqDirectives := cacheControl(req.Header)
+	if _, ok := reqDirectives["no-store"]; ok {
+		return t.transport().RoundTrip(req)
+	}
+
+	cache, err := t.Conner.Conn(req.Context())
+	if err != nil {
+		// Cache is unavailable
+		return t.transport().RoundTrip(req)
+	}
+	defer cache.Close()
+
+	key := t.key(req)
+
+	var cached *entry
+	if item, found, err := cache.Get(key); err == nil && found {
+		if e, ok := item.(entry); ok && varyMatches(e, req) {
+			e = e.clone()
+			cached = &e
+		}
+	}
+
+	_, noCache := reqDirectives["no-cache"]
+
+	now := remember.ClockOrDefault(t.Clock).Now()
+
+	if cached != nil && !noCache && now.Before(cached.Expires) {
+		return cached.response(req, "HIT", now), nil
+	}
+
+	// Revalidate the stale response
+	outReq := req
+	if cached != nil {
+		etag := cached.Header.Get("ETag")
+		lastModified := cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outReq = req.Clone(req.Context())
+			if etag != "" {
+				outReq.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outReq.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := t.transport().RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil && outReq != req {
+		resp.Body.Close()
+
+		// Update the cached response with the new headers
+		for k, v := range resp.Header {
+			cached.Header[k] = v
+		}
+		cached.StoredAt = now
+		cached.Age = age(resp.Header)
+		t.store(cache, key, cached)
+
+		return cached.response(req, "REVALIDATED", now), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || !storable(resp.Header) || resp.Header.Get("Vary") == "*" || !shareable(req, resp.Header, varyHeaders(resp.Header)) {
+		resp.Header.Set("X-Cache", "MISS")
+		return resp, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{
+		Status:   resp.StatusCode,
+		Header:   resp.Header,
+		Body:     b,
+		Vary:     http.Header{},
+		StoredAt: now,
+		Age:      age(resp.Header),
+	}
+	for _, h := range varyHeaders(resp.Header) {
+		e.Vary[h] = varyValues(h, req.Header[h])
+	}
+	t.store(cache, key, e)
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.Header.Set("X-Cache", "MISS")
+	return resp, nil
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) key(req *http.Request) string {
+	prefix := t.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return remember.CreateKey(false, "|", "prefix|transport|url", prefix, "transport", req.URL.String())
+}
+
+// store saves e in the cache. The expiration is determined by the freshness
+// of the response and whether it can be revalidated.
+func (t *Transport) store(cache remember.Cacher, key string, e *entry) {
+	// The response has already aged upstream
+	freshness := t.freshness(e.Header, e.StoredAt) - e.Age
+	if freshness < 0 {
+		freshness = 0
+	}
+	e.Expires = e.StoredAt.Add(freshness)
+
+	expiration := freshness
+	if e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != "" {
+		retention := t.StaleRetention
+		if retention <= 0 {
+			retention = DefaultStaleRetention
+		}
+		expiration += retention
+	}
+
+	if expiration <= 0 {
+		return
+	}
+
+	var item interface{} = e.clone()
+	if cache.StorePointer() {
+		cache.Set(key, expiration, &item)
+	} else {
+		cache.Set(key, expiration, item)
+	}
+}
+
+// freshness returns how long a response is fresh for.
+func (t *Transport) freshness(h http.Header, now time.Time) time.Duration {
+	directives := cacheControl(h)
+
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+
+	// s-maxage applies to shared caches and overrides max-age
+	maxAge, ok := directives["s-maxage"]
+	if !ok {
+		maxAge, ok = directives["max-age"]
+	}
+	if ok {
+		secs, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil || secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		exp, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		date := now
+		if d, err := http.ParseTime(h.Get("Date")); err == nil {
+			date = d
+		}
+		if exp.Before(date) {
+			return 0
+		}
+		return exp.Sub(date)
+	}
+
+	return t.DefaultExpiration
+}
+
+// response creates an *http.Response from the cached entry.
+func (e *entry) response(req *http.Request, status string, now time.Time) *http.Response {
+	h := http.Header{}
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("X-Cache", status)
+
+	resident := now.Sub(e.StoredAt)
+	if resident < 0 {
+		resident = 0
+	}
+	h.Set("Age", strconv.FormatInt(int64((e.Age+resident)/time.Second), 10))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// varyHeaders returns the canonical names of the headers listed in the Vary header.
+func varyHeaders(h http.Header) []string {
+	var out []string
+	for _, line := range h["Vary"] {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				out = append(out, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return out
+}
+
+// varyMatches reports whether req has the same values for the vary headers
+// as the request that produced e.
+func varyMatches(e entry, req *http.Request) bool {
+	for _, h := range varyHeaders(e.Header) {
+		if strings.Join(e.Vary[h], ",") != strings.Join(varyValues(h, req.Header[h]), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// credentialHeaders identify the caller. Responses to requests containing them
+// are specific to the caller unless indicated otherwise.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+func isCredentialHeader(name string) bool {
+	for _, h := range credentialHeaders {
+		if name == h {
+			return true
+		}
+	}
+	return false
+}
+
+// varyValues returns the values of the request header name that are recorded
+// for a vary header. Credentials are hashed so that they are not stored in the cache.
+func varyValues(name string, values []string) []string {
+	if len(values) == 0 || !isCredentialHeader(name) {
+		return values
+	}
+	sum := sha256.Sum256([]byte(strings.Join(values, ",")))
+	return []string{hex.EncodeToString(sum[:])}
+}
+
+// shareable reports whether the response (with header h) to req can be stored in a
+// shared cache. Responses to requests with credentials are only stored if they are
+// explicitly marked as shareable or vary (ie. are keyed) on the credentials.
+//
+// See: https://tools.ietf.org/html/rfc7234#section-3.2
+func shareable(req *http.Request, h http.Header, vary []string) bool {
+	directives := cacheControl(h)
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := directives[d]; ok {
+			return true
+		}
+	}
+
+	for _, c := range credentialHeaders {
+		if req.Header.Get(c) == "" {
+			continue
+		}
+		varies := false
+		for _, v := range vary {
+			if v == c {
+				varies = true
+			}
+		}
+		if !varies {
+			return false
+		}
+	}
+	return true
+}
+
+// age returns the value of the Age header.
+func age(h http.Header) time.Duration {
+	secs, err := strconv.ParseInt(h.Get("Age"), 10, 64)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,393 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package httpcache_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go/httpcache"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+var ctx = context.Background()
+
+func get(t *testing.T, c *http.Client, url string, header ...string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func assertResponse(t *testing.T, resp *http.Response, xcache, expected string) {
+	t.Helper()
+
+	defer resp.Body.Close()
+	if resp.Header.Get("X-Cache") != xcache {
+		t.Errorf("wrong X-Cache: expected: %v actual: %v", xcache, resp.Header.Get("X-Cache"))
+	}
+	if actual := body(t, resp); actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestTransportMaxAge(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+
+	assertResponse(t, get(t, c, srv.URL), "MISS", "1")
+	assertResponse(t, get(t, c, srv.URL), "HIT", "1")
+	assertResponse(t, get(t, c, srv.URL+"/other"), "MISS", "2")
+
+	// no-cache forces a new request
+	assertResponse(t, get(t, c, srv.URL, "Cache-Control", "no-cache"), "MISS", "3")
+	assertResponse(t, get(t, c, srv.URL), "HIT", "3")
+
+	// Other methods are not cached
+	resp, err := c.Post(srv.URL, "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls != 4 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 4, calls)
+	}
+}
+
+func TestTransportExpires(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		now := time.Now().UTC()
+		w.Header().Set("Date", now.Format(http.TimeFormat))
+		if r.URL.Path == "/past" {
+			w.Header().Set("Expires", now.Add(-time.Hour).Format(http.TimeFormat))
+		} else {
+			w.Header().Set("Expires", now.Add(time.Hour).Format(http.TimeFormat))
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+
+	assertResponse(t, get(t, c, srv.URL+"/future"), "MISS", "1")
+	assertResponse(t, get(t, c, srv.URL+"/future"), "HIT", "1")
+
+	// Already expired and can not be revalidated
+	assertResponse(t, get(t, c, srv.URL+"/past"), "MISS", "2")
+	assertResponse(t, get(t, c, srv.URL+"/past"), "MISS", "3")
+}
+
+func TestTransportRevalidation(t *testing.T) {
+	var calls, conditional int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=0")
+
+		switch r.URL.Path {
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&conditional, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/last-modified":
+			lm := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+			w.Header().Set("Last-Modified", lm)
+			if r.Header.Get("If-Modified-Since") == lm {
+				atomic.AddInt32(&conditional, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+
+	for _, path := range []string{"/etag", "/last-modified"} {
+		calls, conditional = 0, 0
+
+		assertResponse(t, get(t, c, srv.URL+path), "MISS", "body")
+		assertResponse(t, get(t, c, srv.URL+path), "REVALIDATED", "body")
+		assertResponse(t, get(t, c, srv.URL+path), "REVALIDATED", "body")
+
+		if calls != 3 || conditional != 2 {
+			t.Errorf("%v: wrong number of calls: expected: %v/%v actual: %v/%v", path, 3, 2, calls, conditional)
+		}
+	}
+}
+
+func TestTransportConcurrentRevalidation(t *testing.T) {
+	// Run with -race: cached headers must not be shared between requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+	assertResponse(t, get(t, c, srv.URL), "MISS", "body")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				resp, err := c.Get(srv.URL)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Header.Set("X-Modified", "1")
+				resp.Body.Close()
+				if resp.Header.Get("X-Cache") != "REVALIDATED" {
+					t.Errorf("wrong X-Cache: expected: %v actual: %v", "REVALIDATED", resp.Header.Get("X-Cache"))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTransportUncacheable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		case "/error":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "*")
+		case "/no-freshness":
+			// Without DefaultExpiration and validators, nothing is stored
+		}
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+
+	for _, path := range []string{"/no-store", "/error", "/vary", "/no-freshness"} {
+		calls = 0
+
+		get(t, c, srv.URL+path).Body.Close()
+		get(t, c, srv.URL+path).Body.Close()
+
+		if calls != 2 {
+			t.Errorf("%v: response was cached", path)
+		}
+	}
+}
+
+func TestTransportVary(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	c := httpcache.NewTransport(memory.NewMemoryStore(time.Minute)).Client()
+
+	assertResponse(t, get(t, c, srv.URL, "Accept-Language", "en"), "MISS", "en")
+	assertResponse(t, get(t, c, srv.URL, "Accept-Language", "en"), "HIT", "en")
+	assertResponse(t, get(t, c, srv.URL, "Accept-Language", "fr"), "MISS", "fr")
+}
+
+func TestTransportCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Authorization")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		fmt.Fprint(w, r.Header.Get("Authorization")+r.Header.Get("Cookie"))
+	}))
+	defer srv.Close()
+
+	ms := memory.NewMemoryStore(time.Minute)
+	c := httpcache.NewTransport(ms).Client()
+
+	// Responses to requests with credentials are not shared
+	assertResponse(t, get(t, c, srv.URL, "Authorization", "alice"), "MISS", "alice")
+	assertResponse(t, get(t, c, srv.URL, "Authorization", "bob"), "MISS", "bob")
+	assertResponse(t, get(t, c, srv.URL+"/cookie", "Cookie", "session=alice"), "MISS", "session=alice")
+	assertResponse(t, get(t, c, srv.URL+"/cookie"), "MISS", "")
+
+	// Unless they are explicitly public
+	assertResponse(t, get(t, c, srv.URL+"/public", "Authorization", "alice"), "MISS", "alice")
+	assertResponse(t, get(t, c, srv.URL+"/public", "Authorization", "bob"), "HIT", "alice")
+
+	// Or vary on the credentials
+	assertResponse(t, get(t, c, srv.URL+"/vary", "Authorization", "alice"), "MISS", "alice")
+	assertResponse(t, get(t, c, srv.URL+"/vary", "Authorization", "alice"), "HIT", "alice")
+	assertResponse(t, get(t, c, srv.URL+"/vary", "Authorization", "bob"), "MISS", "bob")
+
+	// Credentials are not stored in the cache
+	var buf strings.Builder
+	ms.Scan(ctx, func(key string, ttl time.Duration, value interface{}) error {
+		fmt.Fprintf(&buf, "%v", value)
+		return nil
+	})
+	if strings.Contains(buf.String(), "[alice]") || strings.Contains(buf.String(), "[bob]") {
+		t.Errorf("credentials stored in cache: %s", buf.String())
+	}
+}
+
+func TestTransportAge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/aged":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Age", "50")
+		case "/s-maxage":
+			w.Header().Set("Cache-Control", "max-age=60, s-maxage=10")
+		}
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	clock := remembertest.NewFakeClock(time.Now())
+
+	ms := memory.NewMemoryStore(time.Minute)
+	ms.Clock = clock
+
+	tr := httpcache.NewTransport(ms)
+	tr.Clock = clock
+	c := tr.Client()
+
+	assertResponse(t, get(t, c, srv.URL+"/aged"), "MISS", "body")
+	assertResponse(t, get(t, c, srv.URL+"/s-maxage"), "MISS", "body")
+
+	clock.Advance(5 * time.Second)
+	resp := get(t, c, srv.URL+"/aged")
+	if age := resp.Header.Get("Age"); age != "55" {
+		t.Errorf("wrong Age: expected: %v actual: %v", "55", age)
+	}
+	assertResponse(t, resp, "HIT", "body")
+
+	// The upstream age is subtracted from the freshness lifetime
+	clock.Advance(6 * time.Second)
+	assertResponse(t, get(t, c, srv.URL+"/aged"), "MISS", "body")
+
+	// s-maxage overrides max-age
+	assertResponse(t, get(t, c, srv.URL+"/s-maxage"), "MISS", "body")
+}
+
+func TestTransportDefaultExpiration(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%d", atomic.AddInt32(&calls, 1))
+	}))
+	defer srv.Close()
+
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	tr := httpcache.NewTransport(rs)
+	tr.DefaultExpiration = time.Minute
+	c := tr.Client()
+
+	assertResponse(t, get(t, c, srv.URL), "MISS", "1")
+	assertResponse(t, get(t, c, srv.URL), "HIT", "1")
+}
+
+func TestTransportClock(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "body")
+	}))
+	defer srv.Close()
+
+	clock := remembertest.NewFakeClock(time.Now())
+
+	ms := memory.NewMemoryStore(time.Minute)
+	ms.Clock = clock
+
+	tr := httpcache.NewTransport(ms)
+	tr.Clock = clock
+	c := tr.Client()
+
+	assertResponse(t, get(t, c, srv.URL), "MISS", "body")
+
+	clock.Advance(30 * time.Second)
+	resp := get(t, c, srv.URL)
+	if age := resp.Header.Get("Age"); age != "30" {
+		t.Errorf("wrong Age: expected: %v actual: %v", "30", age)
+	}
+	assertResponse(t, resp, "HIT", "body")
+
+	// The response becomes stale
+	clock.Advance(31 * time.Second)
+	assertResponse(t, get(t, c, srv.URL), "REVALIDATED", "body")
+	assertResponse(t, get(t, c, srv.URL), "HIT", "body")
+
+	if calls != 2 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 2, calls)
+	}
+}
@@ -3,8 +3,7 @@
 package remember
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"reflect"
@@ -12,10 +11,15 @@ import (
 	"strings"
 )
 
+// ErrInvalidVisual is returned by ValidateVisual when visual does not match the args.
+var ErrInvalidVisual = errors.New("visual does not match args")
+
 // CreateKey will generate a key based on the input arguments.
 // When prefix is true, the caller's name will be used to prefix the key in an attempt to make it unique.
+// The prefix includes the caller's file path and line number, so keys change whenever the code is moved.
+// See CreateStableKey for a prefix that does not.
 // The args can also be separated using sep. visual performs no functionality. It is used at code level
-// to visually see how the key is structured.
+// to visually see how the key is structured (see ValidateVisual).
 func CreateKey(prefix bool, sep string, visual string, args ...interface{}) string {
 	var output string
 
@@ -28,87 +32,92 @@ func CreateKey(prefix bool, sep string, visual string, args ...interface{}) stri
 		output = fmt.Sprintf("%s_%s_%d_", details.Name(), file, line)
 	}
 
-	if sep == "" {
-		output = output + fmt.Sprint(args...)
-	} else {
-		for i, v := range args {
-			if i != 0 {
-				output = output + sep
-			}
-			output = output + fmt.Sprint(v)
-		}
-	}
-
-	return output
-}
-
-// Hash returns a crc32 hashed version of key.
-func Hash(key string) string {
-	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(key)))
+	return output + joinArgs(sep, args)
 }
 
-// CreateKeyStruct generates a key by converting a struct into a JSON object.
-func CreateKeyStruct(strct interface{}) string {
-	out := map[string]interface{}{}
+// CreateStableKey will generate a key based on the input arguments, prefixed with the caller's
+// package-qualified function name. Unlike CreateKey, the caller's file path and line number are not
+// used, so the key does not change when code is moved or built from a different directory.
+//
+// version is appended to the function name (if not empty). It can be changed to invalidate keys
+// when the structure of the cached data changes. sep and visual behave the same as CreateKey.
+//
+// Example:
+//
+//	// Key will be "main.search@v2_golang-2"
+//	key := remember.CreateStableKey("v2", "-", "search-page", "golang", 2)
+func CreateStableKey(version string, sep string, visual string, args ...interface{}) string {
+	var output string
 
-	// Encode nil immediately
-	if strct == nil {
-		return ""
+	pc, _, _, ok := runtime.Caller(1)
+	if ok {
+		output = runtime.FuncForPC(pc).Name()
+		if version != "" {
+			output = output + "@" + version
+		}
+		output = output + "_"
 	}
 
-	s := reflect.ValueOf(strct)
+	return output + joinArgs(sep, args)
+}
 
-	// Check if s is a pointer
-	if s.Kind() == reflect.Ptr {
-		s = reflect.Indirect(s)
+// ValidateVisual checks that visual describes the same number of parts as args.
+// visual is split using sep (or whitespace if sep is empty). An empty visual is always valid.
+//
+// It can be used in tests to ensure that the visual argument of CreateKey and
+// CreateStableKey remains accurate.
+func ValidateVisual(sep string, visual string, args ...interface{}) error {
+	if visual == "" {
+		return nil
 	}
-	typeOfT := s.Type()
-
-	for i := 0; i < s.NumField(); i++ {
-		f := typeOfT.Field(i)
 
-		if f.PkgPath != "" {
-			// Not exported
-			continue
-		}
-
-		fieldName := typeOfT.Field(i).Name
-		fieldTag := f.Tag.Get("json")
-		fieldValRaw := s.Field(i)
-		fieldVal := fieldValRaw.Interface()
+	var parts []string
+	if sep == "" {
+		parts = strings.Fields(visual)
+	} else {
+		parts = strings.Split(visual, sep)
+	}
 
-		// Ignore slices
-		if fieldValRaw.Kind() == reflect.Slice {
-			continue
-		}
+	if len(parts) != len(args) {
+		return fmt.Errorf("%w: %q has %d parts but there are %d args", ErrInvalidVisual, visual, len(parts), len(args))
+	}
+	return nil
+}
 
-		// Check if json parser would ordinarily hide the value anyway
-		if fieldTag == "-" || (strings.HasSuffix(fieldTag, ",omitempty") && reflect.DeepEqual(fieldVal, reflect.Zero(reflect.TypeOf(fieldVal)).Interface())) {
-			continue
-		}
+// joinArgs converts args into a string, separated by sep.
+func joinArgs(sep string, args []interface{}) string {
+	if sep == "" {
+		return fmt.Sprint(args...)
+	}
 
-		if fieldTag == "" {
-			out[fieldName] = fieldVal
-		} else {
-			out[strings.TrimSuffix(fieldTag, ",omitempty")] = fieldVal
+	var output string
+	for i, v := range args {
+		if i != 0 {
+			output = output + sep
 		}
+		output = output + fmt.Sprint(v)
 	}
-
-	b, _ := json.Marshal(out)
-	str, _ := compactJson(b)
-
-	return str
+	return output
 }
 
-// compactJson will remove insignificant spaces to minimize storage space.
-func compactJson(src []byte) (string, error) {
+// Hash returns a crc32 hashed version of key.
+// Collisions are likely once there are many keys. See Hasher for alternatives.
+func Hash(key string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(key)))
+}
 
-	dst := new(bytes.Buffer)
+// CreateKeyStruct generates a key by converting a struct into a JSON object.
+// See EncodeKey for the rules. An empty string is returned if strct is not a
+// struct (or a pointer to a struct) or if it can not be encoded.
+func CreateKeyStruct(strct interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(strct))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
 
-	err := json.Compact(dst, src)
+	key, err := EncodeKey(strct)
 	if err != nil {
-		return "", err
+		return ""
 	}
-
-	return dst.String(), nil
+	return key
 }
@@ -0,0 +1,136 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyEscaper escapes the characters that separate the segments of a key
+// generated by KeyBuilder.
+var keyEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "=", "%3D")
+
+// KeyBuilder generates keys in a canonical form:
+//
+//	{hashtag}:namespace:v=version:t=tenant:part1:part2
+//
+// The hash tag, version and tenant segments are omitted if not set. Occurrences of
+// ":", "=" and "%" within a segment are percent-encoded, so different inputs
+// never produce the same key.
+//
+// Example:
+//
+//	// Key will be "books:v=2:t=acme:search:golang:2"
+//	key, err := remember.NewKeyBuilder("books").Version("2").Tenant("acme").Part("search", "golang", 2).Build()
+type KeyBuilder struct {
+	hashTag   string
+	namespace string
+	version   string
+	tenant    string
+	parts     []string
+	err       error
+}
+
+// NewKeyBuilder creates a KeyBuilder for keys within namespace.
+func NewKeyBuilder(namespace string) *KeyBuilder {
+	return &KeyBuilder{namespace: namespace}
+}
+
+// HashTag sets the Redis Cluster hash tag of the key. Keys with the same hash tag
+// are stored in the same hash slot. The tag must not contain "{" or "}".
+//
+// See: https://redis.io/topics/cluster-spec#keys-hash-tags
+func (b *KeyBuilder) HashTag(tag string) *KeyBuilder {
+	b.hashTag = tag
+	return b
+}
+
+// Version sets the schema version of the cached data. It can be changed to
+// invalidate keys when the structure of the cached data changes.
+func (b *KeyBuilder) Version(version string) *KeyBuilder {
+	b.version = version
+	return b
+}
+
+// Tenant sets the tenant that the cached data belongs to.
+func (b *KeyBuilder) Tenant(tenant string) *KeyBuilder {
+	b.tenant = tenant
+	return b
+}
+
+// Part appends parts to the key. Each part is converted into a string using fmt.Sprint.
+func (b *KeyBuilder) Part(parts ...interface{}) *KeyBuilder {
+	for _, p := range parts {
+		b.parts = append(b.parts, fmt.Sprint(p))
+	}
+	return b
+}
+
+// Struct appends v to the key after encoding it using EncodeKey.
+// If v can not be encoded, Build will return the error.
+func (b *KeyBuilder) Struct(v interface{}) *KeyBuilder {
+	encoded, err := EncodeKey(v)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return b
+	}
+	b.parts = append(b.parts, encoded)
+	return b
+}
+
+// Build returns the key.
+func (b *KeyBuilder) Build() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	if b.namespace == "" {
+		return "", fmt.Errorf("%w: namespace is required", ErrInvalidKey)
+	}
+
+	segments := make([]string, 0, 4+len(b.parts))
+	if b.hashTag != "" {
+		if strings.ContainsAny(b.hashTag, "{}") {
+			return "", fmt.Errorf("%w: hash tag must not contain braces", ErrInvalidKey)
+		}
+		segments = append(segments, "{"+keyEscaper.Replace(b.hashTag)+"}")
+	}
+	segments = append(segments, keyEscaper.Replace(b.namespace))
+	if b.version != "" {
+		segments = append(segments, "v="+keyEscaper.Replace(b.version))
+	}
+	if b.tenant != "" {
+		segments = append(segments, "t="+keyEscaper.Replace(b.tenant))
+	}
+	for _, p := range b.parts {
+		segments = append(segments, keyEscaper.Replace(p))
+	}
+
+	return strings.Join(segments, ":"), nil
+}
+
+// String returns the key. An empty string is returned if Build returns an error.
+func (b *KeyBuilder) String() string {
+	key, err := b.Build()
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// Validate returns the key after checking that it is accepted by c.
+// c is checked if it implements KeyValidator.
+func (b *KeyBuilder) Validate(c Conner) (string, error) {
+	key, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	if kv, ok := c.(KeyValidator); ok {
+		if err := kv.ValidateKey(key); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+)
+
+func TestKeyBuilder(t *testing.T) {
+
+	tests := []struct {
+		builder  *remember.KeyBuilder
+		expected string
+	}{
+		{remember.NewKeyBuilder("books"), "books"},
+		{remember.NewKeyBuilder("books").Version("2").Tenant("acme").Part("search", "golang", 2), "books:v=2:t=acme:search:golang:2"},
+		{remember.NewKeyBuilder("books").Tenant("acme").Version("2"), "books:v=2:t=acme"},
+		{remember.NewKeyBuilder("books").Part("a:b", "v=1", "100%"), "books:a%3Ab:v%3D1:100%25"},
+		{remember.NewKeyBuilder("books").Struct(struct{ Page int }{2}), `books:{"Page"%3A2}`},
+		{remember.NewKeyBuilder("books").HashTag("acme").Version("2"), "{acme}:books:v=2"},
+	}
+
+	for _, tt := range tests {
+		actual, err := tt.builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong val: expected: %v actual: %v", tt.expected, actual)
+		}
+		if actual != tt.builder.String() {
+			t.Errorf("wrong val: expected: %v actual: %v", actual, tt.builder.String())
+		}
+	}
+
+	// Errors
+	if _, err := remember.NewKeyBuilder("").Build(); !errors.Is(err, remember.ErrInvalidKey) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+	if _, err := remember.NewKeyBuilder("books").HashTag("a}b").Build(); !errors.Is(err, remember.ErrInvalidKey) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+	b := remember.NewKeyBuilder("books").Struct(struct{ C chan int }{})
+	if _, err := b.Build(); !errors.Is(err, remember.ErrUnsupportedType) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrUnsupportedType, err)
+	}
+	if b.String() != "" {
+		t.Errorf("wrong val: expected: %v actual: %v", "", b.String())
+	}
+}
+
+// shortKeyStore only accepts keys of up to 10 bytes.
+type shortKeyStore struct {
+	*memory.MemoryStore
+}
+
+func (s shortKeyStore) ValidateKey(key string) error {
+	if len(key) > 10 {
+		return remember.ErrInvalidKey
+	}
+	return nil
+}
+
+func TestKeyValidator(t *testing.T) {
+
+	ks := shortKeyStore{memory.NewMemoryStore(10 * time.Minute)}
+
+	if _, err := remember.NewKeyBuilder("books").Part(1).Validate(ks); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := remember.NewKeyBuilder("books").Part(strings.Repeat("x", 10)).Validate(ks); !errors.Is(err, remember.ErrInvalidKey) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+
+	// Cache does not call SlowRetrieve when the key is invalid
+	var called bool
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		called = true
+		return "val", nil
+	}
+
+	_, _, err := remember.Cache(ctx, ks, strings.Repeat("x", 11), 10*time.Minute, slowQuery)
+	if !errors.Is(err, remember.ErrInvalidKey) {
+		t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+	}
+	if called {
+		t.Errorf("expected SlowRetrieve not to be called")
+	}
+}
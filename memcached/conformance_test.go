@@ -0,0 +1,29 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memcached_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/memcached"
+)
+
+func TestConformance(t *testing.T) {
+	var s *fakeServer
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		s = newFakeServer()
+		return memcached.NewMemcachedStore(s.Addr()), s.Close
+	}, cachertest.Config{
+		NoExpiration: memcached.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			s.Advance(d)
+		},
+		Break: func(c remember.Conner) {
+			s.Close()
+		},
+	})
+}
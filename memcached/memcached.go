@@ -6,28 +6,94 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/rocketlaunchr/remember-go"
 )
 
+// NoExpiration is used to indicate that data should not expire from the cache.
+const NoExpiration time.Duration = 0
+
+// MaxKeyLength is the maximum length of a key permitted by memcached.
+const MaxKeyLength = 250
+
+// DefaultNamespace is the namespace used by stores created with NewMemcachedStore
+// and NewMemachedStoreFromSelector.
+const DefaultNamespace = "remember"
+
+// DefaultGenerationInterval is the GenerationInterval used by stores created with
+// NewMemcachedStore and NewMemachedStoreFromSelector.
+const DefaultGenerationInterval = time.Second
+
+// maxGenerationLength is the maximum length of a namespace's generation.
+// The generation is a decimal int64.
+const maxGenerationLength = 20
+
+// maxRelativeExpiration is the longest expiration that memcached interprets
+// as relative to the current time. Longer expirations must be sent as an
+// absolute Unix timestamp.
+//
+// See: https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
 // MemcachedStore is used to create a memcached-backed cache.
+//
+// All keys are stored within a namespace. ForgetAll only invalidates keys
+// belonging to the namespace so that servers can be safely shared with
+// other applications.
 type MemcachedStore struct {
-	client *memcache.Client
+	Client *memcache.Client
+
+	// Namespace is prepended to every key.
+	// Stores that share a server should use different namespaces.
+	Namespace string
+
+	// Hasher is used to hash keys that are too long or contain invalid characters.
+	// If not set, remember.SHA256 is used.
+	Hasher remember.Hasher
+
+	// StrictKeys rejects keys that are too long or contain invalid characters
+	// (instead of hashing them). remember.ErrInvalidKey is returned before
+	// communicating with the server.
+	StrictKeys bool
+
+	// GenerationInterval is how long the namespace's generation is cached before it
+	// is fetched from memcached again. Caching it avoids an extra round-trip for
+	// every operation.
+	//
+	// After ForgetAll is called by another store sharing the namespace, this store
+	// may read stale values for up to GenerationInterval. ForgetAll called by this
+	// store takes effect immediately for this store. 0 fetches the generation for
+	// every operation.
+	GenerationInterval time.Duration
+
+	// selector is used to find the servers to scan.
+	selector memcache.ServerSelector
+
+	mu      sync.Mutex
+	gen     string    // Cached generation
+	genTime time.Time // When gen was fetched
 }
 
 // NewMemcachedStore creates a memcached-backed cache.
 func NewMemcachedStore(server ...string) *MemcachedStore {
-	return &MemcachedStore{
-		client: memcache.New(server...),
-	}
+	// Equivalent to memcache.New (which also ignores the error)
+	ss := new(memcache.ServerList)
+	ss.SetServers(server...)
+	return NewMemachedStoreFromSelector(ss)
 }
 
 // NewMemachedStoreFromSelector creates a memcached-backed cache.
 func NewMemachedStoreFromSelector(ss memcache.ServerSelector) *MemcachedStore {
 	return &MemcachedStore{
-		client: memcache.NewFromSelector(ss),
+		Client:             memcache.NewFromSelector(ss),
+		Namespace:          DefaultNamespace,
+		GenerationInterval: DefaultGenerationInterval,
+		selector:           ss,
 	}
 }
 
@@ -36,67 +102,316 @@ func (c *MemcachedStore) Conn(ctx context.Context) (remember.Cacher, error) {
 	return c, nil
 }
 
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *MemcachedStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
 // StorePointer sets whether a storage driver requires itemToStore to be
 // stored as a pointer or as a concrete value.
 func (c *MemcachedStore) StorePointer() bool {
-	return false // Not sure if this should be true or false. Try with both?
+	return true
 }
 
-// Get retrieves a value from the cache. The key must be at most 250 bytes in length.
+// Get returns a value from the cache if the key exists.
+// Keys that are too long or contain characters not permitted by memcached are
+// automatically hashed.
 func (c *MemcachedStore) Get(key string) (_ interface{}, found bool, _ error) {
 
-	item, err := c.client.Get(key)
+	k, err := c.key(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	output, _, found, err := c.get(k)
+	return output, found, err
+}
+
+// GetCAS returns a value from the cache if the key exists, along with a token
+// that identifies the current version of the value.
+func (c *MemcachedStore) GetCAS(key string) (_ interface{}, cas uint64, found bool, _ error) {
+
+	k, err := c.key(key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	return c.get(k)
+}
+
+func (c *MemcachedStore) get(k string) (_ interface{}, cas uint64, found bool, _ error) {
+
+	item, err := c.Client.Get(k)
 	if err != nil {
 		if err == memcache.ErrCacheMiss {
-			return nil, false, nil
+			return nil, 0, false, nil
 		}
-		return nil, false, err
+		return nil, 0, false, err
 	}
 
 	var output interface{}
 
 	err = gob.NewDecoder(bytes.NewBuffer(item.Value)).Decode(&output)
 	if err != nil {
-		return nil, true, err // Could not decode cached data
+		return nil, item.CasID, true, err // Could not decode cached data
 	}
 
-	return output, true, nil
+	return output, item.CasID, true, nil
 }
 
-// Set stores a value in the cache. The key must be at most 250 bytes in length.
+// Set sets a item into the cache for a particular key.
+// Expirations longer than 30 days are converted to an absolute time as required by memcached.
 func (c *MemcachedStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
 
-	var exp int32
+	item, err := c.item(key, expiration, itemToStore)
+	if err != nil {
+		return err
+	}
+
+	return c.Client.Set(item)
+}
+
+// Add sets a item into the cache only if the key does not already exist.
+// remember.ErrNotStored is returned if the key exists.
+func (c *MemcachedStore) Add(key string, expiration time.Duration, itemToStore interface{}) error {
 
-	if expiration != 0 {
-		exp = int32(time.Now().Add(expiration).Unix())
+	item, err := c.item(key, expiration, itemToStore)
+	if err != nil {
+		return err
 	}
 
-	// Convert item to bytes
-	b := new(bytes.Buffer)
-	err := gob.NewEncoder(b).Encode(itemToStore)
+	err = c.Client.Add(item)
+	if err == memcache.ErrNotStored {
+		return remember.ErrNotStored
+	}
+	return err
+}
+
+// CompareAndSwap sets a item into the cache only if the value has not been
+// modified or removed since it was fetched by GetCAS.
+// remember.ErrCASConflict is returned otherwise.
+func (c *MemcachedStore) CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error {
+
+	item, err := c.item(key, expiration, itemToStore)
 	if err != nil {
 		return err
 	}
+	item.CasID = cas
 
-	item := &memcache.Item{
-		Key:        key,
-		Expiration: exp,
-		Value:      b.Bytes(),
+	err = c.Client.CompareAndSwap(item)
+	switch err {
+	case memcache.ErrCASConflict, memcache.ErrNotStored, memcache.ErrCacheMiss:
+		return remember.ErrCASConflict
+	}
+	return err
+}
+
+// item creates the memcache.Item that is sent to memcached.
+func (c *MemcachedStore) item(key string, expiration time.Duration, itemToStore interface{}) (*memcache.Item, error) {
+
+	k, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert item to bytes
+	b := new(bytes.Buffer)
+	err = gob.NewEncoder(b).Encode(itemToStore)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.client.Set(item)
+	return &memcache.Item{
+		Key:        k,
+		Expiration: memcachedExpiration(expiration, time.Now()),
+		Value:      b.Bytes(),
+	}, nil
 }
 
 // Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing.
 func (c *MemcachedStore) Close() {}
 
 // Forget clears the value from the cache for the particular key.
 func (c *MemcachedStore) Forget(key string) error {
-	return c.client.Delete(key)
+
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+
+	err = c.Client.Delete(k)
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
 }
 
-// ForgetAll clears all values from the cache.
+// ForgetAll clears all values from the cache that belong to the namespace.
+// Values stored by other applications (or in other namespaces) are not affected.
+//
+// The namespace's generation is incremented so that all existing keys become
+// unreachable. The stale values are subsequently evicted by memcached.
+//
+// Other stores sharing the namespace observe the new generation within their
+// GenerationInterval.
 func (c *MemcachedStore) ForgetAll() error {
-	return c.client.DeleteAll()
+	gen, err := c.Client.Increment(c.generationKey(), 1)
+	if err == memcache.ErrCacheMiss {
+		// The generation will be recreated with a fresh value when next used.
+		c.cacheGeneration("")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.cacheGeneration(strconv.FormatUint(gen, 10))
+	return nil
+}
+
+// cacheGeneration caches the namespace's current generation.
+// An empty gen clears the cache.
+func (c *MemcachedStore) cacheGeneration(gen string) {
+	c.mu.Lock()
+	c.gen, c.genTime = gen, time.Now()
+	c.mu.Unlock()
+}
+
+// generationKey returns the key that stores the namespace's current generation.
+func (c *MemcachedStore) generationKey() string {
+	return c.safeKey(c.Namespace + ":gen")
+}
+
+// generation returns the namespace's current generation.
+// It is cached for GenerationInterval.
+func (c *MemcachedStore) generation() (string, error) {
+	if c.GenerationInterval > 0 {
+		c.mu.Lock()
+		gen, fresh := c.gen, time.Since(c.genTime) < c.GenerationInterval
+		c.mu.Unlock()
+		if gen != "" && fresh {
+			return gen, nil
+		}
+	}
+
+	gen, err := c.fetchGeneration()
+	if err != nil {
+		return "", err
+	}
+	if c.GenerationInterval > 0 {
+		c.cacheGeneration(gen)
+	}
+	return gen, nil
+}
+
+// fetchGeneration fetches the namespace's current generation from memcached.
+func (c *MemcachedStore) fetchGeneration() (string, error) {
+	gk := c.generationKey()
+
+	for {
+		item, err := c.Client.Get(gk)
+		if err == nil {
+			return string(item.Value), nil
+		}
+		if err != memcache.ErrCacheMiss {
+			return "", err
+		}
+
+		// The generation is seeded from the current time so that if it is ever
+		// evicted, keys from an earlier generation are not resurrected.
+		gen := strconv.FormatInt(time.Now().UnixNano(), 10)
+		err = c.Client.Add(&memcache.Item{Key: gk, Value: []byte(gen)})
+		if err == nil {
+			return gen, nil
+		}
+		if err != memcache.ErrNotStored {
+			return "", err
+		}
+		// Another client created the generation first so fetch it.
+	}
+}
+
+// ValidateKey reports whether key is accepted. Keys are only rejected when
+// StrictKeys is set. Otherwise invalid keys are hashed.
+func (c *MemcachedStore) ValidateKey(key string) error {
+	if !c.StrictKeys {
+		return nil
+	}
+
+	// The namespace and generation are prepended to the key
+	max := MaxKeyLength - len(c.Namespace) - maxGenerationLength - 2
+	if len(key) > max {
+		return fmt.Errorf("%w: key is %d bytes but the maximum is %d", remember.ErrInvalidKey, len(key), max)
+	}
+	if !validKey(key) {
+		return fmt.Errorf("%w: key contains whitespace or control characters", remember.ErrInvalidKey)
+	}
+	return nil
+}
+
+// Key returns the key that is sent to memcached for key. It includes the namespace
+// and its current generation (and is hashed if required). It can be used to access
+// the underlying Client directly.
+func (c *MemcachedStore) Key(key string) (string, error) {
+	return c.key(key)
+}
+
+// key returns the key that is sent to memcached.
+func (c *MemcachedStore) key(key string) (string, error) {
+	if err := c.ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	gen, err := c.generation()
+	if err != nil {
+		return "", err
+	}
+	return c.safeKey(c.Namespace + ":" + gen + ":" + key), nil
+}
+
+// safeKey returns key unaltered if it is accepted by memcached.
+// Otherwise a hashed version is returned.
+func (c *MemcachedStore) safeKey(key string) string {
+	if validKey(key) {
+		return key
+	}
+	h := c.Hasher
+	if h == nil {
+		h = remember.SHA256
+	}
+	return remember.HashKey(h, key, 0)
+}
+
+// validKey reports whether key is accepted by memcached. Keys must be at most
+// 250 bytes and must not contain whitespace or control characters.
+func validKey(key string) bool {
+	if len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// memcachedExpiration converts expiration into the format expected by memcached.
+// Expirations of up to 30 days are sent as a number of seconds relative to now.
+// Longer expirations are sent as an absolute Unix timestamp.
+func memcachedExpiration(expiration time.Duration, now time.Time) int32 {
+	if expiration <= NoExpiration {
+		return 0
+	}
+
+	if expiration > maxRelativeExpiration {
+		return int32(now.Add(expiration).Unix())
+	}
+
+	// Round up so that sub-second expirations don't become NoExpiration.
+	secs := int32(expiration / time.Second)
+	if expiration%time.Second != 0 {
+		secs++
+	}
+	return secs
 }
@@ -0,0 +1,615 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memcached_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memcached"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+var ctx = context.Background()
+
+func TestKeyBasicOperation(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	actual, _, _ := remember.Cache(ctx, ms, key, exp, slowQuery)
+
+	expected := "val"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestFetchFromCacheAndDisableCache(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	// warm up cache
+	remember.Cache(ctx, ms, key, exp, slowQuery)
+
+	// This time fetch from cache
+	actual, found, _ := remember.Cache(ctx, ms, key, exp, slowQuery)
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Actual is now "val", Let's change it to "val2" and disable cache usage.
+
+	slowQuery = func(ctx context.Context) (interface{}, error) {
+		return "val2", nil
+	}
+
+	actual, _, _ = remember.Cache(ctx, ms, key, exp, slowQuery, remember.Options{DisableCacheUsage: true})
+
+	expected = "val2"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestUnsafeKeys(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	keys := []string{
+		"key with spaces",
+		"key\twith\ncontrol\x7fchars",
+		strings.Repeat("x", 1000),
+		remember.CreateKeyStruct(struct{ Search string }{"golang generics"}),
+	}
+
+	for i, key := range keys {
+		var val interface{} = i
+		err := ms.Set(key, 10*time.Minute, &val)
+		if err != nil {
+			t.Fatalf("set %q: %v", key, err)
+		}
+	}
+
+	for i, key := range keys {
+		actual, found, err := ms.Get(key)
+		if err != nil || !found {
+			t.Fatalf("get %q: found: %v err: %v", key, found, err)
+		}
+		if actual.(int) != i {
+			t.Errorf("wrong val: expected: %v actual: %v", i, actual)
+		}
+	}
+
+	for _, key := range s.Keys() {
+		if len(key) > memcached.MaxKeyLength || strings.ContainsAny(key, " \t\n\x7f") {
+			t.Errorf("invalid key sent to server: %q", key)
+		}
+	}
+
+	for _, key := range keys {
+		if err := ms.Forget(key); err != nil {
+			t.Fatalf("forget %q: %v", key, err)
+		}
+		if _, found, _ := ms.Get(key); found {
+			t.Errorf("expected %q to be forgotten", key)
+		}
+	}
+}
+
+func TestCustomHasher(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+	ms.Hasher = remember.XXHash64
+
+	key := strings.Repeat("x", 1000)
+
+	var val interface{} = "val"
+	if err := ms.Set(key, 10*time.Minute, &val); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, found, _ := ms.Get(key)
+	if !found || actual.(string) != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+
+	var hashed int
+	for _, k := range s.Keys() {
+		if strings.HasPrefix(k, "#") {
+			hashed++
+			if len(k) != 17 {
+				t.Errorf("wrong key length: expected: %v actual: %v", 17, len(k))
+			}
+		}
+	}
+	if hashed != 1 {
+		t.Errorf("wrong number of hashed keys: expected: %v actual: %v", 1, hashed)
+	}
+}
+
+func TestStrictKeys(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+	ms.StrictKeys = true
+
+	var val interface{} = "val"
+	if err := ms.Set("valid:key", 10*time.Minute, &val); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"key with spaces", strings.Repeat("x", 240)} {
+		if err := ms.Set(key, 10*time.Minute, &val); !errors.Is(err, remember.ErrInvalidKey) {
+			t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+		}
+		if _, _, err := ms.Get(key); !errors.Is(err, remember.ErrInvalidKey) {
+			t.Errorf("wrong err: expected: %v actual: %v", remember.ErrInvalidKey, err)
+		}
+	}
+
+	// Only the generation and valid key were sent
+	if len(s.Keys()) != 2 {
+		t.Errorf("wrong number of keys: expected: %v actual: %v", 2, len(s.Keys()))
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	var val interface{} = "val"
+
+	ms.Set("short", 10*time.Minute, &val)
+	ms.Set("subsecond", 100*time.Millisecond, &val)
+	ms.Set("long", 60*24*time.Hour, &val)
+	ms.Set("forever", memcached.NoExpiration, &val)
+
+	// Relative expirations are sent as seconds
+	if it := rawItem(t, s, ms, "short"); it.expiration != 600 {
+		t.Errorf("wrong expiration: expected: %v actual: %v", 600, it.expiration)
+	}
+
+	if it := rawItem(t, s, ms, "subsecond"); it.expiration != 1 {
+		t.Errorf("wrong expiration: expected: %v actual: %v", 1, it.expiration)
+	}
+
+	// Expirations longer than 30 days are sent as an absolute time
+	expected := time.Now().Add(60 * 24 * time.Hour).Unix()
+	if it := rawItem(t, s, ms, "long"); int64(it.expiration) < expected-5 || int64(it.expiration) > expected+5 {
+		t.Errorf("wrong expiration: expected: ~%v actual: %v", expected, it.expiration)
+	}
+
+	if it := rawItem(t, s, ms, "forever"); it.expiration != 0 {
+		t.Errorf("wrong expiration: expected: %v actual: %v", 0, it.expiration)
+	}
+
+	s.Advance(11 * time.Minute)
+	assertFound(t, ms, "short", false)
+	assertFound(t, ms, "subsecond", false)
+	assertFound(t, ms, "long", true)
+	assertFound(t, ms, "forever", true)
+
+	s.Advance(31 * 24 * time.Hour)
+	assertFound(t, ms, "long", true)
+
+	s.Advance(30 * 24 * time.Hour)
+	assertFound(t, ms, "long", false)
+	assertFound(t, ms, "forever", true)
+}
+
+func TestForgetAll(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var (
+		ms1 = memcached.NewMemcachedStore(s.Addr())
+		ms2 = memcached.NewMemcachedStore(s.Addr())
+	)
+	ms2.Namespace = "other"
+
+	// A value stored by another application sharing the server
+	err := ms1.Client.Set(&memcache.Item{Key: "foreign", Value: []byte("val")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var val interface{} = "val"
+
+	ms1.Set("key", 10*time.Minute, &val)
+	ms2.Set("key", 10*time.Minute, &val)
+
+	if err := ms1.ForgetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFound(t, ms1, "key", false)
+	assertFound(t, ms2, "key", true)
+
+	if _, err := ms1.Client.Get("foreign"); err != nil {
+		t.Errorf("foreign key was removed: %v", err)
+	}
+
+	// Store is still usable after ForgetAll
+	ms1.Set("key", 10*time.Minute, &val)
+	assertFound(t, ms1, "key", true)
+}
+
+func TestGenerationInterval(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var (
+		ms1 = memcached.NewMemcachedStore(s.Addr())
+		ms2 = memcached.NewMemcachedStore(s.Addr())
+	)
+	ms2.GenerationInterval = time.Hour
+
+	var val interface{} = "val"
+	ms1.Set("key", 10*time.Minute, &val)
+	assertFound(t, ms2, "key", true)
+
+	ms1.ForgetAll()
+	assertFound(t, ms1, "key", false)
+
+	// ms2 uses its cached generation until the interval elapses
+	assertFound(t, ms2, "key", true)
+
+	ms2.GenerationInterval = 0
+	assertFound(t, ms2, "key", false)
+}
+
+func TestForgetMissingKey(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	if err := ms.Forget("missing"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+	ms.Set("key", time.Hour, "val")
+
+	k, err := ms.Key("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := s.Item(k); !found {
+		t.Errorf("key %q not found on server", k)
+	}
+
+	// The key changes after ForgetAll
+	ms.ForgetAll()
+	k2, _ := ms.Key("key")
+	if k2 == k {
+		t.Errorf("expected key to change: %v", k2)
+	}
+}
+
+func TestScanRaw(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+	var val interface{} = "val"
+	ms.Set("key:1", time.Hour, &val)
+	ms.Set("key:2", memcached.NoExpiration, &val)
+	ms.Set("key 3", time.Hour, &val) // Hashed keys are not included
+
+	// Keys in other namespaces and earlier generations are not included
+	other := memcached.NewMemcachedStore(s.Addr())
+	other.Namespace = "other"
+	other.Set("key:3", time.Hour, &val)
+
+	found := map[string]time.Duration{}
+	err := ms.ScanRaw(ctx, func(key string, ttl time.Duration, value []byte) error {
+		found[key] = ttl
+
+		// The value can be stored in another store
+		return other.SetRaw(ctx, key, ttl, value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found["key:1"] <= 59*time.Minute || found["key:2"] >= 0 {
+		t.Errorf("wrong keys: %v", found)
+	}
+
+	actual, _, err := other.Get("key:2")
+	if err != nil || actual != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v (err: %v)", "val", actual, err)
+	}
+
+	// SafeSet placeholders are not included
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		remember.Cache(ctx, ms, "key:4", time.Hour, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "val", nil
+		}, remember.Options{SafeSet: true})
+	}()
+	<-started
+
+	found = map[string]time.Duration{}
+	ms.ScanRaw(ctx, func(key string, ttl time.Duration, value []byte) error {
+		found[key] = ttl
+		return nil
+	})
+	close(release)
+	<-done
+
+	if _, exists := found["key:4"]; exists || len(found) != 2 {
+		t.Errorf("wrong keys: %v", found)
+	}
+
+	// Stores must know their servers
+	var ms2 = &memcached.MemcachedStore{Client: memcache.New(s.Addr())}
+	if err := ms2.ScanRaw(ctx, nil); err != memcached.ErrNoServers {
+		t.Errorf("wrong err: expected: %v actual: %v", memcached.ErrNoServers, err)
+	}
+}
+
+// rawItem returns the item stored on the server for key.
+func rawItem(t *testing.T, s *fakeServer, ms *memcached.MemcachedStore, key string) fakeItem {
+	t.Helper()
+
+	for _, k := range s.Keys() {
+		if strings.HasSuffix(k, ":"+key) && strings.HasPrefix(k, ms.Namespace+":") {
+			it, _ := s.Item(k)
+			return it
+		}
+	}
+
+	t.Fatalf("key %q not found on server", key)
+	return fakeItem{}
+}
+
+func assertFound(t *testing.T, ms *memcached.MemcachedStore, key string, expected bool) {
+	t.Helper()
+
+	_, found, err := ms.Get(key)
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if found != expected {
+		t.Errorf("wrong found for %q: expected: %v actual: %v", key, expected, found)
+	}
+}
+
+func TestSafeSetDiscardsStaleValue(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+	opts := remember.Options{SafeSet: true}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	// A slow fetch of data that will become stale
+	go func() {
+		defer close(done)
+		slowQuery := func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "stale", nil
+		}
+		actual, _, _ := remember.Cache(ctx, ms, key, exp, slowQuery, opts)
+		if actual.(string) != "stale" {
+			t.Errorf("wrong val: expected: %v actual: %v", "stale", actual)
+		}
+	}()
+
+	<-started
+
+	// The underlying data changes so the key is forgotten
+	if err := ms.Forget(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// A subsequent fetch stores the fresh data
+	freshQuery := func(ctx context.Context) (interface{}, error) {
+		return "fresh", nil
+	}
+	remember.Cache(ctx, ms, key, exp, freshQuery, opts)
+
+	close(release)
+	<-done
+
+	actual, found, err := ms.Get(key)
+	if err != nil || !found {
+		t.Fatalf("get: found: %v err: %v", found, err)
+	}
+
+	expected := "fresh"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestSafeSetStampede(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+	opts := remember.Options{SafeSet: true}
+
+	var calls int32
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "val", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual, _, err := remember.Cache(ctx, ms, key, exp, slowQuery, opts)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if actual.(string) != "val" {
+				t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("wrong number of SlowRetrieve calls: expected: %v actual: %v", 1, calls)
+	}
+}
+
+func TestSafeSetLockTimeout(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+	clock := remembertest.NewFakeClock(time.Now())
+	opts := remember.Options{SafeSet: true, LockTimeout: time.Minute, Clock: clock}
+
+	// The first caller holds the lock until released
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		remember.Cache(ctx, ms, key, exp, func(ctx context.Context) (interface{}, error) {
+			<-release
+			return "first", nil
+		}, opts)
+	}()
+
+	// Wait for the lock to be acquired
+	for len(s.Keys()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	result := make(chan interface{})
+	go func() {
+		actual, _, _ := remember.Cache(ctx, ms, key, exp, func(ctx context.Context) (interface{}, error) {
+			return "second", nil
+		}, opts)
+		result <- actual
+	}()
+
+	// The second caller waits until the lock times out
+	for {
+		select {
+		case actual := <-result:
+			if actual.(string) != "second" {
+				t.Errorf("wrong val: expected: %v actual: %v", "second", actual)
+			}
+			close(release)
+			<-done
+			return
+		default:
+		}
+		if clock.Waiters() > 0 {
+			clock.Advance(10 * time.Second)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSafeSetReleasesLockOnError(t *testing.T) {
+	s := newFakeServer()
+	defer s.Close()
+
+	var ms = memcached.NewMemcachedStore(s.Addr())
+
+	key := "key"
+	exp := 10 * time.Minute
+	opts := remember.Options{SafeSet: true, LockTimeout: time.Minute}
+
+	failingQuery := func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("query failed")
+	}
+
+	_, _, err := remember.Cache(ctx, ms, key, exp, failingQuery, opts)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The lock must not block subsequent callers
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	start := time.Now()
+	actual, _, _ := remember.Cache(ctx, ms, key, exp, slowQuery, opts)
+
+	if actual.(string) != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("lock was not released")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/snapshot"
+)
+
+// ErrNoServers is returned by ScanRaw when the servers are not known.
+// Stores must be created using NewMemcachedStore or NewMemachedStoreFromSelector.
+var ErrNoServers = errors.New("memcached: servers are not known")
+
+// ScanRaw calls fn for each key in the namespace with its remaining time to live
+// (snapshot.NoTTL if it does not expire) and its gob encoded value.
+//
+// Keys are found using the "lru_crawler metadump" command, which requires
+// memcached 1.4.31 or later. Keys that were hashed (see Hasher) can not be
+// recovered and are not included.
+func (c *MemcachedStore) ScanRaw(ctx context.Context, fn func(key string, ttl time.Duration, value []byte) error) error {
+	if c.selector == nil {
+		return ErrNoServers
+	}
+
+	gen, err := c.generation()
+	if err != nil {
+		return err
+	}
+	prefix := c.Namespace + ":" + gen + ":"
+
+	var keys []metaKey
+	err = c.selector.Each(func(addr net.Addr) error {
+		k, err := metadump(ctx, addr)
+		keys = append(keys, k...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Values are fetched in batches to reduce the number of round trips
+	var batch []metaKey
+	for _, k := range keys {
+		if !strings.HasPrefix(k.key, prefix) {
+			continue
+		}
+
+		batch = append(batch, k)
+		if len(batch) == scanBatchSize {
+			if err := c.scanBatch(ctx, prefix, batch, fn); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		return c.scanBatch(ctx, prefix, batch, fn)
+	}
+	return nil
+}
+
+// scanBatchSize is the number of values fetched by ScanRaw in a single round trip.
+const scanBatchSize = 100
+
+// scanBatch fetches the values of keys and calls fn for each one.
+func (c *MemcachedStore) scanBatch(ctx context.Context, prefix string, keys []metaKey, fn func(key string, ttl time.Duration, value []byte) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.key
+	}
+
+	items, err := c.Client.GetMulti(names)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		item, found := items[k.key]
+		if !found {
+			// Key deleted since it was found
+			continue
+		}
+
+		if isLock(item.Value) {
+			continue
+		}
+
+		ttl := snapshot.NoTTL
+		if k.exp >= 0 {
+			if ttl = time.Until(time.Unix(k.exp, 0)); ttl <= 0 {
+				continue
+			}
+		}
+
+		if err := fn(strings.TrimPrefix(k.key, prefix), ttl, item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLock reports whether value is the gob encoded placeholder stored by SafeSet.
+// Only small values that mention the placeholder's type are decoded.
+func isLock(value []byte) bool {
+	if len(value) > 256 || !bytes.Contains(value, []byte("remember-go.lock")) {
+		return false
+	}
+
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&v); err != nil {
+		return false
+	}
+	return remember.IsLock(v)
+}
+
+// SetRaw stores a gob encoded value (such as one provided by ScanRaw).
+// A negative ttl indicates that the value does not expire.
+func (c *MemcachedStore) SetRaw(ctx context.Context, key string, ttl time.Duration, value []byte) error {
+	k, err := c.key(key)
+	if err != nil {
+		return err
+	}
+
+	return c.Client.Set(&memcache.Item{
+		Key:        k,
+		Expiration: memcachedExpiration(ttl, time.Now()),
+		Value:      value,
+	})
+}
+
+// metaKey is a key listed by "lru_crawler metadump".
+type metaKey struct {
+	key string
+	exp int64 // Unix time. -1 means no expiration.
+}
+
+// metadump lists the keys stored on a server.
+//
+// See: https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+func metadump(ctx context.Context, addr net.Addr) ([]metaKey, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, addr.Network(), addr.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("lru_crawler metadump all\r\n")); err != nil {
+		return nil, err
+	}
+
+	var keys []metaKey
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "END":
+			return keys, nil
+		case strings.HasPrefix(line, "ERROR"), strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"), strings.HasPrefix(line, "BUSY"):
+			return nil, fmt.Errorf("memcached: metadump %s: %s", addr, line)
+		}
+
+		k := metaKey{exp: -1}
+		for _, field := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(field, "key="):
+				k.key, err = url.PathUnescape(field[len("key="):])
+				if err != nil {
+					return nil, fmt.Errorf("memcached: metadump %s: %w", addr, err)
+				}
+			case strings.HasPrefix(field, "exp="):
+				k.exp, _ = strconv.ParseInt(field[len("exp="):], 10, 64)
+			}
+		}
+		if k.key != "" {
+			keys = append(keys, k)
+		}
+	}
+}
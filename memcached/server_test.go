@@ -0,0 +1,307 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memcached_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeServer is an in-process server that implements the subset of the
+// memcached text protocol used by the gomemcache client.
+//
+// See: https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+type fakeServer struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	now     time.Time
+	items   map[string]*fakeItem
+	nextCas uint64
+	conns   []net.Conn
+}
+
+type fakeItem struct {
+	value      []byte
+	flags      uint32
+	expiration int32 // as received from the client
+	expiresAt  time.Time
+	cas        uint64
+}
+
+func newFakeServer() *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &fakeServer{
+		ln:    ln,
+		now:   time.Now(),
+		items: map[string]*fakeItem{},
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeServer) Addr() string { return s.ln.Addr().String() }
+
+// Close stops the server and closes its connections.
+func (s *fakeServer) Close() {
+	s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Advance moves the server's clock forward.
+func (s *fakeServer) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// Item returns the raw item stored for key.
+func (s *fakeServer) Item(key string) (fakeItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.lookup(key)
+	if it == nil {
+		return fakeItem{}, false
+	}
+	return *it, true
+}
+
+// Keys returns the keys of all live items.
+func (s *fakeServer) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []string{}
+	for k := range s.items {
+		if s.lookup(k) != nil {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// lookup returns the live item for key. s.mu must be held.
+func (s *fakeServer) lookup(key string) *fakeItem {
+	it, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !it.expiresAt.IsZero() && !s.now.Before(it.expiresAt) {
+		delete(s.items, key)
+		return nil
+	}
+	return it
+}
+
+// expiresAt interprets exp the same way memcached does. s.mu must be held.
+func (s *fakeServer) expiresAt(exp int32) time.Time {
+	switch {
+	case exp == 0:
+		return time.Time{}
+	case exp < 0:
+		return s.now
+	case exp <= 60*60*24*30:
+		return s.now.Add(time.Duration(exp) * time.Second)
+	default:
+		return time.Unix(int64(exp), 0)
+	}
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		s.mu.Lock()
+		resp, err := s.handle(fields, rw.Reader)
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+
+		rw.WriteString(resp)
+		if rw.Flush() != nil {
+			return
+		}
+	}
+}
+
+// handle executes a single command. s.mu must be held.
+func (s *fakeServer) handle(fields []string, r *bufio.Reader) (string, error) {
+	switch cmd := fields[0]; cmd {
+	case "get", "gets":
+		var b strings.Builder
+		for _, key := range fields[1:] {
+			it := s.lookup(key)
+			if it == nil {
+				continue
+			}
+			if cmd == "gets" {
+				fmt.Fprintf(&b, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+			} else {
+				fmt.Fprintf(&b, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+			}
+			b.Write(it.value)
+			b.WriteString("\r\n")
+		}
+		b.WriteString("END\r\n")
+		return b.String(), nil
+
+	case "set", "add", "replace", "cas":
+		if len(fields) < 5 {
+			return "ERROR\r\n", nil
+		}
+		flags, _ := strconv.ParseUint(fields[2], 10, 32)
+		exp, _ := strconv.ParseInt(fields[3], 10, 32)
+		size, _ := strconv.Atoi(fields[4])
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+
+		key := fields[1]
+		existing := s.lookup(key)
+
+		switch cmd {
+		case "add":
+			if existing != nil {
+				return "NOT_STORED\r\n", nil
+			}
+		case "replace":
+			if existing == nil {
+				return "NOT_STORED\r\n", nil
+			}
+		case "cas":
+			if existing == nil {
+				return "NOT_FOUND\r\n", nil
+			}
+			if len(fields) < 6 || fields[5] != strconv.FormatUint(existing.cas, 10) {
+				return "EXISTS\r\n", nil
+			}
+		}
+
+		s.nextCas++
+		s.items[key] = &fakeItem{
+			value:      data[:size],
+			flags:      uint32(flags),
+			expiration: int32(exp),
+			expiresAt:  s.expiresAt(int32(exp)),
+			cas:        s.nextCas,
+		}
+		return "STORED\r\n", nil
+
+	case "delete":
+		if len(fields) < 2 {
+			return "ERROR\r\n", nil
+		}
+		if s.lookup(fields[1]) == nil {
+			return "NOT_FOUND\r\n", nil
+		}
+		delete(s.items, fields[1])
+		return "DELETED\r\n", nil
+
+	case "incr", "decr":
+		if len(fields) < 3 {
+			return "ERROR\r\n", nil
+		}
+		it := s.lookup(fields[1])
+		if it == nil {
+			return "NOT_FOUND\r\n", nil
+		}
+		val, err := strconv.ParseUint(string(it.value), 10, 64)
+		if err != nil {
+			return "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n", nil
+		}
+		delta, _ := strconv.ParseUint(fields[2], 10, 64)
+		if cmd == "incr" {
+			val += delta
+		} else if delta > val {
+			val = 0
+		} else {
+			val -= delta
+		}
+		s.nextCas++
+		it.value = []byte(strconv.FormatUint(val, 10))
+		it.cas = s.nextCas
+		return string(it.value) + "\r\n", nil
+
+	case "touch":
+		if len(fields) < 3 {
+			return "ERROR\r\n", nil
+		}
+		it := s.lookup(fields[1])
+		if it == nil {
+			return "NOT_FOUND\r\n", nil
+		}
+		exp, _ := strconv.ParseInt(fields[2], 10, 32)
+		it.expiration = int32(exp)
+		it.expiresAt = s.expiresAt(int32(exp))
+		return "TOUCHED\r\n", nil
+
+	case "flush_all":
+		s.items = map[string]*fakeItem{}
+		return "OK\r\n", nil
+
+	case "lru_crawler":
+		if len(fields) < 3 || fields[1] != "metadump" {
+			return "CLIENT_ERROR bad command line format\r\n", nil
+		}
+		var b strings.Builder
+		for k := range s.items {
+			it := s.lookup(k)
+			if it == nil {
+				continue
+			}
+			exp := int64(-1)
+			if !it.expiresAt.IsZero() {
+				exp = it.expiresAt.Unix()
+			}
+			fmt.Fprintf(&b, "key=%s exp=%d la=0 cas=%d fetch=no cls=1 size=%d\r\n", url.PathEscape(k), exp, it.cas, len(it.value))
+		}
+		b.WriteString("END\r\n")
+		return b.String(), nil
+
+	case "version":
+		return "VERSION fake\r\n", nil
+	}
+
+	return "ERROR\r\n", nil
+}
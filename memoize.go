@@ -0,0 +1,125 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Memoize returns a cached version of fn. The returned value has the same type as
+// fn, so it must be type asserted before use.
+//
+// fn must be a function that returns a value (and optionally an error as the
+// second return value). If its first argument is a context.Context, it is used
+// when calling Cache. It is not part of the key.
+//
+// The key is derived from fn's name and the remaining arguments (see EncodeKey).
+// Closures created by the same function literal (and method values of the same
+// method) share the same name, so they should not be memoized with the same
+// Conner unless they behave identically.
+//
+// If the arguments can not be encoded or the cache is unavailable, fn is called directly.
+// Memoize panics if fn is not a function with a supported signature.
+//
+// Example:
+//
+//	getBook := remember.Memoize(getBookFromDB, ms, 10*time.Minute).(func(context.Context, int) (Book, error))
+//	book, err := getBook(ctx, 42)
+func Memoize(fn interface{}, c Conner, expiration time.Duration, options ...Options) interface{} {
+
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+
+	if ft.Kind() != reflect.Func {
+		panic(fmt.Sprintf("remember: Memoize requires a function but got %v", ft))
+	}
+	if ft.NumOut() == 0 || ft.NumOut() > 2 || (ft.NumOut() == 2 && ft.Out(1) != errorType) {
+		panic(fmt.Sprintf("remember: Memoize requires a function that returns a value and optionally an error but got %v", ft))
+	}
+
+	hasCtx := ft.NumIn() > 0 && ft.In(0) == contextType
+	hasErr := ft.NumOut() == 2
+	name := runtime.FuncForPC(fv.Pointer()).Name()
+
+	call := func(args []reflect.Value) []reflect.Value {
+		if ft.IsVariadic() {
+			return fv.CallSlice(args)
+		}
+		return fv.Call(args)
+	}
+
+	// results converts out and err into the function's return values.
+	results := func(out interface{}, err error) []reflect.Value {
+		res := reflect.New(ft.Out(0)).Elem()
+		if out != nil && err == nil {
+			res.Set(reflect.ValueOf(out))
+		}
+		if !hasErr {
+			return []reflect.Value{res}
+		}
+		errVal := reflect.New(errorType).Elem()
+		if err != nil {
+			errVal.Set(reflect.ValueOf(err))
+		}
+		return []reflect.Value{res, errVal}
+	}
+
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+
+		ctx := context.Background()
+		keyArgs := args
+		if hasCtx {
+			if c, ok := args[0].Interface().(context.Context); ok && c != nil {
+				ctx = c
+			}
+			keyArgs = args[1:]
+		}
+
+		key, err := memoizeKey(name, keyArgs)
+		if err != nil {
+			return call(args)
+		}
+
+		var called bool
+
+		slowQuery := func(ctx context.Context) (interface{}, error) {
+			called = true
+			res := call(args)
+			if hasErr && !res[1].IsNil() {
+				return nil, res[1].Interface().(error)
+			}
+			return res[0].Interface(), nil
+		}
+
+		out, _, err := Cache(ctx, c, key, expiration, slowQuery, options...)
+		if !called && (err != nil || (out != nil && !reflect.TypeOf(out).AssignableTo(ft.Out(0)))) {
+			// Cache is unavailable or the cached value has the wrong type
+			return call(args)
+		}
+		return results(out, err)
+	}).Interface()
+}
+
+// memoizeKey generates a key from the function's name and its arguments.
+func memoizeKey(name string, args []reflect.Value) (string, error) {
+	vals := make([]interface{}, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Interface()
+	}
+
+	encoded, err := EncodeKey(vals)
+	if err != nil {
+		return "", err
+	}
+
+	return CreateKey(false, "|", "memoize|func|args", "memoize", name, encoded), nil
+}
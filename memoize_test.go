@@ -0,0 +1,118 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+)
+
+type book struct {
+	ID    int
+	Title string
+}
+
+var ctx = context.Background()
+
+var calls int
+
+func getBook(ctx context.Context, id int, tags map[string]bool) (book, error) {
+	calls++
+	if id < 0 {
+		return book{}, errors.New("invalid id")
+	}
+	return book{id, fmt.Sprintf("title %d", calls)}, nil
+}
+
+func join(sep string, parts ...string) string {
+	calls++
+	out := fmt.Sprint(calls)
+	for _, p := range parts {
+		out += sep + p
+	}
+	return out
+}
+
+func TestMemoize(t *testing.T) {
+	calls = 0
+	ms := memory.NewMemoryStore(10 * time.Minute)
+
+	cached := remember.Memoize(getBook, ms, 10*time.Minute).(func(context.Context, int, map[string]bool) (book, error))
+
+	b1, err := cached(ctx, 1, map[string]bool{"a": true, "b": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Map order does not affect the key
+	b2, _ := cached(ctx, 1, map[string]bool{"b": true, "a": true})
+	if b1 != b2 {
+		t.Errorf("wrong val: expected: %v actual: %v", b1, b2)
+	}
+
+	// Different arguments
+	b3, _ := cached(ctx, 2, nil)
+	if b3.Title != "title 2" {
+		t.Errorf("wrong val: expected: %v actual: %v", "title 2", b3.Title)
+	}
+
+	// Errors are not cached
+	if _, err := cached(ctx, -1, nil); err == nil {
+		t.Errorf("expected error")
+	}
+	cached(ctx, -1, nil)
+
+	if calls != 4 {
+		t.Errorf("wrong number of calls: expected: %v actual: %v", 4, calls)
+	}
+}
+
+func TestMemoizeVariadicAndOptions(t *testing.T) {
+	calls = 0
+	ms := memory.NewMemoryStore(10 * time.Minute)
+
+	cached := remember.Memoize(join, ms, 10*time.Minute).(func(string, ...string) string)
+
+	expected := "1-a-b"
+	for i := 0; i < 2; i++ {
+		if actual := cached("-", "a", "b"); actual != expected {
+			t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+		}
+	}
+
+	if actual := cached("-", "a"); actual != "2-a" {
+		t.Errorf("wrong val: expected: %v actual: %v", "2-a", actual)
+	}
+
+	// Options are bound at wrap time
+	fresh := remember.Memoize(join, ms, 10*time.Minute, remember.Options{UseFreshData: true}).(func(string, ...string) string)
+	if actual := fresh("-", "a", "b"); actual != "3-a-b" {
+		t.Errorf("wrong val: expected: %v actual: %v", "3-a-b", actual)
+	}
+	if actual := cached("-", "a", "b"); actual != "3-a-b" {
+		t.Errorf("wrong val: expected: %v actual: %v", "3-a-b", actual)
+	}
+}
+
+func TestMemoizeInvalidFunction(t *testing.T) {
+	for _, fn := range []interface{}{
+		"not a function",
+		func() {},
+		func() (int, int) { return 0, 0 },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for %T", fn)
+				}
+			}()
+			remember.Memoize(fn, memory.NewMemoryStore(time.Minute), time.Minute)
+		}()
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/snapshot"
+)
+
+// ErrItemTooLarge signifies that the item to store is larger than the
+// maximum size of the cache.
+var ErrItemTooLarge = errors.New("item too large")
+
+// BoundedConfig is used to configure a BoundedMemoryStore.
+type BoundedConfig struct {
+
+	// MaxEntries is the maximum number of entries stored.
+	// 0 means there is no limit.
+	MaxEntries int
+
+	// MaxBytes is the approximate maximum size of all the entries stored.
+	// 0 means there is no limit.
+	MaxBytes int64
+
+	// Policy determines which entry is evicted when the cache is full.
+	// The default is LRU.
+	Policy EvictionPolicy
+
+	// CleanupInterval is how often expired entries are deleted.
+	// 0 means expired entries are only deleted when accessed or evicted.
+	CleanupInterval time.Duration
+
+	// Sizer returns the approximate size of an entry in bytes.
+	// If not set, the size is estimated using reflection.
+	Sizer func(key string, item interface{}) int64
+
+	// Clock is used to determine when entries expire.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// BoundedStats contains statistics about a BoundedMemoryStore.
+type BoundedStats struct {
+	Entries     int    // Number of entries stored
+	Bytes       int64  // Approximate size of entries stored
+	Evictions   uint64 // Number of entries evicted to make room for other entries
+	Expirations uint64 // Number of expired entries deleted
+}
+
+// BoundedMemoryStore is used to create an in-memory cache that is bounded
+// by the number of entries and/or their approximate size.
+//
+// Unlike MemoryStore, it will not grow indefinitely when many unique keys are stored.
+type BoundedMemoryStore struct {
+	mu     sync.Mutex
+	cfg    BoundedConfig
+	items  map[string]*entry
+	policy policy
+	stats  BoundedStats
+	stop   chan struct{}
+	clock  remember.Clock
+}
+
+// entry is an item stored in a BoundedMemoryStore.
+type entry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires int64 // UnixNano. 0 means no expiration.
+
+	// Used by policies
+	elem     *list.Element
+	frequent bool
+	freq     uint64
+	tick     uint64
+	index    int
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expires > 0 && now >= e.expires
+}
+
+// NewBoundedMemoryStore creates a bounded in-memory cache.
+func NewBoundedMemoryStore(cfg BoundedConfig) *BoundedMemoryStore {
+	c := &BoundedMemoryStore{
+		cfg:    cfg,
+		items:  map[string]*entry{},
+		policy: newPolicy(cfg.Policy, cfg.MaxEntries),
+		clock:  remember.ClockOrDefault(cfg.Clock),
+	}
+
+	if cfg.CleanupInterval > 0 {
+		c.stop = make(chan struct{})
+		go c.janitor(cfg.CleanupInterval, c.stop)
+	}
+
+	return c
+}
+
+// Conn does nothing for this storage driver.
+func (c *BoundedMemoryStore) Conn(ctx context.Context) (remember.Cacher, error) {
+	return c, nil
+}
+
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *BoundedMemoryStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// StorePointer sets whether a storage driver requires itemToStore to be
+// stored as a pointer or as a concrete value.
+func (c *BoundedMemoryStore) StorePointer() bool {
+	return false
+}
+
+// Get returns a value from the cache if the key exists.
+func (c *BoundedMemoryStore) Get(key string) (_ interface{}, found bool, _ error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.items[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	if e.expired(c.clock.Now().UnixNano()) {
+		c.delete(e)
+		c.stats.Expirations++
+		return nil, false, nil
+	}
+
+	c.policy.access(e)
+	return e.value, true, nil
+}
+
+// Set sets a item into the cache for a particular key.
+// ErrItemTooLarge is returned if the item is larger than MaxBytes.
+func (c *BoundedMemoryStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+
+	var size int64
+	if c.cfg.Sizer != nil {
+		size = c.cfg.Sizer(key, itemToStore)
+	} else {
+		size = int64(len(key)) + sizeOf(itemToStore)
+	}
+
+	if c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		return ErrItemTooLarge
+	}
+
+	var expires int64
+	if expiration > 0 {
+		expires = c.clock.Now().Add(expiration).UnixNano()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.items[key]; found {
+		c.stats.Bytes += size - e.size
+		e.value = itemToStore
+		e.size = size
+		e.expires = expires
+		c.policy.access(e)
+	} else {
+		e = &entry{
+			key:     key,
+			value:   itemToStore,
+			size:    size,
+			expires: expires,
+		}
+		c.items[key] = e
+		c.stats.Bytes += size
+
+		// Make room before adding e to the policy so that e is never
+		// immediately evicted.
+		c.evict()
+		c.policy.add(e)
+		return nil
+	}
+
+	c.evict()
+	return nil
+}
+
+// Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing.
+func (c *BoundedMemoryStore) Close() {}
+
+// Forget clears the value from the cache for the particular key.
+func (c *BoundedMemoryStore) Forget(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.items[key]; found {
+		c.delete(e)
+	}
+	return nil
+}
+
+// ForgetAll clears all values from the cache.
+func (c *BoundedMemoryStore) ForgetAll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = map[string]*entry{}
+	c.policy.reset()
+	c.stats.Bytes = 0
+	return nil
+}
+
+// TTL returns the remaining time to live of key.
+// A negative ttl indicates that the key does not expire.
+func (c *BoundedMemoryStore) TTL(ctx context.Context, key string) (ttl time.Duration, found bool, _ error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.items[key]
+	if !found {
+		return 0, false, nil
+	}
+
+	now := c.clock.Now().UnixNano()
+	if e.expired(now) {
+		return 0, false, nil
+	}
+	if e.expires == 0 {
+		return NoExpiration, true, nil
+	}
+	return time.Duration(e.expires - now), true, nil
+}
+
+// ForgetPrefix clears the values from the cache for all keys starting with prefix.
+// It returns the number of keys cleared.
+func (c *BoundedMemoryStore) ForgetPrefix(ctx context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int
+	for key, e := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.delete(e)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Scan calls fn for each unexpired entry with its remaining time to live
+// (snapshot.NoTTL if it does not expire) and its value. Entries that are stored
+// while Scan is running are not included.
+func (c *BoundedMemoryStore) Scan(ctx context.Context, fn func(key string, ttl time.Duration, value interface{}) error) error {
+	type item struct {
+		key   string
+		ttl   time.Duration
+		value interface{}
+	}
+
+	c.mu.Lock()
+	now := c.clock.Now().UnixNano()
+	items := make([]item, 0, len(c.items))
+	for key, e := range c.items {
+		if e.expired(now) {
+			continue
+		}
+		ttl := snapshot.NoTTL
+		if e.expires > 0 {
+			ttl = time.Duration(e.expires - now)
+		}
+		items = append(items, item{key, ttl, e.value})
+	}
+	c.mu.Unlock()
+
+	// fn is called without holding the lock so that it can use the store.
+	for _, it := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(it.key, it.ttl, it.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns statistics about the cache.
+func (c *BoundedMemoryStore) Stats() BoundedStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.items)
+	return stats
+}
+
+// DeleteExpired deletes all expired entries.
+func (c *BoundedMemoryStore) DeleteExpired() {
+	now := c.clock.Now().UnixNano()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.items {
+		if e.expired(now) {
+			c.delete(e)
+			c.stats.Expirations++
+		}
+	}
+}
+
+// StopCleanup stops the background deletion of expired entries.
+func (c *BoundedMemoryStore) StopCleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *BoundedMemoryStore) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// delete removes e from the cache. c.mu must be held.
+func (c *BoundedMemoryStore) delete(e *entry) {
+	c.policy.remove(e)
+	delete(c.items, e.key)
+	c.stats.Bytes -= e.size
+}
+
+// evict removes entries until the cache is within its limits. c.mu must be held.
+func (c *BoundedMemoryStore) evict() {
+	for c.full() {
+		e := c.policy.evict()
+		if e == nil {
+			return
+		}
+		delete(c.items, e.key)
+		c.stats.Bytes -= e.size
+		c.stats.Evictions++
+	}
+}
+
+// full reports whether the cache exceeds its limits. c.mu must be held.
+func (c *BoundedMemoryStore) full() bool {
+	if c.cfg.MaxEntries > 0 && len(c.items) > c.cfg.MaxEntries {
+		return true
+	}
+	if c.cfg.MaxBytes > 0 && c.stats.Bytes > c.cfg.MaxBytes {
+		return true
+	}
+	return false
+}
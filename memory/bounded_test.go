@@ -0,0 +1,228 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+)
+
+var ctx = context.Background()
+
+func TestBoundedKeyBasicOperation(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 10})
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	remember.Cache(ctx, ms, key, exp, slowQuery)
+	actual, found, _ := remember.Cache(ctx, ms, key, exp, slowQuery)
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestBoundedMaxEntries(t *testing.T) {
+	for _, policy := range []memory.EvictionPolicy{memory.LRU, memory.LFU, memory.ARC} {
+		t.Run(policy.String(), func(t *testing.T) {
+			var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 100, Policy: policy})
+
+			for i := 0; i < 1000; i++ {
+				ms.Set(fmt.Sprintf("key-%d", i), memory.NoExpiration, i)
+			}
+
+			stats := ms.Stats()
+			if stats.Entries != 100 {
+				t.Errorf("wrong entries: expected: %v actual: %v", 100, stats.Entries)
+			}
+			if stats.Evictions != 900 {
+				t.Errorf("wrong evictions: expected: %v actual: %v", 900, stats.Evictions)
+			}
+		})
+	}
+}
+
+func TestBoundedMaxBytes(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxBytes: 10000})
+
+	val := strings.Repeat("x", 1000)
+
+	for i := 0; i < 100; i++ {
+		ms.Set(fmt.Sprintf("key-%d", i), memory.NoExpiration, val)
+	}
+
+	stats := ms.Stats()
+	if stats.Bytes > 10000 {
+		t.Errorf("size exceeds limit: %v", stats.Bytes)
+	}
+	if stats.Entries == 0 || stats.Entries >= 10 {
+		t.Errorf("wrong entries: %v", stats.Entries)
+	}
+
+	err := ms.Set("too-large", memory.NoExpiration, strings.Repeat("x", 20000))
+	if err != memory.ErrItemTooLarge {
+		t.Errorf("wrong err: expected: %v actual: %v", memory.ErrItemTooLarge, err)
+	}
+}
+
+func TestBoundedSizer(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{
+		MaxBytes: 10,
+		Sizer: func(key string, item interface{}) int64 {
+			return 3
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		ms.Set(fmt.Sprintf("key-%d", i), memory.NoExpiration, i)
+	}
+
+	stats := ms.Stats()
+	if stats.Entries != 3 || stats.Bytes != 9 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestBoundedLRU(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 2, Policy: memory.LRU})
+
+	ms.Set("a", memory.NoExpiration, 1)
+	ms.Set("b", memory.NoExpiration, 2)
+	ms.Get("a")
+	ms.Set("c", memory.NoExpiration, 3)
+
+	assertFound(t, ms, "a", true)
+	assertFound(t, ms, "b", false)
+	assertFound(t, ms, "c", true)
+}
+
+func TestBoundedLFU(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 2, Policy: memory.LFU})
+
+	ms.Set("a", memory.NoExpiration, 1)
+	ms.Set("b", memory.NoExpiration, 2)
+	ms.Get("a")
+	ms.Get("a")
+	ms.Get("b")
+	ms.Set("c", memory.NoExpiration, 3) // b has a lower frequency than a
+
+	assertFound(t, ms, "a", true)
+	assertFound(t, ms, "b", false)
+	assertFound(t, ms, "c", true)
+}
+
+func TestBoundedARC(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 4, Policy: memory.ARC})
+
+	// Frequently used entries
+	for _, k := range []string{"a", "b"} {
+		ms.Set(k, memory.NoExpiration, k)
+		ms.Get(k)
+	}
+
+	// A scan of entries used only once must not evict the frequently used entries
+	for i := 0; i < 100; i++ {
+		ms.Set(fmt.Sprintf("scan-%d", i), memory.NoExpiration, i)
+	}
+
+	assertFound(t, ms, "a", true)
+	assertFound(t, ms, "b", true)
+
+	if stats := ms.Stats(); stats.Entries != 4 {
+		t.Errorf("wrong entries: expected: %v actual: %v", 4, stats.Entries)
+	}
+}
+
+func TestBoundedExpiration(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 10})
+
+	ms.Set("short", 10*time.Millisecond, 1)
+	ms.Set("forever", memory.NoExpiration, 2)
+
+	time.Sleep(20 * time.Millisecond)
+
+	assertFound(t, ms, "short", false)
+	assertFound(t, ms, "forever", true)
+
+	ms.Set("short", 10*time.Millisecond, 1)
+	time.Sleep(20 * time.Millisecond)
+	ms.DeleteExpired()
+
+	stats := ms.Stats()
+	if stats.Entries != 1 || stats.Expirations != 2 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestBoundedForget(t *testing.T) {
+	var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 10, Policy: memory.ARC})
+
+	ms.Set("a", memory.NoExpiration, 1)
+	ms.Set("b", memory.NoExpiration, 2)
+
+	ms.Forget("a")
+	assertFound(t, ms, "a", false)
+	assertFound(t, ms, "b", true)
+
+	ms.ForgetAll()
+	assertFound(t, ms, "b", false)
+
+	if stats := ms.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestBoundedConcurrency(t *testing.T) {
+	for _, policy := range []memory.EvictionPolicy{memory.LRU, memory.LFU, memory.ARC} {
+		var ms = memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 50, Policy: policy, CleanupInterval: time.Millisecond})
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := fmt.Sprintf("key-%d", (g*i)%200)
+					ms.Set(key, time.Millisecond, i)
+					ms.Get(key)
+					if i%100 == 0 {
+						ms.Forget(key)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		ms.StopCleanup()
+
+		if stats := ms.Stats(); stats.Entries > 50 {
+			t.Errorf("%v: too many entries: %v", policy, stats.Entries)
+		}
+	}
+}
+
+func assertFound(t *testing.T, ms *memory.BoundedMemoryStore, key string, expected bool) {
+	t.Helper()
+
+	_, found, _ := ms.Get(key)
+	if found != expected {
+		t.Errorf("wrong found for %q: expected: %v actual: %v", key, expected, found)
+	}
+}
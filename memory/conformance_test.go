@@ -0,0 +1,56 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/memory"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+func TestConformance(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		ms := memory.NewMemoryStore(10 * time.Minute)
+		ms.Clock = clock
+		return ms, nil
+	}, cachertest.Config{
+		NoExpiration: memory.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			clock.Advance(d)
+		},
+	})
+}
+
+func TestBoundedConformance(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	for _, policy := range []memory.EvictionPolicy{memory.LRU, memory.LFU, memory.ARC} {
+		policy := policy
+		t.Run(policy.String(), func(t *testing.T) {
+			cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+				ms := memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 1000, Policy: policy, Clock: clock})
+				return ms, nil
+			}, cachertest.Config{
+				NoExpiration: memory.NoExpiration,
+				Advance: func(c remember.Conner, d time.Duration) {
+					clock.Advance(d)
+				},
+			})
+		})
+	}
+}
+
+func TestSystemClockConformance(t *testing.T) {
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		return memory.NewMemoryStore(10 * time.Minute), nil
+	}, cachertest.Config{
+		NoExpiration: memory.NoExpiration,
+		Expiration:   50 * time.Millisecond,
+	})
+}
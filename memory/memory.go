@@ -4,10 +4,12 @@ package memory
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/snapshot"
 )
 
 // NoExpiration is used to indicate that data should not expire from the cache.
@@ -15,21 +17,46 @@ const NoExpiration time.Duration = -1
 
 // MemoryStore is used to create an in-memory cache.
 type MemoryStore struct {
-	cache *cache.Cache
+	cache             *cache.Cache
+	defaultExpiration time.Duration
+
+	// Clock is used to determine when items expire. It must be set before the
+	// store is used. If not set, the system's time is used.
+	//
+	// When set, expiration is determined only by the Clock. Expired items are
+	// then not deleted by the cleanup, but are no longer returned.
+	Clock remember.Clock
+}
+
+// clockItem is stored when a Clock is set so that the expiration can be
+// determined using the Clock.
+type clockItem struct {
+	value   interface{}
+	expires time.Time // Zero means no expiration.
 }
 
 // NewMemoryStore creates an in-memory cache where the expired items
 // are deleted based on the cleanupInterval duration.
 func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
 	return &MemoryStore{
-		cache: cache.New(cache.NoExpiration, cleanupInterval),
+		cache:             cache.New(cache.NoExpiration, cleanupInterval),
+		defaultExpiration: NoExpiration,
 	}
 }
 
 // NewMemoryStoreFrom creates an in-memory cache directly from a *cache.Cache object.
-func NewMemoryStoreFrom(cache *cache.Cache) *MemoryStore {
+//
+// defaultExpiration should be the default expiration that c was created with.
+// It is used for items stored with an expiration of 0 when Clock is set.
+// If not provided, such items do not expire.
+func NewMemoryStoreFrom(c *cache.Cache, defaultExpiration ...time.Duration) *MemoryStore {
+	de := NoExpiration
+	if len(defaultExpiration) > 0 {
+		de = defaultExpiration[0]
+	}
 	return &MemoryStore{
-		cache: cache,
+		cache:             c,
+		defaultExpiration: de,
 	}
 }
 
@@ -38,6 +65,11 @@ func (c *MemoryStore) Conn(ctx context.Context) (remember.Cacher, error) {
 	return c, nil
 }
 
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *MemoryStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
 // StorePointer sets whether a storage driver requires itemToStore to be
 // stored as a pointer or as a concrete value.
 func (c *MemoryStore) StorePointer() bool {
@@ -47,11 +79,31 @@ func (c *MemoryStore) StorePointer() bool {
 // Get returns a value from the cache if the key exists.
 func (c *MemoryStore) Get(key string) (_ interface{}, found bool, _ error) {
 	item, found := c.cache.Get(key)
+	if ci, ok := item.(clockItem); ok {
+		if !ci.expires.IsZero() && !c.Clock.Now().Before(ci.expires) {
+			return nil, false, nil
+		}
+		return ci.value, true, nil
+	}
 	return item, found, nil
 }
 
 // Set sets a item into the cache for a particular key.
 func (c *MemoryStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	if c.Clock != nil {
+		if expiration == cache.DefaultExpiration {
+			expiration = c.defaultExpiration
+		}
+
+		ci := clockItem{value: itemToStore}
+		if expiration > 0 {
+			ci.expires = c.Clock.Now().Add(expiration)
+		}
+
+		// The expiration is determined only by the Clock
+		c.cache.Set(key, ci, cache.NoExpiration)
+		return nil
+	}
 	c.cache.Set(key, itemToStore, expiration)
 	return nil
 }
@@ -71,3 +123,72 @@ func (c *MemoryStore) ForgetAll() error {
 	c.cache.Flush()
 	return nil
 }
+
+// TTL returns the remaining time to live of key.
+// A negative ttl indicates that the key does not expire.
+func (c *MemoryStore) TTL(ctx context.Context, key string) (ttl time.Duration, found bool, _ error) {
+	item, expires, found := c.cache.GetWithExpiration(key)
+	if !found {
+		return 0, false, nil
+	}
+
+	now := time.Now()
+	if ci, ok := item.(clockItem); ok {
+		expires, now = ci.expires, c.Clock.Now()
+	}
+
+	if expires.IsZero() {
+		return NoExpiration, true, nil
+	}
+	if !now.Before(expires) {
+		return 0, false, nil
+	}
+	return expires.Sub(now), true, nil
+}
+
+// ForgetPrefix clears the values from the cache for all keys starting with prefix.
+// It returns the number of keys cleared.
+func (c *MemoryStore) ForgetPrefix(ctx context.Context, prefix string) (int, error) {
+	var n int
+	for key := range c.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.cache.Delete(key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Scan calls fn for each unexpired entry with its remaining time to live
+// (snapshot.NoTTL if it does not expire) and its value.
+func (c *MemoryStore) Scan(ctx context.Context, fn func(key string, ttl time.Duration, value interface{}) error) error {
+	now := time.Now()
+
+	for key, item := range c.cache.Items() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		value, expires := item.Object, time.Time{}
+		if item.Expiration > 0 {
+			expires = time.Unix(0, item.Expiration)
+		}
+
+		at := now
+		if ci, ok := value.(clockItem); ok {
+			value, expires, at = ci.value, ci.expires, c.Clock.Now()
+		}
+
+		ttl := snapshot.NoTTL
+		if !expires.IsZero() {
+			if ttl = expires.Sub(at); ttl <= 0 {
+				continue
+			}
+		}
+
+		if err := fn(key, ttl, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
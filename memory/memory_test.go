@@ -0,0 +1,99 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+// store is implemented by MemoryStore and BoundedMemoryStore.
+type store interface {
+	remember.Cacher
+	TTL(ctx context.Context, key string) (time.Duration, bool, error)
+	ForgetPrefix(ctx context.Context, prefix string) (int, error)
+}
+
+func TestTTLAndForgetPrefix(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	ms := memory.NewMemoryStore(10 * time.Minute)
+	ms.Clock = clock
+
+	stores := map[string]store{
+		"memory":        ms,
+		"memory-system": memory.NewMemoryStore(10 * time.Minute),
+		"bounded":       memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 10, Clock: clock}),
+	}
+
+	for name, s := range stores {
+		s.Set("user:1", time.Hour, 1)
+		s.Set("user:2", memory.NoExpiration, 2)
+		s.Set("other", time.Hour, 3)
+
+		ttl, found, err := s.TTL(ctx, "user:1")
+		if err != nil || !found || ttl <= 59*time.Minute || ttl > time.Hour {
+			t.Errorf("%s: wrong ttl: found: %v ttl: %v err: %v", name, found, ttl, err)
+		}
+
+		ttl, found, _ = s.TTL(ctx, "user:2")
+		if !found || ttl != memory.NoExpiration {
+			t.Errorf("%s: wrong ttl: expected: %v actual: %v", name, memory.NoExpiration, ttl)
+		}
+
+		if _, found, _ := s.TTL(ctx, "missing"); found {
+			t.Errorf("%s: expected key not to be found", name)
+		}
+
+		n, err := s.ForgetPrefix(ctx, "user:")
+		if err != nil || n != 2 {
+			t.Errorf("%s: wrong number of keys forgotten: expected: %v actual: %v (err: %v)", name, 2, n, err)
+		}
+		if _, found, _ := s.Get("other"); !found {
+			t.Errorf("%s: expected key to be found", name)
+		}
+	}
+
+	// Expired keys are not found
+	ms.Set("short", time.Minute, 1)
+	clock.Advance(2 * time.Minute)
+	if _, found, _ := ms.TTL(ctx, "short"); found {
+		t.Errorf("expected key to have expired")
+	}
+}
+
+func TestClockDefaultExpiration(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	// Items stored with an expiration of 0 use the default expiration of the Clock
+	ms := memory.NewMemoryStoreFrom(cache.New(10*time.Millisecond, time.Millisecond), 10*time.Millisecond)
+	ms.Clock = clock
+
+	ms.Set("key", 0, "val")
+
+	time.Sleep(20 * time.Millisecond) // Not expired, since the Clock has not advanced
+	if _, found, _ := ms.Get("key"); !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	if _, found, _ := ms.Get("key"); found {
+		t.Errorf("expected value to not be found in cache")
+	}
+
+	// The default expiration of NewMemoryStore is NoExpiration
+	ms = memory.NewMemoryStore(time.Minute)
+	ms.Clock = clock
+
+	ms.Set("key", 0, "val")
+	clock.Advance(24 * time.Hour)
+	if ttl, found, _ := ms.TTL(ctx, "key"); !found || ttl != memory.NoExpiration {
+		t.Errorf("wrong ttl: expected: %v actual: %v", memory.NoExpiration, ttl)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// EvictionPolicy determines which entry is removed from a BoundedMemoryStore
+// when it is full.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU EvictionPolicy = iota
+
+	// LFU evicts the least frequently used entry. Ties are broken by
+	// evicting the least recently used entry.
+	LFU
+
+	// ARC (Adaptive Replacement Cache) balances between recency and frequency
+	// based on the observed access pattern.
+	//
+	// See: https://en.wikipedia.org/wiki/Adaptive_replacement_cache
+	ARC
+)
+
+// String implements the fmt.Stringer interface.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	case ARC:
+		return "ARC"
+	}
+	return "unknown"
+}
+
+// policy tracks the entries of a BoundedMemoryStore in order to select
+// which one to evict. It is not safe for concurrent use.
+type policy interface {
+	// add is called when a new entry is inserted.
+	add(e *entry)
+
+	// access is called when an existing entry is read or updated.
+	access(e *entry)
+
+	// remove is called when an entry is deleted for any reason other than eviction.
+	remove(e *entry)
+
+	// evict removes and returns the entry that should be evicted.
+	evict() *entry
+
+	// reset removes all entries.
+	reset()
+}
+
+func newPolicy(p EvictionPolicy, capacity int) policy {
+	switch p {
+	case LFU:
+		return &lfuPolicy{}
+	case ARC:
+		return newARCPolicy(capacity)
+	}
+	return newLRUPolicy()
+}
+
+// lruPolicy implements LRU. The front of the list is the most recently used entry.
+type lruPolicy struct {
+	ll *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{ll: list.New()}
+}
+
+func (p *lruPolicy) add(e *entry) {
+	e.elem = p.ll.PushFront(e)
+}
+
+func (p *lruPolicy) access(e *entry) {
+	p.ll.MoveToFront(e.elem)
+}
+
+func (p *lruPolicy) remove(e *entry) {
+	p.ll.Remove(e.elem)
+	e.elem = nil
+}
+
+func (p *lruPolicy) evict() *entry {
+	back := p.ll.Back()
+	if back == nil {
+		return nil
+	}
+	e := back.Value.(*entry)
+	p.remove(e)
+	return e
+}
+
+func (p *lruPolicy) reset() {
+	p.ll.Init()
+}
+
+// lfuPolicy implements LFU using a min-heap ordered by frequency and then
+// by last access.
+type lfuPolicy struct {
+	h    lfuHeap
+	tick uint64
+}
+
+func (p *lfuPolicy) add(e *entry) {
+	p.tick++
+	e.freq = 1
+	e.tick = p.tick
+	heap.Push(&p.h, e)
+}
+
+func (p *lfuPolicy) access(e *entry) {
+	p.tick++
+	e.freq++
+	e.tick = p.tick
+	heap.Fix(&p.h, e.index)
+}
+
+func (p *lfuPolicy) remove(e *entry) {
+	heap.Remove(&p.h, e.index)
+}
+
+func (p *lfuPolicy) evict() *entry {
+	if len(p.h) == 0 {
+		return nil
+	}
+	return heap.Pop(&p.h).(*entry)
+}
+
+func (p *lfuPolicy) reset() {
+	p.h = nil
+}
+
+type lfuHeap []*entry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// arcPolicy implements ARC. t1 contains entries that have been used once
+// recently and t2 contains entries that have been used at least twice.
+// b1 and b2 are "ghost" lists containing the keys of entries recently
+// evicted from t1 and t2 respectively.
+//
+// Since a BoundedMemoryStore may also be bounded by size, the capacity is
+// measured in entries. When the store is not bounded by count, the number
+// of resident entries is used.
+type arcPolicy struct {
+	capacity int
+	p        int // target size of t1
+
+	t1, t2 *list.List // of *entry
+	b1, b2 *list.List // of string
+
+	ghosts map[string]arcGhost
+}
+
+type arcGhost struct {
+	elem     *list.Element
+	frequent bool // whether the ghost is in b2
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		ghosts:   map[string]arcGhost{},
+	}
+}
+
+func (p *arcPolicy) limit() int {
+	if p.capacity > 0 {
+		return p.capacity
+	}
+	if c := p.t1.Len() + p.t2.Len(); c > 0 {
+		return c
+	}
+	return 1
+}
+
+func (p *arcPolicy) add(e *entry) {
+	ghost, ok := p.ghosts[e.key]
+	if !ok {
+		e.elem = p.t1.PushFront(e)
+		e.frequent = false
+		return
+	}
+
+	// The key was recently evicted so adapt the target size of t1
+	c := p.limit()
+	if !ghost.frequent {
+		delta := 1
+		if p.b1.Len() < p.b2.Len() {
+			delta = p.b2.Len() / p.b1.Len()
+		}
+		p.p += delta
+		if p.p > c {
+			p.p = c
+		}
+		p.b1.Remove(ghost.elem)
+	} else {
+		delta := 1
+		if p.b2.Len() < p.b1.Len() {
+			delta = p.b1.Len() / p.b2.Len()
+		}
+		p.p -= delta
+		if p.p < 0 {
+			p.p = 0
+		}
+		p.b2.Remove(ghost.elem)
+	}
+	delete(p.ghosts, e.key)
+
+	e.elem = p.t2.PushFront(e)
+	e.frequent = true
+}
+
+func (p *arcPolicy) access(e *entry) {
+	if e.frequent {
+		p.t2.MoveToFront(e.elem)
+		return
+	}
+	p.t1.Remove(e.elem)
+	e.elem = p.t2.PushFront(e)
+	e.frequent = true
+}
+
+func (p *arcPolicy) remove(e *entry) {
+	if e.frequent {
+		p.t2.Remove(e.elem)
+	} else {
+		p.t1.Remove(e.elem)
+	}
+	e.elem = nil
+}
+
+func (p *arcPolicy) evict() *entry {
+	var (
+		from  *list.List
+		ghost *list.List
+	)
+
+	if p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0) {
+		from, ghost = p.t1, p.b1
+	} else if p.t2.Len() > 0 {
+		from, ghost = p.t2, p.b2
+	} else {
+		return nil
+	}
+
+	e := from.Remove(from.Back()).(*entry)
+	e.elem = nil
+	p.ghosts[e.key] = arcGhost{elem: ghost.PushFront(e.key), frequent: e.frequent}
+
+	// Trim the ghost lists
+	for p.b1.Len()+p.b2.Len() > p.limit() {
+		l := p.b1
+		if p.b1.Len() == 0 {
+			l = p.b2
+		}
+		delete(p.ghosts, l.Remove(l.Back()).(string))
+	}
+
+	return e
+}
+
+func (p *arcPolicy) reset() {
+	p.p = 0
+	p.t1.Init()
+	p.t2.Init()
+	p.b1.Init()
+	p.b2.Init()
+	p.ghosts = map[string]arcGhost{}
+}
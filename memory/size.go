@@ -0,0 +1,92 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package memory
+
+import (
+	"reflect"
+)
+
+// maxSizeDepth limits how deeply nested values are inspected by sizeOf.
+const maxSizeDepth = 32
+
+// sizeOf returns the approximate number of bytes of memory used by v,
+// including memory referenced by pointers, slices, maps and strings.
+func sizeOf(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + indirectSize(rv, map[uintptr]bool{}, 0)
+}
+
+// indirectSize returns the approximate number of bytes referenced by v
+// that are not part of v itself.
+func indirectSize(v reflect.Value, seen map[uintptr]bool, depth int) int64 {
+	if depth > maxSizeDepth {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		e := v.Elem()
+		return int64(e.Type().Size()) + indirectSize(e, seen, depth+1)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		return int64(e.Type().Size()) + indirectSize(e, seen, depth+1)
+
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += indirectSize(v.Index(i), seen, depth+1)
+		}
+		return size
+
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += indirectSize(v.Index(i), seen, depth+1)
+		}
+		return size
+
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		var (
+			t    = v.Type()
+			size int64
+		)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += int64(t.Key().Size()) + int64(t.Elem().Size())
+			size += indirectSize(iter.Key(), seen, depth+1)
+			size += indirectSize(iter.Value(), seen, depth+1)
+		}
+		return size
+
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += indirectSize(v.Field(i), seen, depth+1)
+		}
+		return size
+	}
+
+	return 0
+}
@@ -10,6 +10,9 @@ import (
 )
 
 // NoCache is used for testing purposes.
+//
+// Deprecated: Use remembertest.Mock (with NoStorage set) instead.
+// It also records every operation.
 type NoCache struct{}
 
 // NewNoCache creates a NoCache struct.
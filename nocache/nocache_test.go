@@ -0,0 +1,17 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package nocache_test
+
+import (
+	"testing"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/nocache"
+)
+
+func TestConformance(t *testing.T) {
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		return nocache.NewNoCache(), nil
+	}, cachertest.Config{NoStorage: true})
+}
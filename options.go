@@ -4,9 +4,24 @@ package remember
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// DefaultLockTimeout is the LockTimeout used when SafeSet is enabled and
+// LockTimeout is not set.
+const DefaultLockTimeout = 10 * time.Second
+
+// ErrNotStored is returned by CASCacher's Add when the key already exists.
+var ErrNotStored = errors.New("item not stored")
+
+// ErrCASConflict is returned by CASCacher's CompareAndSwap when the value was
+// modified or removed after it was fetched.
+var ErrCASConflict = errors.New("compare-and-swap conflict")
+
+// ErrInvalidKey is returned when a key is not accepted by a storage driver.
+var ErrInvalidKey = errors.New("invalid key")
+
 // Options is used to change caching behavior.
 type Options struct {
 
@@ -34,6 +49,26 @@ type Options struct {
 	// if a Logger is provided.
 	// See: https://golang.org/pkg/encoding/gob/#Register
 	GobRegister bool
+
+	// SafeSet prevents a slow SlowRetrieve from overwriting a fresher value
+	// (eg. a value stored after the key was forgotten).
+	// While SlowRetrieve is being called, a placeholder lock is stored for the key.
+	// The fetched value is only stored if the lock has not been removed or replaced.
+	// Concurrent callers wait for the value instead of also calling SlowRetrieve.
+	//
+	// The storage driver must implement CASCacher. Otherwise SafeSet is ignored.
+	// SafeSet has no effect when UseFreshData is set.
+	SafeSet bool
+
+	// LockTimeout is the maximum duration that a SafeSet lock is held for.
+	// It is also the maximum duration that concurrent callers will wait for
+	// the value before calling SlowRetrieve themselves.
+	// If not set, DefaultLockTimeout is used.
+	LockTimeout time.Duration
+
+	// Clock is used to determine when a SafeSet lock times out.
+	// If not set, SystemClock is used.
+	Clock Clock
 }
 
 // SlowRetrieve obtains a result when the key is not found in the cache.
@@ -69,3 +104,29 @@ type Cacher interface {
 	// ForgetAll clears all values from the cache.
 	ForgetAll() error
 }
+
+// CASCacher is implemented by storage drivers that support atomic
+// "add" and "compare-and-swap" operations. It is required by the SafeSet option.
+type CASCacher interface {
+	Cacher
+
+	// GetCAS returns a value from the cache if the key exists, along with a token
+	// that identifies the current version of the value.
+	GetCAS(key string) (item interface{}, cas uint64, found bool, err error)
+
+	// Add sets a item into the cache only if the key does not already exist.
+	// ErrNotStored is returned if the key exists.
+	Add(key string, expiration time.Duration, itemToStore interface{}) error
+
+	// CompareAndSwap sets a item into the cache only if the value has not been
+	// modified or removed since it was fetched by GetCAS.
+	// ErrCASConflict is returned otherwise.
+	CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error
+}
+
+// KeyValidator is implemented by storage drivers that restrict the keys they accept.
+// Cache checks the key before communicating with the storage driver.
+type KeyValidator interface {
+	// ValidateKey returns an error wrapping ErrInvalidKey if key is not accepted.
+	ValidateKey(key string) error
+}
@@ -0,0 +1,39 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	red "github.com/rocketlaunchr/remember-go/redis"
+)
+
+func TestConformance(t *testing.T) {
+	var s *miniredis.Miniredis
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		var err error
+		if s, err = miniredis.Run(); err != nil {
+			t.Fatal(err)
+		}
+		addr := s.Addr()
+		return red.NewRedisStore(&redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", addr)
+			},
+		}), s.Close
+	}, cachertest.Config{
+		NoExpiration: red.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			s.FastForward(d)
+		},
+		Break: func(c remember.Conner) {
+			s.Close()
+		},
+	})
+}
@@ -6,10 +6,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/snapshot"
 )
 
 // NoExpiration is used to indicate that data should not expire from the cache.
@@ -41,6 +43,160 @@ func (c *RedisStore) Conn(ctx context.Context) (remember.Cacher, error) {
 	}, nil
 }
 
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (c *RedisStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// TTL returns the remaining time to live of key.
+// A negative ttl indicates that the key does not expire.
+func (c *RedisStore) TTL(ctx context.Context, key string) (ttl time.Duration, found bool, _ error) {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	ms, err := redis.Int64(conn.Do("PTTL", key))
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch ms {
+	case -2:
+		// Key not found
+		return 0, false, nil
+	case -1:
+		return NoExpiration, true, nil
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+// ForgetPrefix clears the values from the cache for all keys starting with prefix.
+// It returns the number of keys cleared.
+//
+// Keys are found using SCAN, so the server is not blocked. Keys that are
+// created while ForgetPrefix is running may not be cleared.
+func (c *RedisStore) ForgetPrefix(ctx context.Context, prefix string) (int, error) {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var (
+		n      int
+		cursor = "0"
+	)
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", escapePattern(prefix)+"*", "COUNT", 1000))
+		if err != nil {
+			return n, err
+		}
+
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return n, err
+		}
+
+		// Keys are deleted individually since they may belong to different cluster slots.
+		for _, key := range keys {
+			deleted, err := redis.Int(conn.Do("DEL", key))
+			if err != nil {
+				return n, err
+			}
+			n += deleted
+		}
+
+		if cursor == "0" {
+			return n, nil
+		}
+	}
+}
+
+// ScanRaw calls fn for each key in the database with its remaining time to live
+// (snapshot.NoTTL if it does not expire) and its gob encoded value.
+//
+// Keys are found using SCAN, so the server is not blocked. Keys that are
+// created or deleted while ScanRaw is running may or may not be included.
+func (c *RedisStore) ScanRaw(ctx context.Context, fn func(key string, ttl time.Duration, value []byte) error) error {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cursor := "0"
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "COUNT", 1000))
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// The values of each batch are fetched in a single round trip
+		for _, key := range keys {
+			conn.Send("PTTL", key)
+			conn.Send("GET", key)
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			ms, err := redis.Int64(conn.Receive())
+			if err != nil {
+				return err
+			}
+			val, err := redis.Bytes(conn.Receive())
+			if err == redis.ErrNil || ms == -2 || isWrongType(err) {
+				// Key deleted since it was found, or not stored by this driver (eg. a hash)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			ttl := snapshot.NoTTL
+			if ms >= 0 {
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+			if err := fn(key, ttl, val); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// SetRaw stores a gob encoded value (such as one provided by ScanRaw).
+// A negative ttl indicates that the value does not expire.
+func (c *RedisStore) SetRaw(ctx context.Context, key string, ttl time.Duration, value []byte) error {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if ttl < 0 {
+		_, err = conn.Do("SET", key, value)
+	} else {
+		ms := int64((ttl + time.Millisecond - 1) / time.Millisecond)
+		_, err = conn.Do("SET", key, value, "PX", ms)
+	}
+	return err
+}
+
 // RedisConn represents a single connection to the redis pool.
 type RedisConn struct {
 	conn redis.Conn
@@ -109,3 +265,22 @@ func (c *RedisConn) ForgetAll() error {
 	_, err := c.conn.Do("FLUSHDB")
 	return err
 }
+
+// isWrongType reports whether err is returned because a key holds a value that is not a string.
+func isWrongType(err error) bool {
+	e, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(e), "WRONGTYPE")
+}
+
+// escapePattern escapes the characters that have a special meaning in a glob-style pattern.
+func escapePattern(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -90,3 +90,103 @@ func TestFetchFromCacheAndDisableCache(t *testing.T) {
 		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
 	}
 }
+
+func TestTTLAndForgetPrefix(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	cache, _ := rs.Conn(ctx)
+	defer cache.Close()
+
+	var val interface{} = "val"
+	cache.Set("user:1", time.Hour, &val)
+	cache.Set("user:2", red.NoExpiration, &val)
+	cache.Set("user:*", time.Hour, &val)
+	cache.Set("other", time.Hour, &val)
+
+	ttl, found, err := rs.TTL(ctx, "user:1")
+	if err != nil || !found || ttl != time.Hour {
+		t.Errorf("wrong ttl: found: %v ttl: %v err: %v", found, ttl, err)
+	}
+
+	ttl, found, _ = rs.TTL(ctx, "user:2")
+	if !found || ttl != red.NoExpiration {
+		t.Errorf("wrong ttl: expected: %v actual: %v", red.NoExpiration, ttl)
+	}
+
+	if _, found, _ := rs.TTL(ctx, "missing"); found {
+		t.Errorf("expected key not to be found")
+	}
+
+	// Special characters in the prefix are not treated as a pattern
+	n, err := rs.ForgetPrefix(ctx, "user:*")
+	if err != nil || n != 1 {
+		t.Errorf("wrong number of keys forgotten: expected: %v actual: %v (err: %v)", 1, n, err)
+	}
+
+	n, _ = rs.ForgetPrefix(ctx, "user:")
+	if n != 2 {
+		t.Errorf("wrong number of keys forgotten: expected: %v actual: %v", 2, n)
+	}
+	if !s.Exists("other") {
+		t.Errorf("expected key to exist")
+	}
+}
+
+func TestScanRaw(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	cache, _ := rs.Conn(ctx)
+	defer cache.Close()
+
+	var val interface{} = "val"
+	cache.Set("key1", time.Hour, &val)
+	cache.Set("key2", red.NoExpiration, &val)
+
+	// Keys that were not stored by the storage driver are skipped
+	s.HSet("hash", "field", "val")
+	s.Lpush("list", "val")
+
+	found := map[string]time.Duration{}
+	err = rs.ScanRaw(ctx, func(key string, ttl time.Duration, value []byte) error {
+		found[key] = ttl
+		return rs.SetRaw(ctx, "copy-"+key, ttl, value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found["key1"] != time.Hour || found["key2"] != red.NoExpiration {
+		t.Errorf("wrong keys: %v", found)
+	}
+
+	actual, _, _ := cache.Get("copy-key1")
+	if actual != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+	if ttl := s.TTL("copy-key1"); ttl != time.Hour {
+		t.Errorf("wrong ttl: expected: %v actual: %v", time.Hour, ttl)
+	}
+	if ttl := s.TTL("copy-key2"); ttl != 0 {
+		t.Errorf("wrong ttl: expected: %v actual: %v", 0, ttl)
+	}
+}
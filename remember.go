@@ -19,6 +19,9 @@ func Cache(ctx context.Context, c Conner, key string, expiration time.Duration,
 		logger        Logger
 		gobRegister   bool
 		onlyLogErrors bool
+		safeSet       bool
+		lockTimeout   time.Duration
+		clock         Clock
 	)
 
 	if options != nil {
@@ -27,6 +30,9 @@ func Cache(ctx context.Context, c Conner, key string, expiration time.Duration,
 		logger = options[0].Logger
 		gobRegister = options[0].GobRegister
 		onlyLogErrors = options[0].OnlyLogErrors
+		safeSet = options[0].SafeSet
+		lockTimeout = options[0].LockTimeout
+		clock = options[0].Clock
 	}
 
 	// Check if cache has been disabled
@@ -45,6 +51,16 @@ func Cache(ctx context.Context, c Conner, key string, expiration time.Duration,
 		return out, false, nil
 	}
 
+	// Check if key is valid
+	if kv, ok := c.(KeyValidator); ok {
+		if err := kv.ValidateKey(key); err != nil {
+			if logger != nil {
+				logger.Log(logPatternRed, "invalid key: "+key+" error: "+err.Error())
+			}
+			return nil, false, err
+		}
+	}
+
 	// Obtain cache connection
 	cache, err := c.Conn(ctx)
 	if err != nil {
@@ -64,6 +80,15 @@ func Cache(ctx context.Context, c Conner, key string, expiration time.Duration,
 		goto fresh
 	}
 
+	if safeSet {
+		if cc, ok := cache.(CASCacher); ok {
+			if lockTimeout <= 0 {
+				lockTimeout = DefaultLockTimeout
+			}
+			return safeCache(ctx, cc, key, expiration, lockTimeout, ClockOrDefault(clock), fn, logger, onlyLogErrors, gobRegister)
+		}
+	}
+
 	// Check if item exists
 	item, found, err = cache.Get(key)
 	if err != nil {
@@ -73,6 +98,11 @@ func Cache(ctx context.Context, c Conner, key string, expiration time.Duration,
 		}
 	}
 
+	if found && err == nil && IsLock(item) {
+		// Another caller is grabbing from SlowRetrieve in SafeSet mode
+		found = false
+	}
+
 	if found && err == nil {
 		// Item exists in cache
 		if logger != nil && !onlyLogErrors {
@@ -93,27 +123,11 @@ fresh:
 	}
 
 	if gobRegister {
-		func() {
-			defer func() {
-				if err := recover(); err != nil {
-					msg := fmt.Sprintf("gob register: %v", err)
-					if logger != nil {
-						logger.Log(logPatternRed, msg)
-					} else {
-						log.Printf(logPatternRed, msg)
-					}
-				}
-			}()
-			gob.Register(itemToStore)
-		}()
+		registerGob(itemToStore, logger)
 	}
 
 	// Store item in Cache
-	if cache.StorePointer() {
-		err = cache.Set(key, expiration, &itemToStore)
-	} else {
-		err = cache.Set(key, expiration, itemToStore)
-	}
+	err = cache.Set(key, expiration, storable(cache, itemToStore))
 	if err != nil {
 		// Storage failed
 		if logger != nil {
@@ -123,3 +137,26 @@ fresh:
 
 	return itemToStore, false, nil
 }
+
+// registerGob registers the type of item with the gob package.
+func registerGob(item interface{}, logger Logger) {
+	defer func() {
+		if err := recover(); err != nil {
+			msg := fmt.Sprintf("gob register: %v", err)
+			if logger != nil {
+				logger.Log(logPatternRed, msg)
+			} else {
+				log.Printf(logPatternRed, msg)
+			}
+		}
+	}()
+	gob.Register(item)
+}
+
+// storable returns item in the form required by the storage driver.
+func storable(cache Cacher, item interface{}) interface{} {
+	if cache.StorePointer() {
+		return &item
+	}
+	return item
+}
@@ -4,8 +4,10 @@ package remember_test
 
 import (
 	"context"
+	"errors"
 	"log"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,6 +59,50 @@ func TestKeyGen(t *testing.T) {
 	}
 }
 
+func TestCreateStableKey(t *testing.T) {
+
+	tests := []struct {
+		actual   string
+		expected string
+	}{
+		{remember.CreateStableKey("", "-", "search-page", "golang", 2), "github.com/rocketlaunchr/remember-go_test.TestCreateStableKey_golang-2"},
+		{remember.CreateStableKey("v2", "", "", 1, 2, 3), "github.com/rocketlaunchr/remember-go_test.TestCreateStableKey@v2_1 2 3"},
+	}
+
+	for _, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("wrong val: expected: %v actual: %v", tt.expected, tt.actual)
+		}
+	}
+}
+
+func TestValidateVisual(t *testing.T) {
+
+	tests := []struct {
+		sep    string
+		visual string
+		args   []interface{}
+		valid  bool
+	}{
+		{"-", "search-page", []interface{}{"golang", 2}, true},
+		{"-", "search-page", []interface{}{"golang"}, false},
+		{"|", "search|page|limit", []interface{}{"golang", 2}, false},
+		{"", "search page", []interface{}{"golang", 2}, true},
+		{"", "search", []interface{}{"golang", 2}, false},
+		{"-", "", []interface{}{"golang", 2}, true},
+	}
+
+	for i, tt := range tests {
+		err := remember.ValidateVisual(tt.sep, tt.visual, tt.args...)
+		if (err == nil) != tt.valid {
+			t.Errorf("%d: wrong val: expected valid: %v actual: %v", i, tt.valid, err)
+		}
+		if err != nil && !errors.Is(err, remember.ErrInvalidVisual) {
+			t.Errorf("%d: wrong err: expected: %v actual: %v", i, remember.ErrInvalidVisual, err)
+		}
+	}
+}
+
 func TestKeyBasicOperation(t *testing.T) {
 	ctx := context.Background()
 	var ms = memory.NewMemoryStore(10 * time.Minute)
@@ -114,3 +160,217 @@ func TestFetchFromCacheAndDisableCache(t *testing.T) {
 		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
 	}
 }
+
+func TestSafeSetUnsupportedDriver(t *testing.T) {
+	ctx := context.Background()
+	var ms = memory.NewMemoryStore(10 * time.Minute)
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	// SafeSet is ignored for drivers that don't implement CASCacher
+	remember.Cache(ctx, ms, key, exp, slowQuery, remember.Options{SafeSet: true})
+
+	actual, found, _ := remember.Cache(ctx, ms, key, exp, slowQuery, remember.Options{SafeSet: true})
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+// casStore is a minimal storage driver that implements remember.CASCacher.
+type casStore struct {
+	mu    sync.Mutex
+	items map[string]interface{}
+	cas   map[string]uint64
+	next  uint64
+}
+
+func newCASStore() *casStore {
+	return &casStore{items: map[string]interface{}{}, cas: map[string]uint64{}}
+}
+
+func (c *casStore) Conn(ctx context.Context) (remember.Cacher, error) { return c, nil }
+func (c *casStore) StorePointer() bool                                { return false }
+func (c *casStore) Close()                                            {}
+
+func (c *casStore) Get(key string) (interface{}, bool, error) {
+	item, _, found, err := c.GetCAS(key)
+	return item, found, err
+}
+
+func (c *casStore) GetCAS(key string) (interface{}, uint64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.items[key]
+	return item, c.cas[key], found, nil
+}
+
+func (c *casStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(key, itemToStore)
+	return nil
+}
+
+func (c *casStore) Add(key string, expiration time.Duration, itemToStore interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.items[key]; found {
+		return remember.ErrNotStored
+	}
+	c.store(key, itemToStore)
+	return nil
+}
+
+func (c *casStore) CompareAndSwap(key string, expiration time.Duration, itemToStore interface{}, cas uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, found := c.cas[key]; !found || current != cas {
+		return remember.ErrCASConflict
+	}
+	c.store(key, itemToStore)
+	return nil
+}
+
+func (c *casStore) store(key string, item interface{}) {
+	c.next++
+	c.items[key], c.cas[key] = item, c.next
+}
+
+func (c *casStore) Forget(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+	delete(c.cas, key)
+	return nil
+}
+
+func (c *casStore) ForgetAll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items, c.cas = map[string]interface{}{}, map[string]uint64{}
+	return nil
+}
+
+func TestSafeSetMixedCallers(t *testing.T) {
+	ctx := context.Background()
+	var cs = newCASStore()
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	// A SafeSet caller holds the lock while grabbing from SlowRetrieve
+	go func() {
+		defer close(done)
+		slowQuery := func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "safe", nil
+		}
+		remember.Cache(ctx, cs, key, exp, slowQuery, remember.Options{SafeSet: true})
+	}()
+
+	<-started
+
+	// A caller not using SafeSet must not receive the lock
+	actual, found, err := remember.Cache(ctx, cs, key, exp, func(ctx context.Context) (interface{}, error) {
+		return "plain", nil
+	})
+	if err != nil || found {
+		t.Errorf("wrong found: expected: %v actual: %v (err: %v)", false, found, err)
+	}
+	if actual != "plain" {
+		t.Errorf("wrong val: expected: %v actual: %v", "plain", actual)
+	}
+
+	close(release)
+	<-done
+
+	// The plain caller's value replaced the lock, so the SafeSet caller's value is discarded
+	actual, found, _ = remember.Cache(ctx, cs, key, exp, func(ctx context.Context) (interface{}, error) {
+		return "other", nil
+	})
+	if !found || actual != "plain" {
+		t.Errorf("wrong val: expected: %v actual: %v", "plain", actual)
+	}
+	if remember.IsLock(actual) {
+		t.Errorf("lock returned as cached data")
+	}
+}
+
+// expiringStore replaces the value of a key after it is fetched by GetCAS
+// (as if the lock expired and another caller stored a value).
+type expiringStore struct {
+	*casStore
+	replace interface{}
+}
+
+func (c *expiringStore) Conn(ctx context.Context) (remember.Cacher, error) { return c, nil }
+
+func (c *expiringStore) GetCAS(key string) (interface{}, uint64, bool, error) {
+	item, cas, found, err := c.casStore.GetCAS(key)
+	if c.replace != nil {
+		c.casStore.Set(key, 0, c.replace)
+		c.replace = nil
+	}
+	return item, cas, found, err
+}
+
+func TestSafeSetReleaseLock(t *testing.T) {
+	ctx := context.Background()
+	var cs = &expiringStore{casStore: newCASStore()}
+
+	key := "key"
+	exp := 10 * time.Minute
+	opts := remember.Options{SafeSet: true}
+
+	// The lock expires while it is being released
+	_, _, err := remember.Cache(ctx, cs, key, exp, func(ctx context.Context) (interface{}, error) {
+		cs.replace = "other"
+		return nil, errors.New("slow query failed")
+	}, opts)
+	if err == nil {
+		t.Errorf("expected error")
+	}
+
+	// The other caller's value is not removed
+	actual, found, _ := cs.Get(key)
+	if !found || actual != "other" {
+		t.Errorf("wrong val: expected: %v actual: %v", "other", actual)
+	}
+
+	// A released lock is acquired by the next caller
+	cs.Forget(key)
+	remember.Cache(ctx, cs, key, exp, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("slow query failed")
+	}, opts)
+
+	if actual, _, _ := cs.Get(key); !remember.IsLock(actual) {
+		t.Errorf("expected released lock: actual: %v", actual)
+	}
+
+	actual, found, err = remember.Cache(ctx, cs, key, exp, func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}, opts)
+	if err != nil || found || actual != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v (found: %v err: %v)", "val", actual, found, err)
+	}
+	if actual, _, _ := cs.Get(key); actual != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", actual)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembercli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memcached"
+	red "github.com/rocketlaunchr/remember-go/redis"
+)
+
+// config contains the flags used to connect to a backend.
+type config struct {
+	redis     string
+	db        int
+	password  string
+	memcached string
+	namespace string
+}
+
+// backend provides raw access to the values stored by a storage driver.
+type backend interface {
+	// Keys returns the keys matching a glob pattern in sorted order.
+	Keys(pattern string) ([]string, error)
+
+	// TTL returns the remaining time to live of key.
+	// A negative duration indicates that the key does not expire.
+	TTL(key string) (time.Duration, error)
+
+	// Get returns the encoded value of key.
+	Get(key string) ([]byte, error)
+
+	Forget(key string) error
+
+	// ForgetPrefix forgets all keys starting with prefix and returns how many were forgotten.
+	ForgetPrefix(prefix string) (int, error)
+
+	ForgetAll() error
+
+	Close()
+}
+
+func (cfg config) validate() error {
+	switch {
+	case cfg.redis != "" && cfg.memcached != "":
+		return errors.New("only one of -redis and -memcached can be set")
+	case cfg.redis == "" && cfg.memcached == "":
+		return errors.New("one of -redis or -memcached must be set")
+	}
+	return nil
+}
+
+func (cfg config) dial() (redis.Conn, error) {
+	return redis.Dial("tcp", cfg.redis, redis.DialDatabase(cfg.db), redis.DialPassword(cfg.password))
+}
+
+func (cfg config) memcachedStore() *memcached.MemcachedStore {
+	ms := memcached.NewMemcachedStore(strings.Split(cfg.memcached, ",")...)
+	if cfg.namespace != "" {
+		ms.Namespace = cfg.namespace
+	}
+	return ms
+}
+
+func (cfg config) backend() (backend, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.redis != "" {
+		pool := &redis.Pool{MaxIdle: 1, Dial: cfg.dial}
+
+		// Connect now so that connection errors are reported before running the command.
+		// The connection is returned to the pool for reuse.
+		conn := pool.Get()
+		err := conn.Err()
+		conn.Close()
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return &redisBackend{red.NewRedisStore(pool)}, nil
+	}
+	return &memcachedBackend{cfg.memcachedStore()}, nil
+}
+
+// conner returns the storage driver. close releases its resources.
+func (cfg config) conner() (_ remember.Conner, close func(), _ error) {
+	if err := cfg.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.redis != "" {
+		pool := &redis.Pool{MaxIdle: 1, Dial: cfg.dial}
+		return red.NewRedisStore(pool), func() { pool.Close() }, nil
+	}
+	return cfg.memcachedStore(), func() {}, nil
+}
+
+// redisBackend accesses the values stored by the redis storage driver.
+type redisBackend struct {
+	rs *red.RedisStore
+}
+
+func (b *redisBackend) Keys(pattern string) ([]string, error) {
+	conn := b.rs.Pool.Get()
+	defer conn.Close()
+
+	var (
+		keys   []string
+		cursor = "0"
+	)
+
+	// SCAN is used instead of KEYS so that the server is not blocked.
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []string
+		if _, err := redis.Scan(reply, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	// SCAN may return a key more than once
+	sort.Strings(keys)
+	out := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+func (b *redisBackend) TTL(key string) (time.Duration, error) {
+	ttl, found, err := b.rs.TTL(context.Background(), key)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, ErrNotFound
+	}
+	return ttl, nil
+}
+
+func (b *redisBackend) Get(key string) ([]byte, error) {
+	conn := b.rs.Pool.Get()
+	defer conn.Close()
+
+	val, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+func (b *redisBackend) Forget(key string) error {
+	cache, err := b.rs.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	return cache.Forget(key)
+}
+
+func (b *redisBackend) ForgetPrefix(prefix string) (int, error) {
+	return b.rs.ForgetPrefix(context.Background(), prefix)
+}
+
+func (b *redisBackend) ForgetAll() error {
+	cache, err := b.rs.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	return cache.ForgetAll()
+}
+
+func (b *redisBackend) Close() {
+	b.rs.Pool.Close()
+}
+
+// memcachedBackend accesses the values stored by the memcached storage driver.
+// Keys are resolved within the namespace.
+//
+// memcached can not list keys or report a key's time to live.
+type memcachedBackend struct {
+	ms *memcached.MemcachedStore
+}
+
+func (b *memcachedBackend) Keys(pattern string) ([]string, error) {
+	return nil, fmt.Errorf("keys: %w", ErrUnsupported)
+}
+
+func (b *memcachedBackend) TTL(key string) (time.Duration, error) {
+	return 0, fmt.Errorf("ttl: %w", ErrUnsupported)
+}
+
+func (b *memcachedBackend) Get(key string) ([]byte, error) {
+	k, err := b.ms.Key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := b.ms.Client.Get(k)
+	if err == memcache.ErrCacheMiss {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (b *memcachedBackend) Forget(key string) error {
+	return b.ms.Forget(key)
+}
+
+func (b *memcachedBackend) ForgetPrefix(prefix string) (int, error) {
+	return 0, fmt.Errorf("forget -prefix: %w", ErrUnsupported)
+}
+
+func (b *memcachedBackend) ForgetAll() error {
+	return b.ms.ForgetAll()
+}
+
+func (b *memcachedBackend) Close() {}
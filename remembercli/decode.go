@@ -0,0 +1,87 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembercli
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// writeValue decodes val according to format and writes it to w.
+//
+//	auto: gob, falling back to json and then hex
+//	gob:  gob (as stored by the storage drivers)
+//	json: indented json
+//	hex:  hex dump
+//	raw:  unaltered bytes
+func writeValue(w io.Writer, val []byte, format string) error {
+	switch format {
+	case "auto":
+		v, gobErr := decodeGob(val)
+		if gobErr == nil {
+			return writeGob(w, v)
+		}
+		if json.Valid(val) {
+			return writeJSON(w, val)
+		}
+		fmt.Fprintf(w, "# could not decode as gob: %v\n", gobErr)
+		return writeHex(w, val)
+	case "gob":
+		v, err := decodeGob(val)
+		if err != nil {
+			return err
+		}
+		return writeGob(w, v)
+	case "json":
+		return writeJSON(w, val)
+	case "hex":
+		return writeHex(w, val)
+	case "raw":
+		_, err := w.Write(val)
+		return err
+	}
+	return fmt.Errorf("unknown format: %q", format)
+}
+
+// decodeGob decodes a value encoded by the storage drivers.
+// Types that are not registered with the gob package can not be decoded.
+func decodeGob(val []byte) (interface{}, error) {
+	var out interface{}
+	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("gob: %w", err)
+	}
+	return out, nil
+}
+
+// writeGob writes the type of v followed by v as indented json.
+// If v can not be represented as json, Go syntax is used.
+func writeGob(w io.Writer, v interface{}) error {
+	fmt.Fprintf(w, "# type: %T\n", v)
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		_, err = fmt.Fprintf(w, "%#v\n", v)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func writeJSON(w io.Writer, val []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, val, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeHex(w io.Writer, val []byte) error {
+	_, err := io.WriteString(w, hex.Dump(val))
+	return err
+}
@@ -0,0 +1,148 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembercli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// hashers are the hashers that can be selected by the hash command.
+var hashers = map[string]remember.Hasher{
+	"crc32":    remember.CRC32,
+	"sha256":   remember.SHA256,
+	"fnv64":    remember.FNV64,
+	"xxhash64": remember.XXHash64,
+}
+
+// cmdKey computes the output of CreateKey (with prefix set to false) or, if -func is set,
+// CreateStableKey as if it were called from within the function.
+func cmdKey(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("key", stderr)
+	sep := fs.String("sep", "", "separator")
+	fn := fs.String("func", "", "package-qualified function name used by CreateStableKey (eg. main.search)")
+	version := fs.String("version", "", "version used by CreateStableKey")
+	strs := fs.Bool("strings", false, "treat all arguments as strings (instead of converting numbers and booleans)")
+	if err := parseArgs(fs, args, 1, -1); err != nil {
+		return err
+	}
+
+	if *version != "" && *fn == "" {
+		return errors.New("key: -version requires -func")
+	}
+
+	keyArgs := make([]interface{}, fs.NArg())
+	for i, arg := range fs.Args() {
+		if *strs {
+			keyArgs[i] = arg
+		} else {
+			keyArgs[i] = parseArg(arg)
+		}
+	}
+
+	// The args are identical to those passed to CreateStableKey, so only the
+	// caller's name needs to be replaced.
+	key := remember.CreateKey(false, *sep, "", keyArgs...)
+	if *fn != "" {
+		prefix := *fn
+		if *version != "" {
+			prefix = prefix + "@" + *version
+		}
+		key = prefix + "_" + key
+	}
+
+	fmt.Fprintln(stdout, key)
+	return nil
+}
+
+// parseArg converts arg into the type it most likely had when it was passed to CreateKey.
+// This matters because fmt.Sprint only separates operands with spaces when neither is a string.
+func parseArg(arg string) interface{} {
+	if i, err := strconv.Atoi(arg); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(arg, 64); err == nil {
+		return f
+	}
+	if arg == "true" || arg == "false" {
+		return arg == "true"
+	}
+	return arg
+}
+
+// cmdKeyStruct computes the output of CreateKeyStruct for a struct whose (tagged) field names
+// and values match the json object.
+func cmdKeyStruct(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("keystruct", stderr)
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(fs.Arg(0)))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("keystruct: argument must be a json object: %w", err)
+	}
+
+	// Struct fields are encoded in name order, just like map keys.
+	key, err := remember.EncodeKey(convertNumbers(obj))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, key)
+	return nil
+}
+
+// convertNumbers replaces json.Number values with int64 or float64 values so
+// that they are encoded as numbers instead of strings.
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
+
+// cmdHash computes the output of Hash (or HashKey if -max is set).
+func cmdHash(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("hash", stderr)
+	name := fs.String("hasher", "crc32", "crc32, sha256, fnv64 or xxhash64")
+	max := fs.Int("max", -1, "only hash keys longer than max bytes (see HashKey)")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	h, found := hashers[strings.ToLower(*name)]
+	if !found {
+		return fmt.Errorf("hash: unknown hasher: %q", *name)
+	}
+
+	key := fs.Arg(0)
+	if *max >= 0 {
+		key = remember.HashKey(h, key, *max)
+	} else {
+		key = h.Hash(key)
+	}
+	fmt.Fprintln(stdout, key)
+	return nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package remembercli implements the remember command line tool.
+// It inspects the values cached in a redis or memcached server and computes keys.
+//
+// Values are gob encoded by the storage drivers. In order to decode values of your
+// own types, they must be registered with the gob package. Create your own main
+// package that registers them and calls Main:
+//
+//	func main() {
+//		gob.Register(Result{})
+//		os.Exit(remembercli.Main(os.Args[1:]))
+//	}
+package remembercli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnsupported is returned when a command is not supported by the backend.
+var ErrUnsupported = errors.New("not supported by backend")
+
+// ErrNotFound is returned when a key does not exist.
+var ErrNotFound = errors.New("key not found")
+
+const usage = `Usage: remember [flags] <command> [args]
+
+Commands:
+  keys [-ttl] <pattern>            list keys matching a glob pattern (redis only)
+  ttl <key>                        show the remaining time to live of a key (redis only)
+  get [-format f] <key>            decode and print a value (format: auto, gob, json, hex or raw)
+  forget <key>...                  forget keys
+  forget -prefix <prefix>          forget all keys starting with prefix (redis only)
+  forget -all -yes                 forget all keys (redis: FLUSHDB, memcached: the namespace)
+  export [-format f] [-prefix p] <file>
+                                   export entries to a snapshot file (format: jsonl or binary)
+  import [-rate n] [-prefix p] <file>
+                                   import entries from a snapshot file (at most n per second)
+  key [-sep s] [-func f] [-version v] [-strings] <arg>...
+                                   compute CreateKey (or CreateStableKey if -func is set)
+  keystruct <json object>          compute CreateKeyStruct
+  hash [-hasher h] [-max n] <key>  compute Hash (hasher: crc32, sha256, fnv64 or xxhash64)
+
+Flags:
+`
+
+// Main runs the command line tool with args (excluding the program name) and
+// returns the exit status.
+func Main(args []string) int {
+	err := Run(args, os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+		return 0
+	case err == flag.ErrHelp:
+		return 2
+	}
+	fmt.Fprintln(os.Stderr, "remember:", err)
+	return 1
+}
+
+// Run runs the command line tool with args (excluding the program name).
+// Output is written to stdout. Usage information is written to stderr.
+func Run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("remember", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	var cfg config
+	fs.StringVar(&cfg.redis, "redis", "", "redis server address (eg. localhost:6379)")
+	fs.IntVar(&cfg.db, "db", 0, "redis database")
+	fs.StringVar(&cfg.password, "password", "", "redis password")
+	fs.StringVar(&cfg.memcached, "memcached", "", "comma separated memcached server addresses (eg. localhost:11211)")
+	fs.StringVar(&cfg.namespace, "namespace", "", "memcached namespace (default \"remember\")")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+
+	// Commands that don't require a raw backend
+	switch cmd {
+	case "key":
+		return cmdKey(args, stdout, stderr)
+	case "keystruct":
+		return cmdKeyStruct(args, stdout, stderr)
+	case "hash":
+		return cmdHash(args, stdout, stderr)
+	case "export":
+		return cmdExport(cfg, args, stdout, stderr)
+	case "import":
+		return cmdImport(cfg, args, stdout, stderr)
+	case "keys", "ttl", "get", "forget":
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command: %q", cmd)
+	}
+
+	b, err := cfg.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	switch cmd {
+	case "keys":
+		return cmdKeys(b, args, stdout, stderr)
+	case "ttl":
+		return cmdTTL(b, args, stdout, stderr)
+	case "get":
+		return cmdGet(b, args, stdout, stderr)
+	default:
+		return cmdForget(b, args, stdout, stderr)
+	}
+}
+
+// newFlagSet creates the flag set for a command.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("remember "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseArgs parses the command's flags and checks the number of positional arguments.
+// If max is negative, there is no maximum.
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return fmt.Errorf("%s: wrong number of arguments", fs.Name())
+	}
+	return nil
+}
+
+func cmdKeys(b backend, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("keys", stderr)
+	showTTL := fs.Bool("ttl", false, "show the remaining time to live of each key")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	keys, err := b.Keys(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !*showTTL {
+			fmt.Fprintln(stdout, key)
+			continue
+		}
+
+		ttl, err := b.TTL(key)
+		if err == ErrNotFound {
+			continue // Expired since it was listed
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", key, formatTTL(ttl))
+	}
+	return nil
+}
+
+func cmdTTL(b backend, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("ttl", stderr)
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	ttl, err := b.TTL(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, formatTTL(ttl))
+	return nil
+}
+
+func cmdGet(b backend, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("get", stderr)
+	format := fs.String("format", "auto", "auto, gob, json, hex or raw")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	val, err := b.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeValue(stdout, val, *format)
+}
+
+func cmdForget(b backend, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("forget", stderr)
+	prefix := fs.Bool("prefix", false, "forget all keys starting with the argument")
+	all := fs.Bool("all", false, "forget all keys")
+	yes := fs.Bool("yes", false, "confirm -all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *all:
+		if fs.NArg() != 0 {
+			return errors.New("forget: -all does not accept arguments")
+		}
+		if !*yes {
+			return errors.New("forget: -all forgets every key (redis: FLUSHDB on the database, memcached: the namespace); add -yes to confirm")
+		}
+		return b.ForgetAll()
+	case *prefix:
+		if fs.NArg() != 1 || fs.Arg(0) == "" {
+			return errors.New("forget: -prefix requires a non-empty prefix")
+		}
+		n, err := b.ForgetPrefix(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d keys forgotten\n", n)
+		return nil
+	case fs.NArg() == 0:
+		fs.Usage()
+		return errors.New("forget: no keys provided")
+	}
+
+	for _, key := range fs.Args() {
+		if err := b.Forget(key); err != nil {
+			return fmt.Errorf("forget %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// formatTTL returns a human readable version of ttl.
+// A negative ttl indicates that the key does not expire.
+func formatTTL(ttl time.Duration) string {
+	if ttl < 0 {
+		return "no expiration"
+	}
+	return ttl.String()
+}
@@ -0,0 +1,268 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembercli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/remembercli"
+)
+
+var ctx = context.Background()
+
+type Result struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(Result{})
+}
+
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := remembercli.Run(args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := run(t, args...)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return out
+}
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *red.RedisStore) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	set := func(key string, exp time.Duration, val interface{}) {
+		remember.Cache(ctx, rs, key, exp, func(ctx context.Context) (interface{}, error) {
+			return val, nil
+		})
+	}
+	set("user:1", time.Hour, Result{"a", 1})
+	set("user:2", red.NoExpiration, Result{"b", 2})
+	set("user:*", time.Hour, "star")
+	set("other", time.Hour, 42)
+
+	return s, rs
+}
+
+func TestKeys(t *testing.T) {
+	s, _ := newRedis(t)
+	defer s.Close()
+
+	out := mustRun(t, "-redis", s.Addr(), "keys", "user:*")
+	expected := "user:*\nuser:1\nuser:2\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+
+	out = mustRun(t, "-redis", s.Addr(), "keys", "-ttl", "user:?")
+	expected = "user:*\t1h0m0s\nuser:1\t1h0m0s\nuser:2\tno expiration\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	s, _ := newRedis(t)
+	defer s.Close()
+
+	s.FastForward(time.Minute)
+
+	out := mustRun(t, "-redis", s.Addr(), "ttl", "user:1")
+	if out != "59m0s\n" {
+		t.Errorf("wrong val: expected: %q actual: %q", "59m0s\n", out)
+	}
+
+	if _, err := run(t, "-redis", s.Addr(), "ttl", "missing"); err != remembercli.ErrNotFound {
+		t.Errorf("wrong err: expected: %v actual: %v", remembercli.ErrNotFound, err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	s, _ := newRedis(t)
+	defer s.Close()
+
+	out := mustRun(t, "-redis", s.Addr(), "get", "user:1")
+	expected := "# type: remembercli_test.Result\n{\n  \"Name\": \"a\",\n  \"Count\": 1\n}\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+
+	out = mustRun(t, "-redis", s.Addr(), "get", "other")
+	expected = "# type: int\n42\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+
+	// Values that are not gob encoded
+	s.Set("json", `{"a":1}`)
+	out = mustRun(t, "-redis", s.Addr(), "get", "json")
+	expected = "{\n  \"a\": 1\n}\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+
+	s.Set("bytes", "\x00\x01")
+	out = mustRun(t, "-redis", s.Addr(), "get", "bytes")
+	if !strings.HasPrefix(out, "# could not decode as gob") || !strings.Contains(out, "00 01") {
+		t.Errorf("wrong val: %q", out)
+	}
+
+	out = mustRun(t, "-redis", s.Addr(), "get", "-format", "hex", "json")
+	if !strings.Contains(out, "7b 22 61 22") {
+		t.Errorf("wrong val: %q", out)
+	}
+
+	if _, err := run(t, "-redis", s.Addr(), "get", "-format", "gob", "json"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestForget(t *testing.T) {
+	s, _ := newRedis(t)
+	defer s.Close()
+
+	mustRun(t, "-redis", s.Addr(), "forget", "other")
+	if s.Exists("other") {
+		t.Errorf("expected key to be forgotten")
+	}
+
+	// Special characters in the prefix are not treated as a pattern
+	out := mustRun(t, "-redis", s.Addr(), "forget", "-prefix", "user:*")
+	if out != "1 keys forgotten\n" {
+		t.Errorf("wrong val: expected: %q actual: %q", "1 keys forgotten\n", out)
+	}
+	if s.Exists("user:*") || !s.Exists("user:1") {
+		t.Errorf("wrong keys forgotten: %v", s.Keys())
+	}
+
+	mustRun(t, "-redis", s.Addr(), "forget", "-prefix", "user:")
+	if len(s.Keys()) != 0 {
+		t.Errorf("wrong keys forgotten: %v", s.Keys())
+	}
+
+	// -all requires confirmation
+	s.Set("key", "val")
+	if _, err := run(t, "-redis", s.Addr(), "forget", "-all"); err == nil {
+		t.Errorf("expected error")
+	}
+	if !s.Exists("key") {
+		t.Errorf("expected key to not be forgotten")
+	}
+
+	mustRun(t, "-redis", s.Addr(), "forget", "-all", "-yes")
+	if len(s.Keys()) != 0 {
+		t.Errorf("wrong keys forgotten: %v", s.Keys())
+	}
+}
+
+func TestMemcachedUnsupported(t *testing.T) {
+	for _, args := range [][]string{
+		{"keys", "*"},
+		{"ttl", "key"},
+		{"forget", "-prefix", "key"},
+	} {
+		_, err := run(t, append([]string{"-memcached", "localhost:0"}, args...)...)
+		if !errors.Is(err, remembercli.ErrUnsupported) {
+			t.Errorf("wrong err for %v: expected: %v actual: %v", args, remembercli.ErrUnsupported, err)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"key", "1", "2", "3"}, remember.CreateKey(false, "", "", 1, 2, 3)},
+		{[]string{"key", "-strings", "1", "2", "3"}, remember.CreateKey(false, "", "", "1", "2", "3")},
+		{[]string{"key", "-sep", "-", "golang", "2", "true"}, remember.CreateKey(false, "-", "", "golang", 2, true)},
+		{[]string{"key", "-sep", "-", "-func", "main.search", "-version", "v2", "golang", "2"}, "main.search@v2_golang-2"},
+		{[]string{"key", "-func", "main.search", "a"}, "main.search_a"},
+		{[]string{"keystruct", `{"Name":"a","Count":1,"Tags":["x"],"Score":1.5}`}, remember.CreateKeyStruct(struct {
+			Name  string
+			Count int
+			Tags  []string
+			Score float64
+		}{"a", 1, []string{"x"}, 1.5})},
+		{[]string{"hash", "key"}, remember.Hash("key")},
+		{[]string{"hash", "-hasher", "sha256", "key"}, remember.SHA256.Hash("key")},
+		{[]string{"hash", "-hasher", "xxhash64", "-max", "2", "key"}, remember.HashKey(remember.XXHash64, "key", 2)},
+		{[]string{"hash", "-hasher", "fnv64", "-max", "3", "key"}, "key"},
+	}
+
+	for _, tt := range tests {
+		out := mustRun(t, tt.args...)
+		if out != tt.expected+"\n" {
+			t.Errorf("wrong val for %v: expected: %v actual: %v", tt.args, tt.expected, out)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	s, _ := newRedis(t)
+	defer s.Close()
+
+	file := filepath.Join(t.TempDir(), "snapshot")
+
+	out := mustRun(t, "-redis", s.Addr(), "export", "-format", "binary", "-prefix", "user:", file)
+	if out != "3 entries exported\n" {
+		t.Errorf("wrong val: expected: %q actual: %q", "3 entries exported\n", out)
+	}
+
+	dst, rs := newRedis(t)
+	defer dst.Close()
+	dst.FlushAll()
+
+	out = mustRun(t, "-redis", dst.Addr(), "import", "-prefix", "user:1", file)
+	expected := "1 entries imported, 0 expired, 2 skipped\n"
+	if out != expected {
+		t.Errorf("wrong val: expected: %q actual: %q", expected, out)
+	}
+
+	conn, _ := rs.Conn(ctx)
+	defer conn.Close()
+
+	val, found, err := conn.Get("user:1")
+	if err != nil || !found {
+		t.Fatalf("wrong val: expected: found actual: %v %v", found, err)
+	}
+	if val != (Result{"a", 1}) {
+		t.Errorf("wrong val: expected: %v actual: %v", Result{"a", 1}, val)
+	}
+	if ttl := dst.TTL("user:1"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("wrong ttl: %v", ttl)
+	}
+
+	if _, err := run(t, "-redis", s.Addr(), "export", "-format", "xml", file); err == nil {
+		t.Errorf("wrong err: expected: error actual: nil")
+	}
+}
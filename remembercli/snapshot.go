@@ -0,0 +1,98 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembercli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rocketlaunchr/remember-go/snapshot"
+)
+
+// cmdExport exports entries to a snapshot file ("-" for stdout).
+func cmdExport(cfg config, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", stderr)
+	format := fs.String("format", "jsonl", "jsonl or binary")
+	prefix := fs.String("prefix", "", "only export keys starting with prefix")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	ec := snapshot.ExportConfig{Match: matchPrefix(*prefix)}
+	switch *format {
+	case "jsonl":
+		ec.Format = snapshot.JSONLines
+	case "binary":
+		ec.Format = snapshot.Binary
+	default:
+		return fmt.Errorf("export: unknown format: %q", *format)
+	}
+
+	c, close, err := cfg.conner()
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	w := stdout
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := snapshot.Export(context.Background(), c, w, ec)
+	if err != nil {
+		return err
+	}
+	if w != stdout {
+		fmt.Fprintf(stdout, "%d entries exported\n", n)
+	}
+	return nil
+}
+
+// cmdImport imports entries from a snapshot file ("-" for stdin).
+// Values are stored without being decoded.
+func cmdImport(cfg config, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("import", stderr)
+	rate := fs.Float64("rate", 0, "maximum number of entries imported per second (0 for unlimited)")
+	prefix := fs.String("prefix", "", "only import keys starting with prefix")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	c, close, err := cfg.conner()
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	r := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	res, err := snapshot.Import(context.Background(), c, r, snapshot.ImportConfig{Rate: *rate, Match: matchPrefix(*prefix)})
+	fmt.Fprintf(stdout, "%d entries imported, %d expired, %d skipped\n", res.Imported, res.Expired, res.Skipped)
+	return err
+}
+
+func matchPrefix(prefix string) func(key string) bool {
+	if prefix == "" {
+		return nil
+	}
+	return func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembertest
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// AssertSet checks that key was set with expiration.
+func (m *Mock) AssertSet(t testing.TB, key string, expiration time.Duration) bool {
+	t.Helper()
+
+	var sets []Call
+	for _, c := range m.CallsFor(key) {
+		if c.Op == Set && c.Err == nil {
+			if c.Expiration == expiration {
+				return true
+			}
+			sets = append(sets, c)
+		}
+	}
+
+	if len(sets) == 0 {
+		t.Errorf("expected key %q to be set", key)
+	} else {
+		t.Errorf("wrong expiration for key %q: expected: %v actual: %v", key, expiration, sets[len(sets)-1].Expiration)
+	}
+	return false
+}
+
+// AssertNotSet checks that key was never set.
+func (m *Mock) AssertNotSet(t testing.TB, key string) bool {
+	t.Helper()
+
+	for _, c := range m.CallsFor(key) {
+		if c.Op == Set && c.Err == nil {
+			t.Errorf("expected key %q not to be set", key)
+			return false
+		}
+	}
+	return true
+}
+
+// AssertValue checks that the value currently stored for key is equal to expected.
+func (m *Mock) AssertValue(t testing.TB, key string, expected interface{}) bool {
+	t.Helper()
+
+	actual, found := m.Value(key)
+	if !found {
+		t.Errorf("expected key %q to be stored", key)
+		return false
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wrong val for key %q: expected: %v actual: %v", key, expected, actual)
+		return false
+	}
+	return true
+}
+
+// AssertForgotten checks that key was forgotten.
+func (m *Mock) AssertForgotten(t testing.TB, key string) bool {
+	t.Helper()
+
+	for _, c := range m.CallsFor(key) {
+		if c.Op == Forget && c.Err == nil {
+			return true
+		}
+	}
+	t.Errorf("expected key %q to be forgotten", key)
+	return false
+}
+
+// AssertCalls checks that op was performed on key n times. If key is empty, all keys are counted.
+func (m *Mock) AssertCalls(t testing.TB, op Op, key string, n int) bool {
+	t.Helper()
+
+	var actual int
+	for _, c := range m.Calls(op) {
+		if key == "" || c.Key == key {
+			actual++
+		}
+	}
+	if actual != n {
+		t.Errorf("wrong number of %s calls for key %q: expected: %v actual: %v", op, key, n, actual)
+		return false
+	}
+	return true
+}
+
+// Spy wraps a SlowRetrieve function and counts how many times it is called.
+type Spy struct {
+	fn    remember.SlowRetrieve
+	calls int64
+}
+
+// NewSpy creates a Spy for fn.
+func NewSpy(fn remember.SlowRetrieve) *Spy {
+	return &Spy{fn: fn}
+}
+
+// SlowRetrieve calls the wrapped function. It should be passed to remember.Cache.
+func (s *Spy) SlowRetrieve(ctx context.Context) (interface{}, error) {
+	atomic.AddInt64(&s.calls, 1)
+	return s.fn(ctx)
+}
+
+// Calls returns how many times the wrapped function was called.
+func (s *Spy) Calls() int {
+	return int(atomic.LoadInt64(&s.calls))
+}
+
+// AssertCalled checks that the wrapped function was called n times.
+func (s *Spy) AssertCalled(t testing.TB, n int) bool {
+	t.Helper()
+
+	if actual := s.Calls(); actual != n {
+		t.Errorf("wrong number of SlowRetrieve calls: expected: %v actual: %v", n, actual)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembertest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a remember.Clock that only changes when it is advanced.
+// It allows expirations to be tested without calling time.Sleep.
+//
+// Example:
+//
+//	clock := remembertest.NewFakeClock(time.Now())
+//	ms := memory.NewBoundedMemoryStore(memory.BoundedConfig{Clock: clock})
+//
+//	ms.Set("key", time.Minute, "val")
+//	clock.Advance(time.Minute)
+//	_, found, _ := ms.Get("key") // found is false
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the current time once the clock
+// has been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.set(c.now.Add(d))
+	c.mu.Unlock()
+}
+
+// Set changes the clock to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.set(now)
+	c.mu.Unlock()
+}
+
+// Waiters returns the number of channels returned by After that have not yet received.
+// It can be used to wait until a goroutine is blocked on the clock.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// set changes the clock and notifies the waiters that are due. c.mu must be held.
+func (c *FakeClock) set(now time.Time) {
+	c.now = now
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if now.Before(w.at) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = pending
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembertest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := remembertest.NewFakeClock(start)
+
+	if !clock.Now().Equal(start) {
+		t.Errorf("wrong val: expected: %v actual: %v", start, clock.Now())
+	}
+
+	ch1 := clock.After(time.Second)
+	ch2 := clock.After(time.Minute)
+	if clock.Waiters() != 2 {
+		t.Errorf("wrong number of waiters: expected: %v actual: %v", 2, clock.Waiters())
+	}
+
+	clock.Advance(30 * time.Second)
+
+	select {
+	case now := <-ch1:
+		if expected := start.Add(30 * time.Second); !now.Equal(expected) {
+			t.Errorf("wrong val: expected: %v actual: %v", expected, now)
+		}
+	default:
+		t.Errorf("expected first channel to receive")
+	}
+
+	select {
+	case <-ch2:
+		t.Errorf("expected second channel not to receive")
+	default:
+	}
+
+	clock.Set(start.Add(time.Hour))
+	select {
+	case <-ch2:
+	default:
+		t.Errorf("expected second channel to receive")
+	}
+
+	if clock.Waiters() != 0 {
+		t.Errorf("wrong number of waiters: expected: %v actual: %v", 0, clock.Waiters())
+	}
+
+	// Non-positive durations receive immediately
+	select {
+	case <-clock.After(0):
+	default:
+		t.Errorf("expected channel to receive")
+	}
+}
+
+func TestMockClock(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	m := remembertest.NewMock()
+	m.Clock = clock
+
+	cache, _ := m.Conn(ctx)
+	cache.Set("key", time.Minute, "val")
+
+	clock.Advance(59 * time.Second)
+	if _, found, _ := cache.Get("key"); !found {
+		t.Errorf("expected key to be found")
+	}
+
+	clock.Advance(time.Second)
+	if _, found, _ := cache.Get("key"); found {
+		t.Errorf("expected key to expire")
+	}
+}
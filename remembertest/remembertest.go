@@ -0,0 +1,321 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package remembertest provides utilities for testing code that uses the remember package.
+//
+// Example:
+//
+//	m := remembertest.NewMock()
+//	spy := remembertest.NewSpy(slowQuery)
+//
+//	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+//	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+//
+//	m.AssertSet(t, "key", time.Minute)
+//	spy.AssertCalled(t, 1)
+package remembertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// NoExpiration is used to indicate that data should not expire from the cache.
+const NoExpiration time.Duration = -1
+
+// Op identifies a cache operation.
+type Op string
+
+const (
+	// AnyOp matches every operation when injecting failures and latencies.
+	AnyOp Op = ""
+
+	// Conn is recorded when a connection is obtained.
+	Conn Op = "conn"
+
+	// Get is recorded when a value is fetched.
+	Get Op = "get"
+
+	// Set is recorded when a value is stored.
+	Set Op = "set"
+
+	// Forget is recorded when a key is cleared.
+	Forget Op = "forget"
+
+	// ForgetAll is recorded when all keys are cleared.
+	ForgetAll Op = "forgetall"
+)
+
+// Call records a single operation performed on a Mock.
+type Call struct {
+	Op  Op
+	Key string
+
+	// Expiration is the expiration that was requested (Set only).
+	Expiration time.Duration
+
+	// Value is the value that was stored (Set) or returned (Get).
+	Value interface{}
+
+	// Found reports whether the key existed (Get only).
+	Found bool
+
+	// Err is the error that was returned.
+	Err error
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type rule struct {
+	op  Op
+	key string
+	err error
+	d   time.Duration
+}
+
+func (r rule) matches(op Op, key string) bool {
+	return (r.op == AnyOp || r.op == op) && (r.key == "" || r.key == key)
+}
+
+// Mock is an in-memory storage driver that records every operation.
+// Failures and latencies can be injected for particular operations and keys.
+//
+// The zero value is ready to use.
+type Mock struct {
+	// NoStorage prevents values from being stored. Operations are still recorded.
+	NoStorage bool
+
+	// Clock is used to determine when values expire and to wait for injected latencies.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+
+	mu       sync.Mutex
+	items    map[string]entry
+	calls    []Call
+	failures []rule
+	delays   []rule
+}
+
+// NewMock creates a Mock.
+func NewMock() *Mock {
+	return &Mock{items: map[string]entry{}}
+}
+
+// Fail causes op on key to return err. If op is AnyOp, all operations are affected.
+// If key is empty, all keys are affected. A nil err removes previously injected failures
+// for op and key.
+func (m *Mock) Fail(op Op, key string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := m.failures[:0]
+	for _, r := range m.failures {
+		if r.op != op || r.key != key {
+			rules = append(rules, r)
+		}
+	}
+	if err != nil {
+		rules = append(rules, rule{op: op, key: key, err: err})
+	}
+	m.failures = rules
+}
+
+// Delay causes op on key to wait for d (according to Clock) before completing. If op is AnyOp, all operations
+// are affected. If key is empty, all keys are affected.
+func (m *Mock) Delay(op Op, key string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delays = append(m.delays, rule{op: op, key: key, d: d})
+}
+
+// Calls returns the operations performed on the Mock in order. If ops are provided,
+// only those operations are returned.
+func (m *Mock) Calls(ops ...Op) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := []Call{}
+	for _, c := range m.calls {
+		if len(ops) == 0 || containsOp(ops, c.Op) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// CallsFor returns the operations performed on key in order.
+func (m *Mock) CallsFor(key string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := []Call{}
+	for _, c := range m.calls {
+		if c.Key == key {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Value returns the value currently stored for key.
+func (m *Mock) Value(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, found := m.items[key]
+	if !found || e.expired(remember.ClockOrDefault(m.Clock).Now()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Reset clears the recorded operations, stored values, injected failures and latencies.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = map[string]entry{}
+	m.calls = nil
+	m.failures = nil
+	m.delays = nil
+}
+
+// Conn returns the Mock.
+func (m *Mock) Conn(ctx context.Context) (remember.Cacher, error) {
+	if err := m.begin(Conn, ""); err != nil {
+		m.record(Call{Op: Conn, Err: err})
+		return nil, err
+	}
+	m.record(Call{Op: Conn})
+	return m, nil
+}
+
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (m *Mock) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// StorePointer sets whether a storage driver requires itemToStore to be
+// stored as a pointer or as a concrete value.
+func (m *Mock) StorePointer() bool {
+	return false
+}
+
+// Get returns a value from the cache if the key exists.
+func (m *Mock) Get(key string) (_ interface{}, found bool, _ error) {
+	if err := m.begin(Get, key); err != nil {
+		m.record(Call{Op: Get, Key: key, Err: err})
+		return nil, false, err
+	}
+
+	item, found := m.Value(key)
+	m.record(Call{Op: Get, Key: key, Value: item, Found: found})
+	return item, found, nil
+}
+
+// Set sets a item into the cache for a particular key.
+func (m *Mock) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	if err := m.begin(Set, key); err != nil {
+		m.record(Call{Op: Set, Key: key, Expiration: expiration, Value: itemToStore, Err: err})
+		return err
+	}
+
+	m.mu.Lock()
+	if !m.NoStorage {
+		e := entry{value: itemToStore}
+		if expiration > 0 {
+			e.expires = remember.ClockOrDefault(m.Clock).Now().Add(expiration)
+		}
+		if m.items == nil {
+			m.items = map[string]entry{}
+		}
+		m.items[key] = e
+	}
+	m.mu.Unlock()
+
+	m.record(Call{Op: Set, Key: key, Expiration: expiration, Value: itemToStore})
+	return nil
+}
+
+// Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing.
+func (m *Mock) Close() {}
+
+// Forget clears the value from the cache for the particular key.
+func (m *Mock) Forget(key string) error {
+	if err := m.begin(Forget, key); err != nil {
+		m.record(Call{Op: Forget, Key: key, Err: err})
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.items, key)
+	m.mu.Unlock()
+
+	m.record(Call{Op: Forget, Key: key})
+	return nil
+}
+
+// ForgetAll clears all values from the cache.
+func (m *Mock) ForgetAll() error {
+	if err := m.begin(ForgetAll, ""); err != nil {
+		m.record(Call{Op: ForgetAll, Err: err})
+		return err
+	}
+
+	m.mu.Lock()
+	m.items = map[string]entry{}
+	m.mu.Unlock()
+
+	m.record(Call{Op: ForgetAll})
+	return nil
+}
+
+// begin applies the injected latencies and returns the injected failure for op and key.
+func (m *Mock) begin(op Op, key string) error {
+	m.mu.Lock()
+	var (
+		d   time.Duration
+		err error
+	)
+	for _, r := range m.delays {
+		if r.matches(op, key) {
+			d += r.d
+		}
+	}
+	for _, r := range m.failures {
+		if r.matches(op, key) {
+			err = r.err
+		}
+	}
+	m.mu.Unlock()
+
+	if d > 0 {
+		<-remember.ClockOrDefault(m.Clock).After(d)
+	}
+	return err
+}
+
+func (m *Mock) record(c Call) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, c)
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+func containsOp(ops []Op, op Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
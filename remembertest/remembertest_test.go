@@ -0,0 +1,199 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remembertest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+)
+
+var ctx = context.Background()
+
+func TestConformance(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		m := remembertest.NewMock()
+		m.Clock = clock
+		return m, nil
+	}, cachertest.Config{
+		NoExpiration: remembertest.NoExpiration,
+		Advance: func(c remember.Conner, d time.Duration) {
+			clock.Advance(d)
+		},
+	})
+}
+
+func TestMockRecordsCalls(t *testing.T) {
+	m := remembertest.NewMock()
+	spy := remembertest.NewSpy(func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	})
+
+	for i := 0; i < 3; i++ {
+		remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+	}
+
+	spy.AssertCalled(t, 1)
+	m.AssertSet(t, "key", time.Minute)
+	m.AssertValue(t, "key", "val")
+	m.AssertCalls(t, remembertest.Get, "key", 3)
+	m.AssertCalls(t, remembertest.Set, "", 1)
+	m.AssertNotSet(t, "other")
+
+	calls := m.Calls(remembertest.Get)
+	if calls[0].Found || !calls[1].Found || calls[1].Value != "val" {
+		t.Errorf("wrong val: %+v", calls)
+	}
+
+	cache, _ := m.Conn(ctx)
+	cache.Forget("key")
+	m.AssertForgotten(t, "key")
+
+	expected := []remembertest.Op{remembertest.Get, remembertest.Set, remembertest.Get, remembertest.Get, remembertest.Forget}
+	var actual []remembertest.Op
+	for _, c := range m.CallsFor("key") {
+		actual = append(actual, c.Op)
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestMockFailures(t *testing.T) {
+	m := remembertest.NewMock()
+	spy := remembertest.NewSpy(func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	})
+
+	errDown := errors.New("cache down")
+
+	// Failure for a particular key and operation
+	m.Fail(remembertest.Set, "key", errDown)
+
+	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+	spy.AssertCalled(t, 2)
+	m.AssertNotSet(t, "key")
+
+	sets := m.Calls(remembertest.Set)
+	if len(sets) != 2 || sets[0].Err != errDown {
+		t.Errorf("wrong val: %+v", sets)
+	}
+
+	// Other keys are not affected
+	remember.Cache(ctx, m, "other", time.Minute, spy.SlowRetrieve)
+	m.AssertSet(t, "other", time.Minute)
+
+	// Failure removed
+	m.Fail(remembertest.Set, "key", nil)
+	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+	m.AssertSet(t, "key", time.Minute)
+
+	// Connection failure
+	m.Fail(remembertest.Conn, "", errDown)
+	if _, _, err := remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve); err != errDown {
+		t.Errorf("wrong err: expected: %v actual: %v", errDown, err)
+	}
+}
+
+func TestMockDelay(t *testing.T) {
+	m := remembertest.NewMock()
+	m.Delay(remembertest.Get, "slow", 50*time.Millisecond)
+
+	cache, _ := m.Conn(ctx)
+
+	start := time.Now()
+	cache.Get("fast")
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("expected no delay: %v", elapsed)
+	}
+
+	start = time.Now()
+	cache.Get("slow")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected delay: %v", elapsed)
+	}
+}
+
+func TestMockZeroValue(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+	m := &remembertest.Mock{Clock: clock}
+
+	cache, _ := m.Conn(ctx)
+	if err := cache.Set("key", time.Minute, "val"); err != nil {
+		t.Fatal(err)
+	}
+	if val, found := m.Value("key"); !found || val != "val" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val", val)
+	}
+
+	// Injected latencies use Clock
+	m.Delay(remembertest.Get, "key", time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		cache.Get("key")
+		close(done)
+	}()
+
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("expected Get to wait for the clock")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	<-done
+}
+
+// recorder captures failed assertions.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertionsFail(t *testing.T) {
+	m := remembertest.NewMock()
+	spy := remembertest.NewSpy(func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	})
+	remember.Cache(ctx, m, "key", time.Minute, spy.SlowRetrieve)
+
+	r := &recorder{TB: t}
+
+	results := []bool{
+		m.AssertSet(r, "key", time.Hour),
+		m.AssertSet(r, "missing", time.Minute),
+		m.AssertNotSet(r, "key"),
+		m.AssertValue(r, "key", "other"),
+		m.AssertForgotten(r, "key"),
+		m.AssertCalls(r, remembertest.Get, "key", 2),
+		spy.AssertCalled(r, 2),
+	}
+
+	for i, ok := range results {
+		if ok {
+			t.Errorf("%d: expected assertion to fail", i)
+		}
+	}
+	if len(r.failures) != len(results) {
+		t.Errorf("wrong number of failures: expected: %v actual: %v", len(results), len(r.failures))
+	}
+}
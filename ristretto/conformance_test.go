@@ -0,0 +1,31 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package ristretto_test
+
+import (
+	"testing"
+	"time"
+
+	rist "github.com/dgraph-io/ristretto"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/ristretto"
+)
+
+func TestConformance(t *testing.T) {
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		rs := ristretto.NewRistrettoStore(&rist.Config{
+			NumCounters: 1e4,
+			MaxCost:     1 << 20,
+			BufferItems: 64,
+		})
+		return rs, rs.Cache.Close
+	}, cachertest.Config{
+		NoExpiration: ristretto.NoExpiration,
+		Expiration:   50 * time.Millisecond,
+		Wait: func(c remember.Conner) {
+			c.(*ristretto.RistrettoStore).Cache.Wait()
+		},
+		Lossy: true,
+	})
+}
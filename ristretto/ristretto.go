@@ -5,10 +5,13 @@ package ristretto
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
+	"github.com/dgraph-io/ristretto/z"
 	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/snapshot"
 )
 
 // NoExpiration is used to indicate that data should not expire from the cache.
@@ -19,19 +22,90 @@ const NoExpiration time.Duration = 0
 // See: https://godoc.org/github.com/dgraph-io/ristretto#Cache.Set
 var ErrItemDropped = errors.New("item dropped")
 
+// ErrKeysNotTracked is returned by Scan when the store was not created by NewRistrettoStore.
+var ErrKeysNotTracked = errors.New("keys not tracked")
+
 // RistrettoStore is used to create an in-memory ristretto cache.
 //
 // See: https://godoc.org/github.com/dgraph-io/ristretto
 type RistrettoStore struct {
 	Cache       *ristretto.Cache
 	DefaultCost *int64
+
+	// keys tracks the keys stored since ristretto only stores their hashes.
+	// It is used by Scan.
+	keys *keys
+}
+
+// keys maps key hashes to keys.
+type keys struct {
+	mu   sync.Mutex
+	m    map[uint64]string
+	hash func(key interface{}) (uint64, uint64)
+}
+
+func (k *keys) add(key string) {
+	h, _ := k.hash(key)
+	k.mu.Lock()
+	k.m[h] = key
+	k.mu.Unlock()
+}
+
+func (k *keys) remove(h uint64) {
+	k.mu.Lock()
+	delete(k.m, h)
+	k.mu.Unlock()
+}
+
+func (k *keys) clear() {
+	k.mu.Lock()
+	k.m = map[uint64]string{}
+	k.mu.Unlock()
+}
+
+func (k *keys) list() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	out := make([]string, 0, len(k.m))
+	for _, key := range k.m {
+		out = append(out, key)
+	}
+	return out
 }
 
 // NewRistrettoStore creates an in-memory ristretto cache.
 //
+// The keys stored are tracked so that the cache can be scanned (eg. to save a snapshot).
+// config's OnEvict and OnReject functions are wrapped to stop tracking evicted keys.
+//
+// Since ristretto applies sets asynchronously, an eviction of an earlier value of a key
+// can be reported after the key is set again. The key is then no longer tracked (and
+// not scanned) until it is set again, even though its new value is stored.
+//
 // See: https://godoc.org/github.com/dgraph-io/ristretto#Config
 func NewRistrettoStore(config *ristretto.Config, defaultCost ...int64) *RistrettoStore {
-	cache, err := ristretto.NewCache(config)
+	k := &keys{m: map[uint64]string{}, hash: z.KeyToHash}
+	if config.KeyToHash != nil {
+		k.hash = config.KeyToHash
+	}
+
+	cfg := *config
+	onEvict, onReject := config.OnEvict, config.OnReject
+	cfg.OnEvict = func(item *ristretto.Item) {
+		k.remove(item.Key)
+		if onEvict != nil {
+			onEvict(item)
+		}
+	}
+	cfg.OnReject = func(item *ristretto.Item) {
+		k.remove(item.Key)
+		if onReject != nil {
+			onReject(item)
+		}
+	}
+
+	cache, err := ristretto.NewCache(&cfg)
 	if err != nil {
 		panic(err)
 	}
@@ -44,6 +118,7 @@ func NewRistrettoStore(config *ristretto.Config, defaultCost ...int64) *Ristrett
 	return &RistrettoStore{
 		Cache:       cache,
 		DefaultCost: dc,
+		keys:        k,
 	}
 }
 
@@ -52,6 +127,11 @@ func (r *RistrettoStore) Conn(ctx context.Context) (remember.Cacher, error) {
 	return r, nil
 }
 
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (r *RistrettoStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
 // StorePointer sets whether a storage driver requires itemToStore to be
 // stored as a pointer or as a concrete value.
 func (r *RistrettoStore) StorePointer() bool {
@@ -86,6 +166,9 @@ func (r *RistrettoStore) Set(key string, expiration time.Duration, itemToStore i
 	}
 
 	if stored {
+		if r.keys != nil {
+			r.keys.add(key)
+		}
 		return nil
 	}
 	return ErrItemDropped
@@ -95,11 +178,23 @@ func (r *RistrettoStore) Set(key string, expiration time.Duration, itemToStore i
 // For this driver, it does nothing.
 func (r *RistrettoStore) Close() {}
 
+// Wait blocks until the pending sets have been applied. Items are dropped
+// (see ErrItemDropped) while too many sets are pending.
+//
+// See: https://godoc.org/github.com/dgraph-io/ristretto#Cache.Wait
+func (r *RistrettoStore) Wait() {
+	r.Cache.Wait()
+}
+
 // Forget clears the value from the cache for the particular key.
 //
 // See: https://godoc.org/github.com/dgraph-io/ristretto#Cache.Del
 func (r *RistrettoStore) Forget(key string) error {
 	r.Cache.Del(key)
+	if r.keys != nil {
+		h, _ := r.keys.hash(key)
+		r.keys.remove(h)
+	}
 	return nil
 }
 
@@ -109,5 +204,42 @@ func (r *RistrettoStore) Forget(key string) error {
 // See: https://godoc.org/github.com/dgraph-io/ristretto#Cache.Clear
 func (r *RistrettoStore) ForgetAll() error {
 	r.Cache.Clear()
+	if r.keys != nil {
+		r.keys.clear()
+	}
+	return nil
+}
+
+// Scan calls fn for each entry with its remaining time to live
+// (snapshot.NoTTL if it does not expire) and its value.
+//
+// Since ristretto applies sets asynchronously, recently set entries may not be included
+// (see NewRistrettoStore). ErrKeysNotTracked is returned if the store was not created by NewRistrettoStore.
+func (r *RistrettoStore) Scan(ctx context.Context, fn func(key string, ttl time.Duration, value interface{}) error) error {
+	if r.keys == nil {
+		return ErrKeysNotTracked
+	}
+
+	for _, key := range r.keys.list() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		value, found := r.Cache.Get(key)
+		if !found {
+			continue
+		}
+		ttl, found := r.Cache.GetTTL(key)
+		if !found {
+			continue
+		}
+		if ttl == 0 {
+			ttl = snapshot.NoTTL // ristretto reports 0 for entries that do not expire
+		}
+
+		if err := fn(key, ttl, value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -4,6 +4,7 @@ package ristretto_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -75,3 +76,38 @@ func TestFetchFromCacheAndDisableCache(t *testing.T) {
 		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
 	}
 }
+
+func TestScan(t *testing.T) {
+	var rs = ristretto.NewRistrettoStore(cfg)
+
+	rs.Set("a", time.Hour, 1)
+	rs.Set("b", ristretto.NoExpiration, 2)
+	rs.Set("c", time.Hour, 3)
+	rs.Cache.Wait()
+	rs.Forget("c")
+
+	actual := map[string]interface{}{}
+	err := rs.Scan(ctx, func(key string, ttl time.Duration, value interface{}) error {
+		if key == "a" && (ttl <= 59*time.Minute || ttl > time.Hour) {
+			t.Errorf("wrong ttl: %v", ttl)
+		}
+		if key == "b" && ttl >= 0 {
+			t.Errorf("wrong ttl: expected: negative actual: %v", ttl)
+		}
+		actual[key] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"a": 1, "b": 2}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	unscannable := &ristretto.RistrettoStore{Cache: rs.Cache}
+	if err := unscannable.Scan(ctx, nil); err != ristretto.ErrKeysNotTracked {
+		t.Errorf("wrong err: expected: %v actual: %v", ristretto.ErrKeysNotTracked, err)
+	}
+}
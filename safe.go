@@ -0,0 +1,234 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package remember
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+const (
+	minLockPollInterval = 10 * time.Millisecond
+	maxLockPollInterval = 250 * time.Millisecond
+
+	// releasedLockExpiration is the expiration of a released lock. It is the
+	// smallest expiration supported by all storage drivers.
+	releasedLockExpiration = time.Second
+)
+
+// lock is stored as a placeholder for a key while SlowRetrieve is being
+// called in SafeSet mode.
+//
+// A lock is released by swapping it for a released lock (rather than deleting it),
+// so that a value stored by another caller after the lock expired is not removed.
+// A released lock can be acquired by the next caller.
+type lock struct {
+	Token    uint64
+	Released bool
+}
+
+func init() {
+	gob.Register(lock{})
+}
+
+// IsLock reports whether item is the placeholder stored for a key while
+// SlowRetrieve is being called in SafeSet mode. It is not cached data.
+func IsLock(item interface{}) bool {
+	_, ok := asLock(item)
+	return ok
+}
+
+// asLock returns the lock stored as item.
+func asLock(item interface{}) (lock, bool) {
+	switch l := item.(type) {
+	case lock:
+		return l, true
+	case *lock:
+		if l != nil {
+			return *l, true
+		}
+	}
+	return lock{}, false
+}
+
+// newLock creates a lock with a random token.
+func newLock() (lock, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return lock{}, err
+	}
+	return lock{Token: binary.LittleEndian.Uint64(b[:])}, nil
+}
+
+// safeCache implements the SafeSet mode of Cache.
+func safeCache(ctx context.Context, cache CASCacher, key string, expiration, lockTimeout time.Duration, clock Clock, fn SlowRetrieve, logger Logger, onlyLogErrors, gobRegister bool) (_ interface{}, found bool, _ error) {
+
+	var (
+		deadline = clock.Now().Add(lockTimeout)
+		wait     = minLockPollInterval
+	)
+
+	// fetch grabs from SlowRetrieve without storing the result.
+	fetch := func() (interface{}, bool, error) {
+		out, err := fn(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		return out, false, nil
+	}
+
+	l, err := newLock()
+	if err != nil {
+		if logger != nil {
+			logger.Log(logPatternRed, "could not create lock for key: "+key+" error: "+err.Error())
+		}
+		return fetch()
+	}
+
+	for {
+		// Check if item exists
+		item, cas, found, err := cache.GetCAS(key)
+		if err != nil {
+			// Error when attempting to fetch from cache
+			if logger != nil {
+				logger.Log(logPatternRed, "could not fetch from cache key: "+key+" error: "+err.Error())
+			}
+			return fetch()
+		}
+
+		if found {
+			current, locked := asLock(item)
+			if !locked {
+				// Item exists in cache
+				if logger != nil && !onlyLogErrors {
+					logger.Log(logPatternBlue, "Found in Cache key: "+key)
+				}
+				return item, true, nil
+			}
+
+			if current.Released {
+				// Attempt to acquire the released lock
+				err = cache.CompareAndSwap(key, lockTimeout, storable(cache, l), cas)
+				if err == nil {
+					break
+				}
+				if err != ErrCASConflict {
+					if logger != nil {
+						logger.Log(logPatternRed, "could not acquire lock for key: "+key+" error: "+err.Error())
+					}
+					return fetch()
+				}
+				// Another caller acquired the lock first
+				continue
+			}
+
+			// Another caller is grabbing from SlowRetrieve
+			if clock.Now().After(deadline) {
+				if logger != nil && !onlyLogErrors {
+					logger.Log(logPatternBlue, "[safe set] Lock timed out. Grabbing from SlowRetrieve key: "+key)
+				}
+				return fetch()
+			}
+
+			if logger != nil && !onlyLogErrors && wait == minLockPollInterval {
+				logger.Log(logPatternBlue, "[safe set] Waiting for lock key: "+key)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			case <-clock.After(wait):
+			}
+
+			wait = wait * 2
+			if wait > maxLockPollInterval {
+				wait = maxLockPollInterval
+			}
+			continue
+		}
+
+		// Attempt to acquire lock
+		err = cache.Add(key, lockTimeout, storable(cache, l))
+		if err == nil {
+			break
+		}
+		if err != ErrNotStored {
+			if logger != nil {
+				logger.Log(logPatternRed, "could not acquire lock for key: "+key+" error: "+err.Error())
+			}
+			return fetch()
+		}
+		// Another caller acquired the lock first
+	}
+
+	if logger != nil && !onlyLogErrors {
+		logger.Log(logPatternBlue, "[safe set] Grabbing from SlowRetrieve key: "+key)
+	}
+
+	itemToStore, err := fn(ctx)
+	if err != nil {
+		releaseLock(cache, key, l, logger)
+		return nil, false, err
+	}
+
+	if gobRegister {
+		registerGob(itemToStore, logger)
+	}
+
+	// Store item in Cache only if the lock is still held
+	held, cas, err := lockHeld(cache, key, l)
+	if err == nil {
+		if !held {
+			err = ErrCASConflict
+		} else {
+			err = cache.CompareAndSwap(key, expiration, storable(cache, itemToStore), cas)
+		}
+	}
+	if err != nil {
+		if err == ErrCASConflict {
+			if logger != nil && !onlyLogErrors {
+				logger.Log(logPatternBlue, "[safe set] Discarding stale item for key: "+key)
+			}
+		} else if logger != nil {
+			// Storage failed
+			logger.Log(logPatternRed, "Could not store item to key: "+key+" "+err.Error()+" "+fmt.Sprintf("%+v", itemToStore))
+		}
+	}
+
+	return itemToStore, false, nil
+}
+
+// lockHeld reports whether l is still stored for key. If it is, the cas
+// token of the lock is also returned.
+func lockHeld(cache CASCacher, key string, l lock) (bool, uint64, error) {
+	item, cas, found, err := cache.GetCAS(key)
+	if err != nil || !found {
+		return false, 0, err
+	}
+	if current, ok := asLock(item); ok && current == l {
+		return true, cas, nil
+	}
+	return false, 0, nil
+}
+
+// releaseLock releases l if it is still stored for key.
+//
+// The lock is swapped using its cas token, so a value stored by another caller
+// after the lock expired is left untouched.
+func releaseLock(cache CASCacher, key string, l lock, logger Logger) {
+	held, cas, err := lockHeld(cache, key, l)
+	if err == nil && held {
+		err = cache.CompareAndSwap(key, releasedLockExpiration, storable(cache, lock{Released: true}), cas)
+		if err == ErrCASConflict {
+			// The lock is no longer held
+			err = nil
+		}
+	}
+	if err != nil && logger != nil {
+		logger.Log(logPatternRed, "could not release lock for key: "+key+" error: "+err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package snapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// SaveFile exports the entries of c to the file at path and returns how many were written.
+// It is intended to be called on graceful shutdown so that an in-memory cache can be
+// warm-started using LoadFile.
+//
+// The snapshot is written to a temporary file which replaces path once complete,
+// so an existing snapshot is never left partially written.
+func SaveFile(ctx context.Context, c remember.Conner, path string, cfg ...ExportConfig) (int, error) {
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := Export(ctx, c, f, cfg...)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// LoadFile imports the entries of the snapshot file at path into c.
+// Entries that have expired since the snapshot was saved are skipped.
+//
+// If the file does not exist, an error satisfying errors.Is(err, os.ErrNotExist) is returned.
+// This is expected the first time an application is started.
+func LoadFile(ctx context.Context, c remember.Conner, path string, cfg ...ImportConfig) (ImportResult, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer f.Close()
+
+	return Import(ctx, c, f, cfg...)
+}
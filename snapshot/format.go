@@ -0,0 +1,246 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned when a snapshot can not be read.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Version is the version of the snapshot format.
+const Version = 1
+
+// magic identifies a binary snapshot.
+const magic = "RMBRSNAP"
+
+// formatName identifies a JSON-lines snapshot.
+const formatName = "remember-snapshot"
+
+// maxLen limits the length of keys, values and headers in binary snapshots so that
+// corrupt files don't cause huge allocations.
+const maxLen = 1 << 30
+
+// Format is the encoding of a snapshot file.
+type Format int
+
+const (
+	// JSONLines encodes the snapshot as one JSON object per line. Values are base64 encoded.
+	// It is human readable and can be processed with standard tools.
+	JSONLines Format = 0
+
+	// Binary encodes the snapshot compactly.
+	Binary Format = 1
+)
+
+// Header describes a snapshot.
+type Header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Codec   string    `json:"codec"`   // The codec used to encode the values
+	Created time.Time `json:"created"` // When the snapshot was created
+}
+
+// Entry is a single cache entry.
+type Entry struct {
+	Key string
+
+	// TTL is the remaining time to live when the snapshot was created.
+	// The TTL of entries that do not expire is NoTTL.
+	TTL time.Duration
+
+	// Value is the encoded value.
+	Value []byte
+}
+
+// jsonEntry is an Entry encoded in a JSON-lines snapshot.
+type jsonEntry struct {
+	Key   string `json:"key"`
+	TTL   int64  `json:"ttl_ms"` // -1 means no expiration
+	Value []byte `json:"value"`
+}
+
+// ttlMillis converts ttl into milliseconds (rounding up so that short TTLs are kept).
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Duration {
+	if ms < 0 {
+		return NoTTL
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Writer writes a snapshot.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	enc    *json.Encoder
+	buf    [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes the snapshot's header to w and returns a Writer for its entries.
+// Flush must be called after the entries have been written.
+func NewWriter(w io.Writer, format Format, h Header) (*Writer, error) {
+	h.Format = formatName
+	h.Version = Version
+
+	sw := &Writer{w: bufio.NewWriter(w), format: format}
+
+	switch format {
+	case JSONLines:
+		sw.enc = json.NewEncoder(sw.w)
+		if err := sw.enc.Encode(h); err != nil {
+			return nil, err
+		}
+	case Binary:
+		b, err := json.Marshal(h)
+		if err != nil {
+			return nil, err
+		}
+		sw.w.WriteString(magic)
+		sw.writeBytes(b)
+	default:
+		return nil, fmt.Errorf("unknown format: %d", format)
+	}
+
+	return sw, nil
+}
+
+// Write writes an entry.
+func (w *Writer) Write(e Entry) error {
+	if w.format == JSONLines {
+		return w.enc.Encode(jsonEntry{e.Key, ttlMillis(e.TTL), e.Value})
+	}
+
+	w.writeBytes([]byte(e.Key))
+	n := binary.PutVarint(w.buf[:], ttlMillis(e.TTL))
+	w.w.Write(w.buf[:n])
+	return w.writeBytes(e.Value)
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) writeBytes(b []byte) error {
+	n := binary.PutUvarint(w.buf[:], uint64(len(b)))
+	w.w.Write(w.buf[:n])
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Reader reads a snapshot. The format is detected automatically.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	dec    *json.Decoder
+	header Header
+}
+
+// NewReader reads the snapshot's header from r and returns a Reader for its entries.
+func NewReader(r io.Reader) (*Reader, error) {
+	sr := &Reader{r: bufio.NewReader(r)}
+
+	b, err := sr.r.Peek(len(magic))
+	if err != nil && len(b) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	if bytes.Equal(b, []byte(magic)) {
+		sr.format = Binary
+		sr.r.Discard(len(magic))
+		hb, err := sr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(hb, &sr.header); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+	} else {
+		sr.format = JSONLines
+		sr.dec = json.NewDecoder(sr.r)
+		if err := sr.dec.Decode(&sr.header); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+	}
+
+	if sr.header.Format != formatName {
+		return nil, fmt.Errorf("%w: not a snapshot", ErrInvalidSnapshot)
+	}
+	if sr.header.Version != Version {
+		return nil, fmt.Errorf("%w: unsupported version: %d", ErrInvalidSnapshot, sr.header.Version)
+	}
+	return sr, nil
+}
+
+// Header returns the snapshot's header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Format returns the snapshot's format.
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Next returns the next entry. io.EOF is returned when there are no more entries.
+func (r *Reader) Next() (Entry, error) {
+	if r.format == JSONLines {
+		var je jsonEntry
+		if err := r.dec.Decode(&je); err != nil {
+			if err == io.EOF {
+				return Entry{}, io.EOF
+			}
+			return Entry{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		return Entry{je.Key, fromMillis(je.TTL), je.Value}, nil
+	}
+
+	if _, err := r.r.Peek(1); err == io.EOF {
+		return Entry{}, io.EOF
+	}
+
+	key, err := r.readBytes()
+	if err != nil {
+		return Entry{}, err
+	}
+	ms, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	val, err := r.readBytes()
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{string(key), fromMillis(ms), val}, nil
+}
+
+func (r *Reader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if n > maxLen {
+		return nil, fmt.Errorf("%w: length %d is too large", ErrInvalidSnapshot, n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,390 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package snapshot exports and imports cache contents.
+//
+// Entries (key, remaining time to live and encoded value) are streamed from a
+// storage driver that can be scanned into a portable snapshot file. A snapshot
+// can be imported into any storage driver.
+//
+// Example:
+//
+//	// Migrate from memcached to redis
+//	var buf bytes.Buffer
+//	snapshot.Export(ctx, ms, &buf)
+//	snapshot.Import(ctx, rs, &buf, snapshot.ImportConfig{Rate: 1000})
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// NoTTL is the ttl of entries that do not expire. It is reported by Scan and
+// ScanRaw, and passed to SetRaw.
+const NoTTL time.Duration = -1
+
+// ErrNotScannable is returned by Export when the storage driver can not be scanned.
+var ErrNotScannable = errors.New("storage driver can not be scanned")
+
+// ErrNoExpiration is returned by Import when an entry that does not expire can not
+// be stored because the storage driver's NoExpiration value is not known.
+var ErrNoExpiration = errors.New("no expiration value not known")
+
+// ErrCodecMismatch is returned by Import when the snapshot's values were encoded
+// using a different codec.
+var ErrCodecMismatch = errors.New("codec mismatch")
+
+// Scanner is implemented by storage drivers that store values in memory (eg. memory).
+type Scanner interface {
+	// Scan calls fn for each entry. The ttl of entries that do not expire is NoTTL.
+	Scan(ctx context.Context, fn func(key string, ttl time.Duration, value interface{}) error) error
+}
+
+// RawScanner is implemented by storage drivers that store gob encoded values (eg. redis, memcached).
+type RawScanner interface {
+	// ScanRaw calls fn for each entry. The ttl of entries that do not expire is NoTTL.
+	ScanRaw(ctx context.Context, fn func(key string, ttl time.Duration, value []byte) error) error
+}
+
+// RawSetter is implemented by storage drivers that store gob encoded values (eg. redis, memcached).
+type RawSetter interface {
+	// SetRaw stores a gob encoded value. A ttl of NoTTL indicates that the entry does not expire.
+	SetRaw(ctx context.Context, key string, ttl time.Duration, value []byte) error
+}
+
+// NoExpirer is implemented by storage drivers to report their NoExpiration value.
+type NoExpirer interface {
+	// NoExpiration returns the expiration used to indicate that data should not expire.
+	NoExpiration() time.Duration
+}
+
+// Waiter is implemented by storage drivers that apply writes asynchronously and
+// drop them while too many are pending (eg. ristretto).
+type Waiter interface {
+	// Wait blocks until the pending writes have been applied.
+	Wait()
+}
+
+// Codec encodes and decodes values.
+type Codec interface {
+	// Name identifies the codec. It is recorded in the snapshot.
+	Name() string
+	Encode(v interface{}) ([]byte, error)
+	Decode(b []byte) (interface{}, error)
+}
+
+// Gob is the codec used by the storage drivers that encode values (eg. redis, memcached).
+// Values must be registered with the gob package.
+var Gob Codec = gobCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(v interface{}) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := gob.NewEncoder(b).Encode(&v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Decode(b []byte) (interface{}, error) {
+	var out interface{}
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&out)
+	return out, err
+}
+
+// ExportConfig is used to configure Export.
+type ExportConfig struct {
+
+	// Format is the format of the snapshot. The default is JSONLines.
+	Format Format
+
+	// Codec encodes the values. If not set, Gob is used.
+	//
+	// Values of storage drivers that implement RawScanner are already gob encoded.
+	// If another codec is used, they are decoded and re-encoded.
+	Codec Codec
+
+	// Match, if set, determines which keys are exported.
+	Match func(key string) bool
+
+	// Clock is used to timestamp the snapshot.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// Export writes the entries of c to w and returns how many were written.
+// c must implement Scanner or RawScanner.
+func Export(ctx context.Context, c remember.Conner, w io.Writer, cfg ...ExportConfig) (int, error) {
+	var conf ExportConfig
+	if len(cfg) > 0 {
+		conf = cfg[0]
+	}
+	if conf.Codec == nil {
+		conf.Codec = Gob
+	}
+
+	sw, err := NewWriter(w, conf.Format, Header{
+		Codec:   conf.Codec.Name(),
+		Created: remember.ClockOrDefault(conf.Clock).Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	write := func(key string, ttl time.Duration, value []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := sw.Write(Entry{key, ttl, value}); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+
+	switch s := c.(type) {
+	case RawScanner:
+		transcode := conf.Codec.Name() != Gob.Name()
+		err = s.ScanRaw(ctx, func(key string, ttl time.Duration, value []byte) error {
+			if conf.Match != nil && !conf.Match(key) {
+				return nil
+			}
+			if transcode {
+				v, err := Gob.Decode(value)
+				if err != nil {
+					return fmt.Errorf("decode %q: %w", key, err)
+				}
+				if value, err = conf.Codec.Encode(v); err != nil {
+					return fmt.Errorf("encode %q: %w", key, err)
+				}
+			}
+			return write(key, ttl, value)
+		})
+	case Scanner:
+		err = s.Scan(ctx, func(key string, ttl time.Duration, v interface{}) error {
+			if conf.Match != nil && !conf.Match(key) {
+				return nil
+			}
+			if remember.IsLock(v) {
+				return nil
+			}
+			value, err := conf.Codec.Encode(v)
+			if err != nil {
+				return fmt.Errorf("encode %q: %w", key, err)
+			}
+			return write(key, ttl, value)
+		})
+	default:
+		return 0, ErrNotScannable
+	}
+
+	if err != nil {
+		return n, err
+	}
+	return n, sw.Flush()
+}
+
+// ImportConfig is used to configure Import.
+type ImportConfig struct {
+
+	// Rate limits the number of entries imported per second.
+	// If not set, entries are imported as fast as possible.
+	Rate float64
+
+	// Codec decodes the values. It must have the same name as the codec
+	// used to create the snapshot. If not set, Gob is used.
+	//
+	// Gob encoded values are stored without being decoded in storage drivers
+	// that implement RawSetter.
+	Codec Codec
+
+	// Match, if set, determines which keys are imported.
+	Match func(key string) bool
+
+	// NoExpiration is the storage driver's NoExpiration value.
+	// It is used to store entries that do not expire (for storage drivers
+	// that don't implement RawSetter).
+	//
+	// If not set, the value reported by a storage driver that implements NoExpirer
+	// is used. Otherwise, importing an entry that does not expire fails with
+	// ErrNoExpiration.
+	NoExpiration time.Duration
+
+	// Clock is used to determine how much time has elapsed since the snapshot
+	// was created, and for rate limiting.
+	// If not set, remember.SystemClock is used.
+	Clock remember.Clock
+}
+
+// ImportResult reports the outcome of Import.
+type ImportResult struct {
+	Imported int // Entries stored
+	Expired  int // Entries that expired since the snapshot was created
+	Skipped  int // Entries not matched by ImportConfig.Match
+	Dropped  int // Entries dropped by a storage driver that implements Waiter
+}
+
+// Import stores the entries of the snapshot read from r into c.
+//
+// The time elapsed since the snapshot was created is subtracted from each entry's
+// time to live. Entries that have since expired are skipped.
+//
+// If c implements Waiter, an entry that can not be stored is retried after
+// waiting for the pending writes. If it fails again, it is counted as dropped.
+func Import(ctx context.Context, c remember.Conner, r io.Reader, cfg ...ImportConfig) (ImportResult, error) {
+	var (
+		conf ImportConfig
+		res  ImportResult
+	)
+	if len(cfg) > 0 {
+		conf = cfg[0]
+	}
+	if conf.Codec == nil {
+		conf.Codec = Gob
+	}
+	clock := remember.ClockOrDefault(conf.Clock)
+
+	noExpiration, known := conf.NoExpiration, conf.NoExpiration != 0
+	if ne, ok := c.(NoExpirer); ok && !known {
+		noExpiration, known = ne.NoExpiration(), true
+	}
+
+	sr, err := NewReader(r)
+	if err != nil {
+		return res, err
+	}
+
+	h := sr.Header()
+	if h.Codec != conf.Codec.Name() {
+		return res, fmt.Errorf("%w: snapshot: %q import: %q", ErrCodecMismatch, h.Codec, conf.Codec.Name())
+	}
+
+	var elapsed time.Duration
+	if !h.Created.IsZero() {
+		elapsed = clock.Now().Sub(h.Created)
+	}
+
+	rs, raw := c.(RawSetter)
+	raw = raw && h.Codec == Gob.Name()
+	waiter, _ := c.(Waiter)
+
+	var cache remember.Cacher
+	if !raw {
+		cache, err = c.Conn(ctx)
+		if err != nil {
+			return res, err
+		}
+		defer cache.Close()
+	}
+
+	lim := newLimiter(clock, conf.Rate)
+
+	for {
+		e, err := sr.Next()
+		if err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return res, err
+		}
+
+		if conf.Match != nil && !conf.Match(e.Key) {
+			res.Skipped++
+			continue
+		}
+
+		ttl := e.TTL
+		if ttl != NoTTL {
+			ttl -= elapsed
+			if ttl <= 0 {
+				res.Expired++
+				continue
+			}
+		}
+
+		if err := lim.wait(ctx); err != nil {
+			return res, err
+		}
+
+		store := func() error {
+			if raw {
+				return rs.SetRaw(ctx, e.Key, ttl, e.Value)
+			}
+			if ttl == NoTTL {
+				if !known {
+					return ErrNoExpiration
+				}
+				ttl = noExpiration
+			}
+			return set(cache, conf.Codec, e, ttl)
+		}
+
+		if err := store(); err != nil {
+			if waiter == nil || errors.Is(err, ErrNoExpiration) {
+				return res, fmt.Errorf("import %q: %w", e.Key, err)
+			}
+			waiter.Wait()
+			if err := store(); err != nil {
+				res.Dropped++
+				continue
+			}
+		}
+		res.Imported++
+	}
+}
+
+// set decodes the entry's value and stores it.
+func set(cache remember.Cacher, codec Codec, e Entry, ttl time.Duration) error {
+	v, err := codec.Decode(e.Value)
+	if err != nil {
+		return err
+	}
+
+	if cache.StorePointer() {
+		return cache.Set(e.Key, ttl, &v)
+	}
+	return cache.Set(e.Key, ttl, v)
+}
+
+// limiter spaces out operations so that at most rate occur per second.
+type limiter struct {
+	clock    remember.Clock
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(clock remember.Clock, rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{clock: clock, interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next operation is permitted.
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	now := l.clock.Now()
+	if d := l.next.Sub(now); d > 0 {
+		select {
+		case <-l.clock.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
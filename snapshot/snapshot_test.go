@@ -0,0 +1,415 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package snapshot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rist "github.com/dgraph-io/ristretto"
+	"github.com/gomodule/redigo/redis"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/remembertest"
+	"github.com/rocketlaunchr/remember-go/ristretto"
+	"github.com/rocketlaunchr/remember-go/snapshot"
+)
+
+var ctx = context.Background()
+
+type Item struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(Item{})
+}
+
+// jsonCodec is a custom codec.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                         { return "json" }
+func (jsonCodec) Encode(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) Decode(b []byte) (interface{}, error) {
+	var out Item
+	err := json.Unmarshal(b, &out)
+	return out, err
+}
+
+func TestFormats(t *testing.T) {
+	entries := []snapshot.Entry{
+		{Key: "a", TTL: time.Hour, Value: []byte("1")},
+		{Key: "b", TTL: -1, Value: []byte{0, 1, 2}},
+		{Key: "", TTL: 1500 * time.Microsecond, Value: nil},
+	}
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, format := range []snapshot.Format{snapshot.JSONLines, snapshot.Binary} {
+		var buf bytes.Buffer
+
+		w, err := snapshot.NewWriter(&buf, format, snapshot.Header{Codec: "gob", Created: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			w.Write(e)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := snapshot.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Format() != format || r.Header().Codec != "gob" || !r.Header().Created.Equal(created) {
+			t.Errorf("wrong header: %+v", r.Header())
+		}
+
+		var actual []snapshot.Entry
+		for {
+			e, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			actual = append(actual, e)
+		}
+
+		// TTLs are rounded up to the nearest millisecond
+		expected := append([]snapshot.Entry(nil), entries...)
+		expected[2].TTL = 2 * time.Millisecond
+		for i := range actual {
+			if len(actual[i].Value) == 0 {
+				actual[i].Value = nil
+			}
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("wrong entries for format %d: expected: %v actual: %v", format, expected, actual)
+		}
+	}
+
+	if _, err := snapshot.NewReader(strings.NewReader("junk")); !errors.Is(err, snapshot.ErrInvalidSnapshot) {
+		t.Errorf("wrong err: expected: %v actual: %v", snapshot.ErrInvalidSnapshot, err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	clock := remembertest.NewFakeClock(time.Now())
+
+	src := memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 100, Clock: clock})
+	src.Set("short", time.Minute, Item{"short", 1})
+	src.Set("long", time.Hour, Item{"long", 2})
+	src.Set("forever", memory.NoExpiration, Item{"forever", 3})
+	src.Set("other", time.Hour, Item{"other", 4})
+
+	for _, format := range []snapshot.Format{snapshot.JSONLines, snapshot.Binary} {
+		var buf bytes.Buffer
+
+		n, err := snapshot.Export(ctx, src, &buf, snapshot.ExportConfig{
+			Format: format,
+			Match:  func(key string) bool { return key != "other" },
+			Clock:  clock,
+		})
+		if err != nil || n != 3 {
+			t.Fatalf("wrong export: n: %v err: %v", n, err)
+		}
+
+		// Entries expire after the snapshot is created
+		importClock := remembertest.NewFakeClock(clock.Now().Add(2 * time.Minute))
+
+		dst := memory.NewBoundedMemoryStore(memory.BoundedConfig{MaxEntries: 100, Clock: importClock})
+		res, err := snapshot.Import(ctx, dst, &buf, snapshot.ImportConfig{NoExpiration: memory.NoExpiration, Clock: importClock})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != (snapshot.ImportResult{Imported: 2, Expired: 1}) {
+			t.Errorf("wrong result: %+v", res)
+		}
+
+		val, _, _ := dst.Get("long")
+		if val != (Item{"long", 2}) {
+			t.Errorf("wrong val: expected: %v actual: %v", Item{"long", 2}, val)
+		}
+
+		ttl, _, _ := dst.TTL(ctx, "long")
+		if ttl != 58*time.Minute {
+			t.Errorf("wrong ttl: expected: %v actual: %v", 58*time.Minute, ttl)
+		}
+		if ttl, found, _ := dst.TTL(ctx, "forever"); !found || ttl >= 0 {
+			t.Errorf("wrong ttl: expected: %v actual: %v", memory.NoExpiration, ttl)
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rs := red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	for i, key := range []string{"a", "b", "c"} {
+		remember.Cache(ctx, rs, key, time.Hour, func(ctx context.Context) (interface{}, error) {
+			return Item{key, i}, nil
+		})
+	}
+
+	var buf bytes.Buffer
+	if _, err := snapshot.Export(ctx, rs, &buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// Into a storage driver that stores values
+	ms := memory.NewMemoryStore(time.Minute)
+	res, err := snapshot.Import(ctx, ms, bytes.NewReader(b), snapshot.ImportConfig{NoExpiration: memory.NoExpiration})
+	if err != nil || res.Imported != 3 {
+		t.Fatalf("wrong import: %+v err: %v", res, err)
+	}
+	val, _, _ := ms.Get("b")
+	if val != (Item{"b", 1}) {
+		t.Errorf("wrong val: expected: %v actual: %v", Item{"b", 1}, val)
+	}
+
+	// Into a storage driver that stores gob encoded values (without decoding them)
+	s.FlushAll()
+	if _, err := snapshot.Import(ctx, rs, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	keys := s.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b,c" {
+		t.Errorf("wrong keys: %v", keys)
+	}
+	if ttl := s.TTL("a"); ttl <= 59*time.Minute {
+		t.Errorf("wrong ttl: %v", ttl)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	ms.Set("a", memory.NoExpiration, Item{"a", 1})
+
+	var buf bytes.Buffer
+	if _, err := snapshot.Export(ctx, ms, &buf, snapshot.ExportConfig{Codec: jsonCodec{}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"codec":"json"`) {
+		t.Errorf("codec not recorded: %s", buf.String())
+	}
+	b := buf.Bytes()
+
+	if _, err := snapshot.Import(ctx, ms, bytes.NewReader(b)); !errors.Is(err, snapshot.ErrCodecMismatch) {
+		t.Errorf("wrong err: expected: %v actual: %v", snapshot.ErrCodecMismatch, err)
+	}
+
+	m := remembertest.NewMock()
+	if _, err := snapshot.Import(ctx, m, bytes.NewReader(b), snapshot.ImportConfig{Codec: jsonCodec{}, NoExpiration: remembertest.NoExpiration}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertValue(t, "a", Item{"a", 1})
+	m.AssertSet(t, "a", remembertest.NoExpiration)
+}
+
+func TestRate(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		ms.Set(key, time.Hour, 1)
+	}
+
+	var buf bytes.Buffer
+	snapshot.Export(ctx, ms, &buf)
+
+	start := time.Now()
+	res, err := snapshot.Import(ctx, memory.NewMemoryStore(time.Minute), &buf, snapshot.ImportConfig{Rate: 100})
+	if err != nil || res.Imported != 5 {
+		t.Fatalf("wrong import: %+v err: %v", res, err)
+	}
+
+	// The first entry is imported immediately
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("import was not rate limited: %v", elapsed)
+	}
+}
+
+func TestNoExpiration(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	ms.Set("a", time.Hour, 1)
+	ms.Set("b", memory.NoExpiration, 2)
+
+	var buf bytes.Buffer
+	snapshot.Export(ctx, ms, &buf)
+	b := buf.Bytes()
+
+	// The storage driver does not implement NoExpirer
+	dst := struct{ remember.Conner }{memory.NewMemoryStore(time.Minute)}
+	if _, err := snapshot.Import(ctx, dst, bytes.NewReader(b)); !errors.Is(err, snapshot.ErrNoExpiration) {
+		t.Errorf("wrong err: expected: %v actual: %v", snapshot.ErrNoExpiration, err)
+	}
+
+	m := remembertest.NewMock()
+	if _, err := snapshot.Import(ctx, struct{ remember.Conner }{m}, bytes.NewReader(b), snapshot.ImportConfig{NoExpiration: remembertest.NoExpiration}); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertSet(t, "b", remembertest.NoExpiration)
+}
+
+func TestNotScannable(t *testing.T) {
+	if _, err := snapshot.Export(ctx, remembertest.NewMock(), &bytes.Buffer{}); err != snapshot.ErrNotScannable {
+		t.Errorf("wrong err: expected: %v actual: %v", snapshot.ErrNotScannable, err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+
+	if _, err := snapshot.LoadFile(ctx, memory.NewMemoryStore(time.Minute), path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("wrong err: expected: %v actual: %v", os.ErrNotExist, err)
+	}
+
+	src := ristretto.NewRistrettoStore(&rist.Config{NumCounters: 1000, MaxCost: 1 << 20, BufferItems: 64})
+	src.Set("a", time.Hour, Item{"a", 1})
+	src.Set("b", ristretto.NoExpiration, Item{"b", 2})
+	src.Cache.Wait()
+
+	n, err := snapshot.SaveFile(ctx, src, path, snapshot.ExportConfig{Format: snapshot.Binary})
+	if err != nil || n != 2 {
+		t.Fatalf("wrong save: n: %v err: %v", n, err)
+	}
+
+	// Warm-start a different in-memory store (with a different NoExpiration value)
+	dst := memory.NewMemoryStore(time.Minute)
+	res, err := snapshot.LoadFile(ctx, dst, path)
+	if err != nil || res.Imported != 2 {
+		t.Fatalf("wrong load: %+v err: %v", res, err)
+	}
+
+	val, _, _ := dst.Get("a")
+	if val != (Item{"a", 1}) {
+		t.Errorf("wrong val: expected: %v actual: %v", Item{"a", 1}, val)
+	}
+	if ttl, _, _ := dst.TTL(ctx, "a"); ttl <= 59*time.Minute {
+		t.Errorf("wrong ttl: %v", ttl)
+	}
+	if ttl, found, _ := dst.TTL(ctx, "b"); !found || ttl >= 0 {
+		t.Errorf("wrong ttl: expected: %v actual: %v", memory.NoExpiration, ttl)
+	}
+
+	// Save overwrites the previous snapshot
+	dst.Forget("a")
+	if n, err := snapshot.SaveFile(ctx, dst, path); err != nil || n != 1 {
+		t.Fatalf("wrong save: n: %v err: %v", n, err)
+	}
+
+	rs := ristretto.NewRistrettoStore(&rist.Config{NumCounters: 1000, MaxCost: 1 << 20, BufferItems: 64})
+	if res, err := snapshot.LoadFile(ctx, rs, path); err != nil || res.Imported != 1 {
+		t.Fatalf("wrong load: %+v err: %v", res, err)
+	}
+	rs.Cache.Wait()
+
+	if val, _, _ := rs.Get("b"); val != (Item{"b", 2}) {
+		t.Errorf("wrong val: expected: %v actual: %v", Item{"b", 2}, val)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	if len(files) != 1 {
+		t.Errorf("temporary files not removed: %v", files)
+	}
+}
+
+func TestRistrettoDrops(t *testing.T) {
+	// ristretto drops items while its set buffer is full
+	const n = 100000
+
+	var buf bytes.Buffer
+	w, err := snapshot.NewWriter(&buf, snapshot.Binary, snapshot.Header{Codec: "gob", Created: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		value, _ := snapshot.Gob.Encode(i)
+		if err := w.Write(snapshot.Entry{Key: fmt.Sprintf("key-%d", i), TTL: -1, Value: value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := ristretto.NewRistrettoStore(&rist.Config{NumCounters: 10 * n, MaxCost: 10 * n, BufferItems: 64})
+	res, err := snapshot.Import(ctx, rs, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported+res.Dropped != n || res.Imported == 0 {
+		t.Errorf("wrong result: %+v", res)
+	}
+}
+
+// busyStore drops writes while too many are pending (like ristretto).
+type busyStore struct {
+	*memory.MemoryStore
+	pending int
+	waits   int
+}
+
+var errBusy = errors.New("busy")
+
+func (s *busyStore) Conn(ctx context.Context) (remember.Cacher, error) { return s, nil }
+
+func (s *busyStore) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	if s.pending == 3 {
+		return errBusy
+	}
+	s.pending++
+	return s.MemoryStore.Set(key, expiration, itemToStore)
+}
+
+func (s *busyStore) Wait() {
+	s.pending = 0
+	s.waits++
+}
+
+func TestWaiter(t *testing.T) {
+	src := memory.NewMemoryStore(time.Minute)
+	for i := 0; i < 10; i++ {
+		src.Set(fmt.Sprintf("key-%d", i), time.Hour, i)
+	}
+
+	var buf bytes.Buffer
+	if _, err := snapshot.Export(ctx, src, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := &busyStore{MemoryStore: memory.NewMemoryStore(time.Minute)}
+	res, err := snapshot.Import(ctx, dst, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (snapshot.ImportResult{Imported: 10}) || dst.waits != 3 {
+		t.Errorf("wrong result: %+v waits: %v", res, dst.waits)
+	}
+}
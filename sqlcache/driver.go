@@ -0,0 +1,270 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+// WrapDriver returns a driver that invalidates the entries in idx that depend on
+// the tables modified by INSERT, UPDATE, DELETE (and similar) statements.
+// Statements executed inside a transaction invalidate entries when the
+// transaction is committed.
+//
+// Example:
+//
+//  sql.Register("sqlite3-cached", sqlcache.WrapDriver(&sqlite3.SQLiteDriver{}, idx))
+//  db, err := sql.Open("sqlite3-cached", dsn)
+func WrapDriver(d driver.Driver, idx *Index) driver.Driver {
+	return &wrappedDriver{Driver: d, idx: idx}
+}
+
+// NewConnector returns a driver.Connector for use with sql.OpenDB. It is
+// an alternative to WrapDriver that does not require registering a driver.
+func NewConnector(d driver.Driver, dsn string, idx *Index) driver.Connector {
+	return &connector{driver: &wrappedDriver{Driver: d, idx: idx}, dsn: dsn}
+}
+
+type connector struct {
+	driver *wrappedDriver
+	dsn    string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+type wrappedDriver struct {
+	driver.Driver
+	idx *Index
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, idx: d.idx}, nil
+}
+
+type conn struct {
+	driver.Conn
+	idx *Index
+	tx  *tx // The current transaction
+}
+
+// invalidate invalidates the tables modified by query. Inside a transaction,
+// the tables are invalidated when the transaction is committed.
+func (c *conn) invalidate(query string) {
+	tables, write := writeTables(query)
+	if !write {
+		return
+	}
+
+	if c.tx != nil {
+		c.tx.tables = append(c.tx.tables, tables...)
+		return
+	}
+	c.idx.invalidate(tables)
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, conn: c, query: query}, nil
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+
+	s, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, conn: c, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	t, err := c.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	c.tx = &tx{Tx: t, conn: c}
+	return c.tx, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	bt, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return c.Begin()
+	}
+
+	t, err := bt.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = &tx{Tx: t, conn: c}
+	return c.tx, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip // database/sql will use Prepare instead
+	}
+
+	res, err := ec.ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(query)
+	return res, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip // database/sql will use Prepare instead
+	}
+
+	rows, err := qc.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(query) // eg. INSERT ... RETURNING
+	return rows, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.Conn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.Stmt.Exec(args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.invalidate(s.query)
+	return res, nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.Stmt.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.invalidate(s.query)
+	return rows, nil
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+
+	res, err := ec.ExecContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.invalidate(s.query)
+	return res, nil
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+
+	rows, err := qc.QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.invalidate(s.query)
+	return rows, nil
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tx struct {
+	driver.Tx
+	conn   *conn
+	tables []string // Tables modified during the transaction
+}
+
+func (t *tx) Commit() error {
+	t.conn.tx = nil
+
+	err := t.Tx.Commit()
+	if err != nil {
+		return err
+	}
+	if len(t.tables) > 0 {
+		t.conn.idx.invalidate(t.tables)
+	}
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.conn.tx = nil
+	return t.Tx.Rollback()
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	out := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sqlcache: driver does not support named parameters")
+		}
+		out[i] = arg.Value
+	}
+	return out, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/sqlcache"
+)
+
+func openWrapped(t *testing.T, c remember.Conner) *sqlcache.DB {
+	t.Helper()
+
+	idx := sqlcache.NewIndex(c)
+
+	sqlDB := sql.OpenDB(sqlcache.NewConnector(&sqlite3.SQLiteDriver{}, ":memory:", idx))
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT, author TEXT, published_at INTEGER)`,
+		`CREATE TABLE authors (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO books (id, title) VALUES (1, 'Dune')`,
+		`INSERT INTO authors (id, name) VALUES (1, 'Herbert')`,
+	} {
+		if _, err := sqlDB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := sqlcache.NewDB(sqlDB)
+	db.Index = idx
+	return db
+}
+
+func titles(t *testing.T, db *sqlcache.DB, c remember.Conner) ([]string, bool) {
+	t.Helper()
+
+	var out []string
+	found, err := db.QueryCached(ctx, c, time.Minute, &out, `SELECT title FROM books ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, found
+}
+
+func names(t *testing.T, db *sqlcache.DB, c remember.Conner) ([]string, bool) {
+	t.Helper()
+
+	var out []string
+	found, err := db.QueryCached(ctx, c, time.Minute, &out, `SELECT name FROM authors ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, found
+}
+
+func testInvalidation(t *testing.T, c remember.Conner) {
+	db := openWrapped(t, c)
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertTitles := func(expectedLen int, expectedFound bool) {
+		t.Helper()
+		out, found := titles(t, db, c)
+		if len(out) != expectedLen || found != expectedFound {
+			t.Errorf("wrong val: expected: %v/%v actual: %v/%v", expectedLen, expectedFound, len(out), found)
+		}
+	}
+
+	// Warm up cache
+	titles(t, db, c)
+	names(t, db, c)
+	assertTitles(1, true)
+
+	// Writes to the table invalidate dependent entries
+	exec(`INSERT INTO books (id, title) VALUES (?, ?)`, 2, "Emma")
+	assertTitles(2, false)
+	assertTitles(2, true)
+
+	// Other tables are unaffected
+	if _, found := names(t, db, c); !found {
+		t.Errorf("expected value to be found in cache")
+	}
+	exec(`UPDATE authors SET name = 'Frank Herbert'`)
+	assertTitles(2, true)
+	if _, found := names(t, db, c); found {
+		t.Errorf("expected value to not be found in cache")
+	}
+
+	// Prepared statements
+	stmt, err := db.Prepare(`DELETE FROM "Books" WHERE id = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(2); err != nil {
+		t.Fatal(err)
+	}
+	assertTitles(1, false)
+
+	// Transactions invalidate when committed
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO books (id, title) VALUES (3, 'Ulysses')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	assertTitles(1, true)
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO books (id, title) VALUES (3, 'Ulysses')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assertTitles(2, false)
+
+	// Reads do not invalidate
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM books`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	assertTitles(2, true)
+}
+
+func TestInvalidationMemory(t *testing.T) {
+	testInvalidation(t, memory.NewMemoryStore(time.Minute))
+}
+
+func TestInvalidationRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	testInvalidation(t, red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	}))
+}
+
+func TestIndex(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	idx := sqlcache.NewIndex(ms)
+
+	c, _ := ms.Conn(ctx)
+	c.Set("short", time.Minute, "val")
+	c.Set("long", time.Minute, "val")
+
+	if err := idx.Record(ctx, "short", 10*time.Millisecond, "books"); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Record(ctx, "long", time.Minute, "books", "authors"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.Invalidate(ctx, "authors"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, _ := c.Get("long"); found {
+		t.Errorf("expected value to not be found in cache")
+	}
+	if _, found, _ := c.Get("short"); !found {
+		t.Errorf("expected value to be found in cache")
+	}
+}
+
+func TestIndexMaxDeps(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	idx := &sqlcache.Index{Conner: ms, Shards: 2, MaxDeps: 1}
+
+	c, _ := ms.Conn(ctx)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		c.Set(key, time.Minute, "val")
+		if err := idx.Record(ctx, key, time.Minute, "books"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, _ := idx.Version(ctx, "books")
+	if err := idx.Invalidate(ctx, "books"); err != nil {
+		t.Fatal(err)
+	}
+
+	// At most 1 key is recorded in each shard
+	var forgotten int
+	for i := 0; i < 10; i++ {
+		if _, found, _ := c.Get(fmt.Sprintf("key-%d", i)); !found {
+			forgotten++
+		}
+	}
+	if forgotten != 2 {
+		t.Errorf("wrong forgotten: expected: %v actual: %v", 2, forgotten)
+	}
+
+	// The keys that were not recorded are unreachable
+	if v, _ := idx.Version(ctx, "books"); v == version {
+		t.Errorf("expected version to change")
+	}
+}
+
+// hookConner calls beforeSet before an item is stored.
+type hookConner struct {
+	remember.Conner
+	beforeSet func(key string)
+}
+
+func (c hookConner) Conn(ctx context.Context) (remember.Cacher, error) {
+	cache, err := c.Conner.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return hookCacher{cache, c.beforeSet}, nil
+}
+
+type hookCacher struct {
+	remember.Cacher
+	beforeSet func(key string)
+}
+
+func (c hookCacher) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+	c.beforeSet(key)
+	return c.Cacher.Set(key, expiration, itemToStore)
+}
+
+func TestInvalidationBeforeStore(t *testing.T) {
+	ms := memory.NewMemoryStore(time.Minute)
+	db := openWrapped(t, ms)
+
+	// A write commits after the query has run but before its result is stored
+	var once sync.Once
+	hc := hookConner{ms, func(key string) {
+		once.Do(func() {
+			if _, err := db.Exec(`INSERT INTO books (id, title) VALUES (2, 'Emma')`); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}}
+
+	if got, _ := titles(t, db, hc); !reflect.DeepEqual(got, []string{"Dune"}) {
+		t.Errorf("wrong val: expected: %v actual: %v", []string{"Dune"}, got)
+	}
+
+	got, found := titles(t, db, ms)
+	if found {
+		t.Errorf("expected value to not be found in cache")
+	}
+	if expected := []string{"Dune", "Emma"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, got)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultIndexExpiration is the Index's Expiration used when it is not set.
+const DefaultIndexExpiration = 24 * time.Hour
+
+// DefaultIndexShards is the Index's Shards used when it is not set.
+const DefaultIndexShards = 16
+
+// DefaultMaxDeps is the Index's MaxDeps used when it is not set.
+const DefaultMaxDeps = 1000
+
+// deps maps the keys that depend on a table to when they expire (UnixNano).
+// 0 means the key does not expire.
+type deps map[string]int64
+
+func init() {
+	gob.Register(deps{})
+}
+
+// Index invalidates cached entries when the tables they depend on are modified.
+// The index is stored in the cache itself, so it is shared by all processes
+// that use the same cache.
+//
+// Each table has a version which changes when the table is invalidated.
+// The versions are included in the keys of cached queries, so once a table
+// is invalidated, the entries that depend on it are never served again.
+//
+// The index also records which entries depend on which tables so that they can
+// be forgotten (rather than left to expire). This is only an optimization. Each
+// table's dependencies are split across Shards entries of at most MaxDeps keys,
+// and keys that do not fit are not recorded. For storage drivers that implement
+// remember.CASCacher, the index is updated atomically. Otherwise concurrent
+// updates from different processes may lose dependencies.
+type Index struct {
+	Conner remember.Conner
+
+	// KeyPrefix is prepended to every key.
+	// If not set, DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// Expiration is the minimum expiration of the index's entries.
+	// It should be at least as long as the expiration of cached queries that
+	// do not expire (since they extend the index's expiration otherwise).
+	// If not set, DefaultIndexExpiration is used.
+	Expiration time.Duration
+
+	// Shards is the number of entries each table's dependencies are split across.
+	// It must be the same for all processes that share the index.
+	// If not set, DefaultIndexShards is used.
+	Shards int
+
+	// MaxDeps is the maximum number of keys recorded in each shard.
+	// If not set, DefaultMaxDeps is used.
+	MaxDeps int
+
+	// Logger, when set, will log errors encountered while invalidating tables.
+	Logger remember.Logger
+
+	mu sync.Mutex
+}
+
+// NewIndex creates an Index that is stored in c.
+func NewIndex(c remember.Conner) *Index {
+	return &Index{Conner: c}
+}
+
+func (idx *Index) prefix() string {
+	if idx.KeyPrefix == "" {
+		return DefaultKeyPrefix
+	}
+	return idx.KeyPrefix
+}
+
+func (idx *Index) shards() int {
+	if idx.Shards <= 0 {
+		return DefaultIndexShards
+	}
+	return idx.Shards
+}
+
+func (idx *Index) maxDeps() int {
+	if idx.MaxDeps <= 0 {
+		return DefaultMaxDeps
+	}
+	return idx.MaxDeps
+}
+
+func (idx *Index) key(table string, shard int) string {
+	return remember.CreateKey(false, "|", "prefix|deps|table|shard", idx.prefix(), "deps", table, strconv.Itoa(shard))
+}
+
+// shard returns the shard that key is recorded in.
+func (idx *Index) shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(idx.shards()))
+}
+
+func (idx *Index) versionKey(table string) string {
+	return remember.CreateKey(false, "|", "prefix|version|table", idx.prefix(), "version", table)
+}
+
+// Version returns a token that identifies the current version of tables.
+// It changes whenever one of the tables is invalidated.
+func (idx *Index) Version(ctx context.Context, tables ...string) (string, error) {
+
+	cache, err := idx.Conner.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cache.Close()
+
+	versions := make([]string, 0, len(tables))
+	for _, table := range tables {
+		v, err := idx.version(cache, idx.versionKey(table))
+		if err != nil {
+			return "", err
+		}
+		versions = append(versions, v)
+	}
+	return strings.Join(versions, ","), nil
+}
+
+// version returns the version stored at key. A new version is created if
+// it does not exist (eg. because it was evicted).
+func (idx *Index) version(cache remember.Cacher, key string) (string, error) {
+	for {
+		item, found, err := cache.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if v, ok := item.(string); found && ok {
+			return v, nil
+		}
+
+		v, err := newVersion()
+		if err != nil {
+			return "", err
+		}
+
+		cc, ok := cache.(remember.CASCacher)
+		if !ok {
+			return v, cache.Set(key, idx.expiration(nil), storable(cache, v))
+		}
+
+		err = cc.Add(key, idx.expiration(nil), storable(cache, v))
+		if err == remember.ErrNotStored {
+			continue // Created concurrently
+		}
+		return v, err
+	}
+}
+
+// newVersion returns a random version.
+func newVersion() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Record records that key depends on tables.
+// expiration is the expiration of key. A value <= 0 means it does not expire.
+//
+// The key is not recorded if its shard is full. It is still never served
+// after the tables are invalidated.
+func (idx *Index) Record(ctx context.Context, key string, expiration time.Duration, tables ...string) error {
+
+	cache, err := idx.Conner.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	now := time.Now()
+
+	var expires int64
+	if expiration > 0 {
+		expires = now.Add(expiration).UnixNano()
+	}
+
+	shard, max := idx.shard(key), idx.maxDeps()
+
+	for _, table := range tables {
+		err := idx.update(cache, idx.key(table, shard), func(d deps) deps {
+			out := deps{}
+			for k, exp := range d {
+				if k == key || (exp != 0 && exp <= now.UnixNano()) {
+					continue // Replaced or expired
+				}
+				out[k] = exp
+			}
+			if len(out) < max {
+				out[key] = expires
+			}
+			return out
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate changes the version of tables and forgets all entries that depend on them.
+func (idx *Index) Invalidate(ctx context.Context, tables ...string) error {
+
+	cache, err := idx.Conner.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	for _, table := range tables {
+		// The version is changed first so that entries stored concurrently
+		// (and not yet recorded) are unreachable.
+		v, err := newVersion()
+		if err != nil {
+			return err
+		}
+		if err := cache.Set(idx.versionKey(table), idx.expiration(nil), storable(cache, v)); err != nil {
+			return err
+		}
+
+		for shard := 0; shard < idx.shards(); shard++ {
+			// Swap out the dependencies so that concurrently recorded keys are not lost
+			var forget deps
+			err = idx.update(cache, idx.key(table, shard), func(d deps) deps {
+				forget = d
+				return deps{}
+			})
+			if err != nil {
+				return err
+			}
+
+			for k := range forget {
+				if err := cache.Forget(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// invalidate invalidates tables and logs errors. It is used after a
+// statement has been executed, when an error can no longer be returned.
+func (idx *Index) invalidate(tables []string) {
+	if err := idx.Invalidate(context.Background(), tables...); err != nil && idx.Logger != nil {
+		idx.Logger.Log("sqlcache: could not invalidate tables %v: %v\n", tables, err)
+	}
+}
+
+// update replaces the deps stored at key with the result of fn.
+func (idx *Index) update(cache remember.Cacher, key string, fn func(deps) deps) error {
+
+	if cc, ok := cache.(remember.CASCacher); ok {
+		for {
+			item, cas, found, err := cc.GetCAS(key)
+			if err != nil {
+				return err
+			}
+			d, _ := item.(deps)
+			d = fn(d)
+
+			if !found && len(d) == 0 {
+				return nil // Nothing to store
+			}
+			if found {
+				err = cc.CompareAndSwap(key, idx.expiration(d), storable(cache, d), cas)
+			} else {
+				err = cc.Add(key, idx.expiration(d), storable(cache, d))
+			}
+			if err == remember.ErrCASConflict || err == remember.ErrNotStored {
+				continue // Modified concurrently
+			}
+			return err
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	item, _, err := cache.Get(key)
+	if err != nil {
+		return err
+	}
+	d, _ := item.(deps)
+	d = fn(d)
+
+	if item == nil && len(d) == 0 {
+		return nil // Nothing to store
+	}
+	return cache.Set(key, idx.expiration(d), storable(cache, d))
+}
+
+// expiration returns an expiration that outlives all the keys in d.
+func (idx *Index) expiration(d deps) time.Duration {
+	exp := idx.Expiration
+	if exp <= 0 {
+		exp = DefaultIndexExpiration
+	}
+
+	now := time.Now().UnixNano()
+	for _, expires := range d {
+		if remaining := time.Duration(expires - now); remaining > exp {
+			exp = remaining
+		}
+	}
+
+	// Some storage drivers only support whole seconds
+	return exp.Truncate(time.Second) + time.Second
+}
+
+// storable returns item in the form required by the storage driver.
+func storable(cache remember.Cacher, item interface{}) interface{} {
+	if cache.StorePointer() {
+		return &item
+	}
+	return item
+}
@@ -0,0 +1,256 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Normalize collapses whitespace and removes comments and trailing semicolons
+// from query. Quoted strings and identifiers are left untouched.
+func Normalize(query string) string {
+	return strings.Join(tokenize(query), " ")
+}
+
+// Tables returns the lowercased names of the tables referenced by query
+// (ie. after FROM, JOIN, INTO, UPDATE, TABLE and TRUNCATE) in sorted order.
+// Quotes are removed from the names and schema qualifiers are kept.
+//
+// The names are determined using a lexical scan, so it is not a full SQL parser.
+func Tables(query string) []string {
+	tokens := tokenize(query)
+	found := map[string]bool{}
+
+	for i := 0; i < len(tokens); i++ {
+		kw := strings.ToUpper(tokens[i])
+		switch kw {
+		case "FROM", "JOIN", "INTO", "UPDATE", "TABLE", "TRUNCATE":
+		default:
+			continue
+		}
+
+		j := i + 1
+		for j < len(tokens) {
+			// Skip modifiers (eg. "UPDATE ONLY t", "CREATE TABLE IF NOT EXISTS t")
+			for j < len(tokens) && modifiers[strings.ToUpper(tokens[j])] {
+				j++
+			}
+			if j >= len(tokens) || !isIdentifier(tokens[j]) || keywords[strings.ToUpper(tokens[j])] {
+				break // eg. subquery
+			}
+			found[unquote(tokens[j])] = true
+
+			if kw != "FROM" {
+				break
+			}
+
+			// FROM a [AS] x, b [AS] y
+			k := j + 1
+			if k < len(tokens) && strings.EqualFold(tokens[k], "AS") {
+				k += 2
+			} else if k < len(tokens) && isIdentifier(tokens[k]) && !keywords[strings.ToUpper(tokens[k])] {
+				k++
+			}
+			if k >= len(tokens) || tokens[k] != "," {
+				break
+			}
+			j = k + 1
+		}
+	}
+
+	out := make([]string, 0, len(found))
+	for t := range found {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeTables returns the tables modified by query if it modifies data
+// or schema. If the modified tables can not be determined, all the tables
+// referenced by query are returned.
+func writeTables(query string) (_ []string, write bool) {
+	tokens := tokenize(query)
+
+	found := map[string]bool{}
+	for i, tok := range tokens {
+		switch strings.ToUpper(tok) {
+		case "INSERT", "UPDATE", "DELETE", "REPLACE", "MERGE", "UPSERT", "TRUNCATE", "DROP", "ALTER":
+		default:
+			continue
+		}
+
+		if i > 0 {
+			switch strings.ToUpper(tokens[i-1]) {
+			case "FOR", "DO", "ON":
+				continue // SELECT ... FOR UPDATE, ON CONFLICT DO UPDATE, ON DELETE CASCADE
+			}
+		}
+		write = true
+
+		// INSERT INTO t, UPDATE t, DELETE FROM t, TRUNCATE [TABLE] t, DROP TABLE t ...
+		j := i + 1
+		for j < len(tokens) && (modifiers[strings.ToUpper(tokens[j])] || strings.EqualFold(tokens[j], "INTO") || strings.EqualFold(tokens[j], "FROM")) {
+			j++
+		}
+		if j < len(tokens) && isIdentifier(tokens[j]) && !keywords[strings.ToUpper(tokens[j])] {
+			found[unquote(tokens[j])] = true
+		}
+	}
+
+	if !write {
+		return nil, false
+	}
+	if len(found) == 0 {
+		return Tables(query), true
+	}
+
+	out := make([]string, 0, len(found))
+	for t := range found {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out, true
+}
+
+var modifiers = map[string]bool{
+	"ONLY": true, "IF": true, "NOT": true, "EXISTS": true, "LOW_PRIORITY": true, "IGNORE": true, "TABLE": true,
+}
+
+var keywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"OUTER": true, "CROSS": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true,
+	"ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "SET": true, "VALUES": true, "RETURNING": true, "WINDOW": true, "FOR": true,
+	"SELECT": true, "DEFAULT": true,
+}
+
+// isIdentifier reports whether tok is a (possibly quoted or qualified) identifier.
+func isIdentifier(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	switch tok[0] {
+	case '"', '`', '[':
+		return true
+	}
+	r := rune(tok[0])
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// unquote removes identifier quotes and lowercases unquoted parts.
+func unquote(ident string) string {
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if len(p) >= 2 && (p[0] == '"' || p[0] == '`' || p[0] == '[') {
+			parts[i] = strings.ToLower(p[1 : len(p)-1])
+		} else {
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// tokenize splits query into words, quoted strings (including PostgreSQL's
+// dollar-quoted strings), quoted identifiers and punctuation. Comments and
+// trailing semicolons are removed.
+func tokenize(query string) []string {
+	var (
+		tokens []string
+		cur    strings.Builder
+	)
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			// Line comment
+			flush()
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			// Block comment
+			flush()
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			// Quoted strings and identifiers. Identifiers can be qualified (eg. "schema"."table").
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			start := i
+			for i++; i < len(query); i++ {
+				if query[i] == closing {
+					if closing != ']' && i+1 < len(query) && query[i+1] == closing {
+						i++ // Escaped quote
+						continue
+					}
+					break
+				}
+			}
+			if i >= len(query) {
+				i = len(query) - 1
+			}
+			cur.WriteString(query[start : i+1])
+			if c == '\'' {
+				flush()
+			}
+		case c == '$' && cur.Len() == 0 && dollarTag(query[i:]) != "":
+			// Dollar-quoted strings (eg. $$text$$ or $tag$text$tag$)
+			tag := dollarTag(query[i:])
+			start := i
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				i = len(query) - 1
+			} else {
+				i += len(tag) + end + len(tag) - 1
+			}
+			cur.WriteString(query[start : i+1])
+			flush()
+		case unicode.IsSpace(rune(c)):
+			flush()
+		case strings.IndexByte("(),;=<>+*/%", c) >= 0:
+			flush()
+			tokens = append(tokens, string(c))
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+
+	for len(tokens) > 0 && tokens[len(tokens)-1] == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// dollarTag returns the tag (eg. "$$" or "$tag$") that s starts with if s
+// starts a dollar-quoted string. Positional parameters (eg. $1) are not tags.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := rune(s[j])
+		switch {
+		case c == '$':
+			return s[:j+1]
+		case unicode.IsLetter(c) || c == '_' || (j > 1 && unicode.IsDigit(c)):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// scanAll scans rows into the slice pointed to by dest.
+func scanAll(rows *sql.Rows, dest reflect.Value) error {
+
+	slice := dest.Elem()
+	elemType := slice.Type().Elem()
+
+	isPtr := elemType.Kind() == reflect.Ptr
+	baseType := elemType
+	if isPtr {
+		baseType = elemType.Elem()
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	// Determine the field that each column is scanned into
+	var fields [][]int
+	if baseType.Kind() == reflect.Struct && baseType != timeType && !reflect.PtrTo(baseType).Implements(scannerType) {
+		index := fieldIndex(baseType)
+		fields = make([][]int, len(cols))
+		for i, col := range cols {
+			fields[i] = index[strings.ToLower(col)]
+		}
+	} else if len(cols) != 1 {
+		return fmt.Errorf("sqlcache: expected 1 column for %v but got %d", elemType, len(cols))
+	}
+
+	for rows.Next() {
+		elem := reflect.New(baseType)
+
+		targets := make([]interface{}, len(cols))
+		if fields == nil {
+			targets[0] = elem.Interface()
+		} else {
+			for i, idx := range fields {
+				if idx == nil {
+					targets[i] = new(interface{}) // Discard unknown columns
+				} else {
+					targets[i] = fieldByIndex(elem.Elem(), idx).Addr().Interface()
+				}
+			}
+		}
+
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+
+		if isPtr {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	dest.Elem().Set(slice)
+	return nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// fieldIndex maps lowercased column names to the fields of t.
+// A field's column name is taken from its "db" tag. Otherwise both its name
+// and its snake_case name are used. Fields of embedded structs are included.
+func fieldIndex(t reflect.Type) map[string][]int {
+	index := map[string][]int{}
+
+	var walk func(t reflect.Type, parent []int)
+	walk = func(t reflect.Type, parent []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			idx := append(append([]int(nil), parent...), i)
+
+			tag := f.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+
+			if f.Anonymous && tag == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft, idx)
+					continue
+				}
+			}
+
+			if f.PkgPath != "" {
+				// Not exported
+				continue
+			}
+
+			if tag != "" {
+				index[strings.ToLower(tag)] = idx
+				continue
+			}
+
+			// Fields of the outer struct take precedence over embedded fields
+			for _, name := range []string{strings.ToLower(f.Name), snakeCase(f.Name)} {
+				if existing, ok := index[name]; !ok || len(existing) > len(idx) {
+					index[name] = idx
+				}
+			}
+		}
+	}
+	walk(t, nil)
+
+	return index
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// snakeCase converts eg. "UserID" to "user_id".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,171 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+// Package sqlcache caches the results of database/sql queries.
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// DefaultKeyPrefix is the prefix of keys used when DB.KeyPrefix is not set.
+const DefaultKeyPrefix = "sqlcache"
+
+// ErrInvalidDest signifies that dest is not a pointer to a slice.
+var ErrInvalidDest = errors.New("dest must be a pointer to a slice")
+
+// DB wraps a *sql.DB so that query results can be cached.
+type DB struct {
+	*sql.DB
+
+	// KeyPrefix is prepended to every key.
+	// If not set, DefaultKeyPrefix is used.
+	KeyPrefix string
+
+	// Options is used when calling remember.Cache.
+	Options remember.Options
+
+	// Index, when set, records the tables that cached queries depend on.
+	// It should be the same Index that is used by the wrapped driver.
+	// See WrapDriver.
+	Index *Index
+}
+
+// NewDB wraps db.
+func NewDB(db *sql.DB) *DB {
+	return &DB{DB: db}
+}
+
+// QueryCached runs query and scans the rows into dest, which must be a pointer
+// to a slice. The slice's elements can be structs (or pointers to structs), in
+// which case columns are matched to fields using the "db" tag or the field's name.
+// Otherwise each row must have a single column.
+//
+// The result is cached using c. The key is derived from the normalized query
+// and args. See Key.
+//
+// For storage drivers that use the gob package, the slice's type must be registered.
+func (db *DB) QueryCached(ctx context.Context, c remember.Conner, expiration time.Duration, dest interface{}, query string, args ...interface{}) (found bool, _ error) {
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return false, ErrInvalidDest
+	}
+	sliceType := dv.Elem().Type()
+
+	key, tables, err := Key(db.prefix(), query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	if db.Index != nil {
+		// The key includes the version of the tables. A result that is stored
+		// after a concurrent write has invalidated the tables is unreachable.
+		version, err := db.Index.Version(ctx, tables...)
+		if err != nil {
+			return false, err
+		}
+		key += "|" + version
+	}
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		if db.Index != nil {
+			// Recorded so that the entry is forgotten (rather than left to expire)
+			// when the tables are invalidated.
+			if err := db.Index.Record(ctx, key, expiration, tables...); err != nil {
+				return nil, err
+			}
+		}
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		out := reflect.New(sliceType)
+		if err := scanAll(rows, out); err != nil {
+			return nil, err
+		}
+		return out.Elem().Interface(), nil
+	}
+
+	item, found, err := remember.Cache(ctx, c, key, expiration, slowQuery, db.Options)
+	if err != nil {
+		return false, err
+	}
+
+	iv := reflect.ValueOf(item)
+	if !iv.IsValid() || iv.Type() != sliceType {
+		return false, fmt.Errorf("sqlcache: cached value has type %T instead of %v", item, sliceType)
+	}
+
+	// Copy so that modifications to dest do not affect the cached value
+	out := reflect.MakeSlice(sliceType, iv.Len(), iv.Len())
+	reflect.Copy(out, iv)
+	dv.Elem().Set(out)
+
+	return found, nil
+}
+
+func (db *DB) prefix() string {
+	if db.KeyPrefix == "" {
+		return DefaultKeyPrefix
+	}
+	return db.KeyPrefix
+}
+
+// Key generates the key for query and args. It also returns the tables
+// referenced by query.
+//
+// The key contains the referenced tables, the normalized query and the
+// driver values of args.
+func Key(prefix, query string, args ...interface{}) (string, []string, error) {
+
+	normalized := Normalize(query)
+	tables := Tables(normalized)
+
+	parts := []interface{}{prefix, fmt.Sprint(tables), normalized}
+	for _, arg := range args {
+		s, err := formatArg(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, s)
+	}
+
+	return remember.CreateKey(false, "|", "prefix|tables|query|args...", parts...), tables, nil
+}
+
+// formatArg converts arg to a string that also encodes its type so that
+// eg. 1 and "1" produce different keys.
+func formatArg(arg interface{}) (string, error) {
+	var name string
+	if na, ok := arg.(sql.NamedArg); ok {
+		name = "@" + na.Name + "="
+		arg = na.Value
+	}
+
+	v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return name + "nil", nil
+	case []byte:
+		return fmt.Sprintf("%s%T:%x", name, v, v), nil
+	case time.Time:
+		return fmt.Sprintf("%s%T:%s", name, v, v.UTC().Format(time.RFC3339Nano)), nil
+	default:
+		return fmt.Sprintf("%s%T:%v", name, v, v), nil
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlcache_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rocketlaunchr/remember-go/memory"
+	red "github.com/rocketlaunchr/remember-go/redis"
+	"github.com/rocketlaunchr/remember-go/sqlcache"
+)
+
+var ctx = context.Background()
+
+type base struct {
+	ID int64
+}
+
+type book struct {
+	base
+	Title       string
+	AuthorName  string `db:"author"`
+	PublishedAt int64
+	Ignored     string `db:"-"`
+}
+
+func init() {
+	gob.Register([]book{})
+}
+
+func openDB(t *testing.T) *sqlcache.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE books (id INTEGER PRIMARY KEY, title TEXT, author TEXT, published_at INTEGER, extra TEXT)`,
+		`INSERT INTO books (id, title, author, published_at) VALUES (1, 'Dune', 'Herbert', 1965), (2, 'Emma', 'Austen', 1815)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return sqlcache.NewDB(db)
+}
+
+func TestQueryCached(t *testing.T) {
+	db := openDB(t)
+	ms := memory.NewMemoryStore(time.Minute)
+
+	var books []book
+	found, err := db.QueryCached(ctx, ms, time.Minute, &books, `SELECT * FROM books WHERE published_at > ? ORDER BY id`, 1800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Errorf("expected value to not be found in cache")
+	}
+
+	expected := []book{
+		{base{1}, "Dune", "Herbert", 1965, ""},
+		{base{2}, "Emma", "Austen", 1815, ""},
+	}
+	if !reflect.DeepEqual(books, expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, books)
+	}
+
+	// Modify the database so that a cached result can be detected
+	if _, err := db.Exec(`DELETE FROM books`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Whitespace differences produce the same key
+	books[0].Title = "modified"
+	books = nil
+	found, err = db.QueryCached(ctx, ms, time.Minute, &books, "SELECT *\n\tFROM books  WHERE published_at > ?  ORDER BY id;", 1800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+	if !reflect.DeepEqual(books, expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, books)
+	}
+
+	// Different args produce a different key
+	books = nil
+	found, _ = db.QueryCached(ctx, ms, time.Minute, &books, `SELECT * FROM books WHERE published_at > ? ORDER BY id`, "1800")
+	if found || len(books) != 0 {
+		t.Errorf("expected different key for different arg type")
+	}
+}
+
+func TestQueryCachedDestinations(t *testing.T) {
+	db := openDB(t)
+	ms := memory.NewMemoryStore(time.Minute)
+
+	var ptrs []*book
+	if _, err := db.QueryCached(ctx, ms, time.Minute, &ptrs, `SELECT id, title FROM books ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 2 || ptrs[1].ID != 2 || ptrs[1].Title != "Emma" {
+		t.Errorf("wrong val: %+v", ptrs)
+	}
+
+	var titles []string
+	if _, err := db.QueryCached(ctx, ms, time.Minute, &titles, `SELECT title FROM books ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Dune", "Emma"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, titles)
+	}
+
+	var invalid []book
+	if _, err := db.QueryCached(ctx, ms, time.Minute, invalid, `SELECT * FROM books`); err != sqlcache.ErrInvalidDest {
+		t.Errorf("wrong err: expected: %v actual: %v", sqlcache.ErrInvalidDest, err)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	var rs = red.NewRedisStore(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		},
+	})
+
+	db := openDB(t)
+
+	var books []book
+	db.QueryCached(ctx, rs, time.Minute, &books, `SELECT * FROM books ORDER BY id`)
+
+	books = nil
+	found, err := db.QueryCached(ctx, rs, time.Minute, &books, `SELECT * FROM books ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || len(books) != 2 || books[0].AuthorName != "Herbert" {
+		t.Errorf("wrong val: found: %v books: %+v", found, books)
+	}
+}
+
+func TestTables(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`SELECT * FROM books`, []string{"books"}},
+		{`select b.* from Books b join "Authors" a on a.id = b.author_id left join public.reviews r using (id)`, []string{"authors", "books", "public.reviews"}},
+		{`SELECT * FROM a x, b AS y, c WHERE x.id = y.id`, []string{"a", "b", "c"}},
+		{`SELECT * FROM (SELECT id FROM inner_t) sub`, []string{"inner_t"}},
+		{`INSERT INTO books (id, title) VALUES (1, 'FROM fake')`, []string{"books"}},
+		{"UPDATE `books` SET title = 'x' -- FROM comment", []string{"books"}},
+		{`DELETE FROM books /* JOIN fake */ WHERE id = 1`, []string{"books"}},
+		{`TRUNCATE TABLE books`, []string{"books"}},
+		{`INSERT INTO archive SELECT * FROM books`, []string{"archive", "books"}},
+		{`INSERT INTO books (id, title) VALUES ($1, $$ FROM fake's $$)`, []string{"books"}},
+		{`UPDATE books SET title = $tag$ JOIN fake $$ $tag$ WHERE id = $1`, []string{"books"}},
+		{`SELECT * FROM books$archive`, []string{"books$archive"}},
+	}
+
+	for _, test := range tests {
+		actual := sqlcache.Tables(test.query)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%q: wrong tables: expected: %v actual: %v", test.query, test.expected, actual)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	actual := sqlcache.Normalize("SELECT  *\n FROM books -- comment\nWHERE title = 'a  b' OR title = $$c -- d$$;")
+	expected := "SELECT * FROM books WHERE title = 'a  b' OR title = $$c -- d$$"
+
+	if actual != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlstore_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/cachertest"
+	"github.com/rocketlaunchr/remember-go/sqlstore"
+)
+
+func TestConformance(t *testing.T) {
+	var db *sql.DB
+
+	cachertest.Run(t, func(t *testing.T) (remember.Conner, func()) {
+		db = openDB(t)
+		return newStore(t, db), func() { db.Close() }
+	}, cachertest.Config{
+		NoExpiration: sqlstore.NoExpiration,
+		Expiration:   50 * time.Millisecond,
+		Break: func(c remember.Conner) {
+			db.Close()
+		},
+	})
+}
@@ -0,0 +1,318 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rocketlaunchr/remember-go"
+)
+
+// NoExpiration is used to indicate that data should not expire from the cache.
+const NoExpiration time.Duration = -1
+
+// DefaultTable is the table used when Config.Table is not set.
+const DefaultTable = "remember_cache"
+
+// ErrInvalidTable signifies that the table name is not a valid identifier.
+var ErrInvalidTable = errors.New("invalid table name")
+
+var validTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Dialect determines the SQL syntax used to communicate with the database.
+type Dialect int
+
+const (
+	// SQLite is used for SQLite databases (version 3.24 or later).
+	SQLite Dialect = iota
+
+	// Postgres is used for PostgreSQL databases (version 9.5 or later).
+	Postgres
+
+	// MySQL is used for MySQL and MariaDB databases.
+	MySQL
+)
+
+// Config is used to configure a SQLStore.
+type Config struct {
+
+	// Dialect determines the SQL syntax used. The default is SQLite.
+	Dialect Dialect
+
+	// Table is the name of the table that entries are stored in.
+	// If not set, DefaultTable is used.
+	Table string
+
+	// SkipCreateTable, when set, will not create the table.
+	// The table must have the columns: key, value and expires_at
+	// (and key_hash for MySQL).
+	SkipCreateTable bool
+
+	// Schema, when set, is executed instead of the default CREATE TABLE statement.
+	// It is executed in a single call, so if it contains multiple statements, the
+	// database driver must support them (eg. multiStatements for MySQL).
+	Schema string
+
+	// CleanupInterval is how often expired rows are deleted.
+	// 0 means expired rows are never deleted (but are not returned by Get).
+	CleanupInterval time.Duration
+}
+
+// SQLStore is used to create a cache that is stored in a relational database table.
+//
+// The table has the following columns:
+//
+//	key        text primary key
+//	value      blob (gob encoded)
+//	expires_at bigint (UnixNano, 0 means no expiration)
+//
+// MySQL can only index a limited prefix of a text column, so the primary key
+// is instead key_hash (the SHA-256 hash of key).
+type SQLStore struct {
+	DB *sql.DB
+
+	cfg     Config
+	queries queries
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+type queries struct {
+	get, set, forget, forgetAll, deleteExpired string
+
+	// hashKey is set when rows are identified by key_hash.
+	hashKey bool
+}
+
+// keyArg returns the argument that identifies the row for key.
+func (q queries) keyArg(key string) interface{} {
+	if q.hashKey {
+		h := sha256.Sum256([]byte(key))
+		return h[:]
+	}
+	return key
+}
+
+// NewSQLStore creates a cache that is stored in a table of db.
+// Unless SkipCreateTable is set, the table is created if it does not exist.
+func NewSQLStore(db *sql.DB, cfg ...Config) (*SQLStore, error) {
+
+	var c Config
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.Table == "" {
+		c.Table = DefaultTable
+	}
+	if !validTable.MatchString(c.Table) {
+		return nil, ErrInvalidTable
+	}
+
+	s := &SQLStore{
+		DB:      db,
+		cfg:     c,
+		queries: buildQueries(c.Dialect, c.Table),
+	}
+
+	if !c.SkipCreateTable {
+		stmts := buildSchema(c.Dialect, c.Table)
+		if c.Schema != "" {
+			stmts = []string{c.Schema}
+		}
+		for _, stmt := range stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.CleanupInterval > 0 {
+		s.stop = make(chan struct{})
+		go s.janitor(c.CleanupInterval, s.stop)
+	}
+
+	return s, nil
+}
+
+// Conn will provide a connection that uses ctx for all queries.
+func (s *SQLStore) Conn(ctx context.Context) (remember.Cacher, error) {
+	return &SQLConn{
+		ctx:   ctx,
+		store: s,
+	}, nil
+}
+
+// NoExpiration returns the expiration used to indicate that data should not expire.
+func (s *SQLStore) NoExpiration() time.Duration {
+	return NoExpiration
+}
+
+// DeleteExpired deletes all expired rows.
+func (s *SQLStore) DeleteExpired(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.queries.deleteExpired, time.Now().UnixNano())
+	return err
+}
+
+// StopCleanup stops the background deletion of expired rows.
+func (s *SQLStore) StopCleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *SQLStore) janitor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.DeleteExpired(context.Background())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SQLConn represents a single connection to the database.
+type SQLConn struct {
+	ctx   context.Context
+	store *SQLStore
+}
+
+// StorePointer sets whether a storage driver requires itemToStore to be
+// stored as a pointer or as a concrete value.
+func (c *SQLConn) StorePointer() bool {
+	return true
+}
+
+// Get returns a value from the cache if the key exists.
+func (c *SQLConn) Get(key string) (_ interface{}, found bool, _ error) {
+
+	var val []byte
+
+	err := c.store.DB.QueryRowContext(c.ctx, c.store.queries.get, c.store.queries.keyArg(key), time.Now().UnixNano()).Scan(&val)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Key not found
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var output interface{}
+
+	err = gob.NewDecoder(bytes.NewBuffer(val)).Decode(&output)
+	if err != nil {
+		return nil, true, err // Could not decode cached data
+	}
+
+	return output, true, nil
+}
+
+// Set sets a item into the cache for a particular key.
+func (c *SQLConn) Set(key string, expiration time.Duration, itemToStore interface{}) error {
+
+	// Convert item to bytes
+	b := new(bytes.Buffer)
+	err := gob.NewEncoder(b).Encode(itemToStore)
+	if err != nil {
+		return err
+	}
+
+	var expires int64
+	if expiration > 0 {
+		expires = time.Now().Add(expiration).UnixNano()
+	}
+
+	q := c.store.queries
+	if q.hashKey {
+		_, err = c.store.DB.ExecContext(c.ctx, q.set, q.keyArg(key), key, b.Bytes(), expires)
+	} else {
+		_, err = c.store.DB.ExecContext(c.ctx, q.set, key, b.Bytes(), expires)
+	}
+	return err
+}
+
+// Close returns the connection back to the pool for storage drivers that utilize a pool.
+// For this driver, it does nothing since database/sql manages the pool.
+func (c *SQLConn) Close() {}
+
+// Forget clears the value from the cache for the particular key.
+func (c *SQLConn) Forget(key string) error {
+	_, err := c.store.DB.ExecContext(c.ctx, c.store.queries.forget, c.store.queries.keyArg(key))
+	return err
+}
+
+// ForgetAll clears all values from the cache.
+// Only the cache's table is affected.
+func (c *SQLConn) ForgetAll() error {
+	_, err := c.store.DB.ExecContext(c.ctx, c.store.queries.forgetAll)
+	return err
+}
+
+func buildSchema(d Dialect, table string) []string {
+	switch d {
+	case Postgres:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ("key" TEXT PRIMARY KEY, "value" BYTEA NOT NULL, "expires_at" BIGINT NOT NULL)`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s ("expires_at")`, indexName(table), table),
+		}
+	case MySQL:
+		return []string{
+			fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`key_hash` BINARY(32) NOT NULL PRIMARY KEY, `key` TEXT NOT NULL, `value` LONGBLOB NOT NULL, `expires_at` BIGINT NOT NULL, INDEX (`expires_at`))", table),
+		}
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ("key" TEXT PRIMARY KEY, "value" BLOB NOT NULL, "expires_at" INTEGER NOT NULL)`, table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s ("expires_at")`, indexName(table), table),
+	}
+}
+
+func indexName(table string) string {
+	return strings.Replace(table, ".", "_", -1) + "_expires_at_idx"
+}
+
+func buildQueries(d Dialect, table string) queries {
+	switch d {
+	case Postgres:
+		return queries{
+			get:           fmt.Sprintf(`SELECT "value" FROM %s WHERE "key" = $1 AND ("expires_at" = 0 OR "expires_at" > $2)`, table),
+			set:           fmt.Sprintf(`INSERT INTO %s ("key", "value", "expires_at") VALUES ($1, $2, $3) ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value", "expires_at" = EXCLUDED."expires_at"`, table),
+			forget:        fmt.Sprintf(`DELETE FROM %s WHERE "key" = $1`, table),
+			forgetAll:     fmt.Sprintf(`DELETE FROM %s`, table),
+			deleteExpired: fmt.Sprintf(`DELETE FROM %s WHERE "expires_at" <> 0 AND "expires_at" <= $1`, table),
+		}
+	case MySQL:
+		return queries{
+			get:           fmt.Sprintf("SELECT `value` FROM %s WHERE `key_hash` = ? AND (`expires_at` = 0 OR `expires_at` > ?)", table),
+			set:           fmt.Sprintf("INSERT INTO %s (`key_hash`, `key`, `value`, `expires_at`) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE `value` = VALUES(`value`), `expires_at` = VALUES(`expires_at`)", table),
+			forget:        fmt.Sprintf("DELETE FROM %s WHERE `key_hash` = ?", table),
+			forgetAll:     fmt.Sprintf("DELETE FROM %s", table),
+			deleteExpired: fmt.Sprintf("DELETE FROM %s WHERE `expires_at` <> 0 AND `expires_at` <= ?", table),
+			hashKey:       true,
+		}
+	}
+	return queries{
+		get:           fmt.Sprintf(`SELECT "value" FROM %s WHERE "key" = ? AND ("expires_at" = 0 OR "expires_at" > ?)`, table),
+		set:           fmt.Sprintf(`INSERT INTO %s ("key", "value", "expires_at") VALUES (?, ?, ?) ON CONFLICT ("key") DO UPDATE SET "value" = excluded."value", "expires_at" = excluded."expires_at"`, table),
+		forget:        fmt.Sprintf(`DELETE FROM %s WHERE "key" = ?`, table),
+		forgetAll:     fmt.Sprintf(`DELETE FROM %s`, table),
+		deleteExpired: fmt.Sprintf(`DELETE FROM %s WHERE "expires_at" <> 0 AND "expires_at" <= ?`, table),
+	}
+}
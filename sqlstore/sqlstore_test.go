@@ -0,0 +1,271 @@
+// Copyright 2018-21 PJ Engineering and Business Solutions Pty. Ltd. All rights reserved.
+
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rocketlaunchr/remember-go"
+	"github.com/rocketlaunchr/remember-go/sqlstore"
+)
+
+var ctx = context.Background()
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func newStore(t *testing.T, db *sql.DB, cfg ...sqlstore.Config) *sqlstore.SQLStore {
+	t.Helper()
+
+	s, err := sqlstore.NewSQLStore(db, cfg...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func conn(t *testing.T, s *sqlstore.SQLStore) remember.Cacher {
+	t.Helper()
+
+	c, err := s.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func set(t *testing.T, c remember.Cacher, key string, exp time.Duration, val interface{}) {
+	t.Helper()
+
+	if err := c.Set(key, exp, &val); err != nil {
+		t.Fatalf("set %q: %v", key, err)
+	}
+}
+
+func TestKeyBasicOperation(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	var s = newStore(t, db)
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	actual, _, _ := remember.Cache(ctx, s, key, exp, slowQuery)
+
+	expected := "val"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestFetchFromCacheAndDisableCache(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	var s = newStore(t, db)
+
+	key := "key"
+	exp := 10 * time.Minute
+
+	slowQuery := func(ctx context.Context) (interface{}, error) {
+		return "val", nil
+	}
+
+	// warm up cache
+	remember.Cache(ctx, s, key, exp, slowQuery)
+
+	// This time fetch from cache
+	actual, found, _ := remember.Cache(ctx, s, key, exp, slowQuery)
+
+	expected := "val"
+
+	if !found {
+		t.Errorf("expected value to be found in cache")
+	}
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+
+	// Actual is now "val", Let's change it to "val2" and disable cache usage.
+
+	slowQuery = func(ctx context.Context) (interface{}, error) {
+		return "val2", nil
+	}
+
+	actual, _, _ = remember.Cache(ctx, s, key, exp, slowQuery, remember.Options{DisableCacheUsage: true})
+
+	expected = "val2"
+
+	if actual.(string) != expected {
+		t.Errorf("wrong val: expected: %v actual: %v", expected, actual)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	c := conn(t, newStore(t, db))
+
+	set(t, c, "key", sqlstore.NoExpiration, "val1")
+	set(t, c, "key", sqlstore.NoExpiration, "val2")
+
+	actual, found, err := c.Get("key")
+	if err != nil || !found {
+		t.Fatalf("get: found: %v err: %v", found, err)
+	}
+
+	if actual.(string) != "val2" {
+		t.Errorf("wrong val: expected: %v actual: %v", "val2", actual)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	s := newStore(t, db)
+	c := conn(t, s)
+
+	set(t, c, "short", 10*time.Millisecond, "val")
+	set(t, c, "forever", sqlstore.NoExpiration, "val")
+
+	time.Sleep(20 * time.Millisecond)
+
+	assertFound(t, c, "short", false)
+	assertFound(t, c, "forever", true)
+
+	if err := s.DeleteExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRows(t, db, sqlstore.DefaultTable); n != 1 {
+		t.Errorf("wrong number of rows: expected: %v actual: %v", 1, n)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	s := newStore(t, db, sqlstore.Config{CleanupInterval: 10 * time.Millisecond})
+	defer s.StopCleanup()
+
+	set(t, conn(t, s), "short", 10*time.Millisecond, "val")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := countRows(t, db, sqlstore.DefaultTable); n != 0 {
+		t.Errorf("wrong number of rows: expected: %v actual: %v", 0, n)
+	}
+}
+
+func TestForgetAllOnlyAffectsTable(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	c1 := conn(t, newStore(t, db, sqlstore.Config{Table: "cache_one"}))
+	c2 := conn(t, newStore(t, db, sqlstore.Config{Table: "cache_two"}))
+
+	set(t, c1, "a", sqlstore.NoExpiration, 1)
+	set(t, c1, "b", sqlstore.NoExpiration, 2)
+	set(t, c2, "a", sqlstore.NoExpiration, 3)
+
+	if err := c1.Forget("a"); err != nil {
+		t.Fatal(err)
+	}
+	assertFound(t, c1, "a", false)
+	assertFound(t, c1, "b", true)
+
+	if err := c1.ForgetAll(); err != nil {
+		t.Fatal(err)
+	}
+	assertFound(t, c1, "b", false)
+	assertFound(t, c2, "a", true)
+}
+
+func TestCustomSchema(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	_, err := sqlstore.NewSQLStore(db, sqlstore.Config{Table: "missing", SkipCreateTable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`SELECT 1 FROM missing`); err == nil {
+		t.Errorf("expected table to not be created")
+	}
+
+	s := newStore(t, db, sqlstore.Config{
+		Table:  "custom",
+		Schema: `CREATE TABLE IF NOT EXISTS custom ("key" TEXT PRIMARY KEY, "value" BLOB NOT NULL, "expires_at" INTEGER NOT NULL, "note" TEXT DEFAULT 'a;b', "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+	})
+
+	c := conn(t, s)
+	set(t, c, "key", sqlstore.NoExpiration, "val")
+	assertFound(t, c, "key", true)
+
+	// The schema was not split on the ";" within the string literal
+	var note string
+	if err := db.QueryRow(`SELECT "note" FROM custom`).Scan(&note); err != nil || note != "a;b" {
+		t.Errorf("wrong val: expected: %v actual: %v (err: %v)", "a;b", note, err)
+	}
+
+	_, err = sqlstore.NewSQLStore(db, sqlstore.Config{Table: "bad; DROP TABLE custom"})
+	if err != sqlstore.ErrInvalidTable {
+		t.Errorf("wrong err: expected: %v actual: %v", sqlstore.ErrInvalidTable, err)
+	}
+}
+
+func TestLongKey(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	c := conn(t, newStore(t, db))
+
+	key := remember.CreateKeyStruct(struct{ Query string }{strings.Repeat("x", 500)})
+	set(t, c, key, sqlstore.NoExpiration, "val")
+	assertFound(t, c, key, true)
+}
+
+func assertFound(t *testing.T, c remember.Cacher, key string, expected bool) {
+	t.Helper()
+
+	_, found, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	if found != expected {
+		t.Errorf("wrong found for %q: expected: %v actual: %v", key, expected, found)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}